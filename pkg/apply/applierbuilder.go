@@ -6,7 +6,10 @@ import (
 	"text/template"
 
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/sops"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"k8s.io/client-go/dynamic"
@@ -26,6 +29,42 @@ type Applier struct {
 	controller          *bool
 	blockOwnerDeletion  *bool
 	kindOrder           KindsOrder
+	//partials are the files containing named templates loaded before each template
+	partials []string
+	//libraries are the partials provided by WithPartials
+	libraries []*templateLibrary
+	//headers are the headers provided by WithHeaders
+	headers []templateHeader
+	//templateCache holds the compiled templates
+	templateCache *templateCache
+	//renderCache holds the templates rendered during a call
+	renderCache *renderCache
+	//dryRun is true when the call is in dry-run, the lookup function returns empty maps
+	dryRun bool
+	//release is set when the values are wrapped in a template context
+	release *Release
+	//capabilities overrides the discovered capabilities of the template context
+	capabilities *Capabilities
+	//decrypter decrypts the values of the decrypt function
+	decrypter *sops.Decrypter
+	//patches are applied to the rendered objects
+	patches []Patch
+	//postRenderers mutate each rendered object
+	postRenderers []PostRenderer
+	//execPostRenderer mutates the set of rendered objects
+	execPostRenderer *ExecPostRenderer
+	//restConfig is used by the lookup function of the helm charts
+	restConfig *rest.Config
+	//restMapper maps the kinds to their resources, it is shared by the copies of the applier
+	restMapper meta.ResettableRESTMapper
+	//imageOverrides maps the images of the workloads to their overrides
+	imageOverrides map[string]string
+	//validator validates the rendered objects
+	validator *Validator
+	//policy checks the rendered objects
+	policy *Policy
+	//apiVersionChecker checks the apiVersions of the rendered objects
+	apiVersionChecker *APIVersionChecker
 }
 
 // ApplierBuilder a builder to build the applier
@@ -53,6 +92,30 @@ type iApplierBuilder interface {
 	WithContext(ctx context.Context) *ApplierBuilder
 	// WithKindOrder define in which order to the files must be applied
 	WithKindOrder(kindOrder KindsOrder) *ApplierBuilder
+	// WithPartials add partials shared by all templates
+	WithPartials(reader asset.ScenarioReader, paths ...string) *ApplierBuilder
+	// WithHeaders add headers parsed before each template
+	WithHeaders(reader asset.ScenarioReader, paths ...string) *ApplierBuilder
+	// WithTemplateContext wraps the values in a template context
+	WithTemplateContext(release Release) *ApplierBuilder
+	// WithCapabilities sets the capabilities of the template context
+	WithCapabilities(capabilities Capabilities) *ApplierBuilder
+	// WithDecrypter sets the decrypter of the decrypt function
+	WithDecrypter(decrypter *sops.Decrypter) *ApplierBuilder
+	// WithPatches adds patches applied to the rendered objects
+	WithPatches(patches ...Patch) *ApplierBuilder
+	// WithPostRenderer adds post-renderers mutating the rendered objects
+	WithPostRenderer(postRenderers ...PostRenderer) *ApplierBuilder
+	// WithExecPostRenderer sets an executable post-renderer
+	WithExecPostRenderer(postRenderer *ExecPostRenderer) *ApplierBuilder
+	// WithImageOverrides overrides the images of the rendered workloads
+	WithImageOverrides(imageOverrides map[string]string) *ApplierBuilder
+	// WithValidator validates the rendered objects against their OpenAPI schema
+	WithValidator(validator *Validator) *ApplierBuilder
+	// WithPolicy checks the rendered objects against policy rules
+	WithPolicy(policy *Policy) *ApplierBuilder
+	// WithAPIVersionChecker checks the apiVersions of the rendered objects against a Kubernetes version
+	WithAPIVersionChecker(checker *APIVersionChecker) *ApplierBuilder
 	// GetKubeClient returns the kubeclient
 	GetKubeClient() kubernetes.Interface
 	// GetAPIExtensionClient returns the APIExtensionClient
@@ -79,6 +142,9 @@ func (a *ApplierBuilder) Build() Applier {
 	if a.applier.kindOrder == nil {
 		a.applier.kindOrder = DefaultCreateUpdateKindsOrder
 	}
+	if a.applier.templateCache == nil {
+		a.applier.templateCache = newTemplateCache()
+	}
 	return a.applier
 }
 
@@ -91,6 +157,9 @@ func (a *ApplierBuilder) WithRestConfig(cfg *rest.Config) *ApplierBuilder {
 	a.applier.kubeClient = kubeClient
 	a.applier.apiExtensionsClient = apiExtensionsClient
 	a.applier.dynamicClient = dynamicClient
+	a.applier.restConfig = cfg
+	a.applier.restMapper = newRESTMapper(kubeClient)
+	a.applier.templateCache = nil
 	return a
 }
 
@@ -102,12 +171,16 @@ func (a *ApplierBuilder) WithClient(
 	a.applier.kubeClient = kubeClient
 	a.applier.apiExtensionsClient = apiExtensionsClient
 	a.applier.dynamicClient = dynamicClient
+	a.applier.restMapper = newRESTMapper(kubeClient)
+	a.applier.templateCache = nil
 	return a
 }
 
 // WithTemplateFuncMap add template.FuncMap to the applier.
 func (a *ApplierBuilder) WithTemplateFuncMap(fm template.FuncMap) *ApplierBuilder {
 	a.applier.templateFuncMap = fm
+	a.applier.libraries = resetTemplateLibraries(a.applier.libraries)
+	a.applier.templateCache = nil
 	return a
 }
 
@@ -132,6 +205,7 @@ func (a *ApplierBuilder) WithCache(cache resourceapply.ResourceCache) *ApplierBu
 // WithContext  set a the cache instead of using the default cache created on the Build()
 func (a *ApplierBuilder) WithContext(ctx context.Context) *ApplierBuilder {
 	a.applier.context = ctx
+	a.applier.templateCache = nil
 	return a
 }
 
@@ -141,6 +215,98 @@ func (a *ApplierBuilder) WithKindOrder(kindsOrder KindsOrder) *ApplierBuilder {
 	return a
 }
 
+// WithPartials adds the partials located in the paths of the reader.
+// The named templates defined in the partials are parsed once and shared by all templates
+// like the helm _helpers.tpl. If no paths are provided all files of the reader are used.
+// This can be called multiple times.
+func (a *ApplierBuilder) WithPartials(reader asset.ScenarioReader, paths ...string) *ApplierBuilder {
+	a.applier.libraries = append(a.applier.libraries, newTemplateLibrary(reader, paths...))
+	a.applier.templateCache = nil
+	return a
+}
+
+// WithHeaders adds the headers located in the paths of the reader.
+// The headers are parsed before each template like the header file, after the header file
+// and before the partials. This can be called multiple times.
+func (a *ApplierBuilder) WithHeaders(reader asset.ScenarioReader, paths ...string) *ApplierBuilder {
+	a.applier.headers = append(a.applier.headers, templateHeader{reader: reader, paths: paths})
+	return a
+}
+
+// WithTemplateContext wraps the values in a template context, the templates access
+// the values with .Values and the context with .Release, .Capabilities, .Template and .Files like in helm.
+func (a *ApplierBuilder) WithTemplateContext(release Release) *ApplierBuilder {
+	a.applier.release = &release
+	return a
+}
+
+// WithCapabilities sets the .Capabilities of the template context instead of discovering them,
+// it can be used to render the templates for a given cluster without a client.
+func (a *ApplierBuilder) WithCapabilities(capabilities Capabilities) *ApplierBuilder {
+	a.applier.capabilities = &capabilities
+	return a
+}
+
+// WithDecrypter sets the decrypter used by the decrypt template function to decrypt
+// the age encrypted values.
+func (a *ApplierBuilder) WithDecrypter(decrypter *sops.Decrypter) *ApplierBuilder {
+	a.applier.decrypter = decrypter
+	a.applier.templateCache = nil
+	return a
+}
+
+// WithPatches adds strategic merge patches and JSON 6902 patches applied in order to the
+// rendered objects matching their target, before the post-renderers. It can be called multiple times.
+func (a *ApplierBuilder) WithPatches(patches ...Patch) *ApplierBuilder {
+	a.applier.patches = append(a.applier.patches, patches...)
+	return a
+}
+
+// WithPostRenderer adds post-renderers called in order on each rendered object,
+// it can be called multiple times. The object is removed if a post-renderer empties it.
+func (a *ApplierBuilder) WithPostRenderer(postRenderers ...PostRenderer) *ApplierBuilder {
+	a.applier.postRenderers = append(a.applier.postRenderers, postRenderers...)
+	return a
+}
+
+// WithExecPostRenderer sets an executable receiving all rendered objects on its standard input
+// and writing the objects to apply on its standard output, it runs after the post-renderers.
+func (a *ApplierBuilder) WithExecPostRenderer(postRenderer *ExecPostRenderer) *ApplierBuilder {
+	a.applier.execPostRenderer = postRenderer
+	return a
+}
+
+// WithImageOverrides overrides the images of the containers and init containers of the rendered
+// Deployments, StatefulSets, DaemonSets, Jobs, CronJobs and Pods, the keys are the images to override
+// and the values are the new images, see ParseImageOverrides. It can be called multiple times.
+func (a *ApplierBuilder) WithImageOverrides(imageOverrides map[string]string) *ApplierBuilder {
+	a.applier.imageOverrides = mergeImageOverrides(a.applier.imageOverrides, imageOverrides)
+	return a
+}
+
+// WithValidator validates the rendered objects against the OpenAPI schemas of the validator,
+// nothing is applied or returned if an object is invalid and the error is a ValidationErrors.
+func (a *ApplierBuilder) WithValidator(validator *Validator) *ApplierBuilder {
+	a.applier.validator = validator
+	return a
+}
+
+// WithPolicy checks the rendered objects against the rules of the policy after their validation,
+// in enforce mode nothing is applied or returned if an object violates a rule and the error
+// is a PolicyViolations, in warn mode the violations are logged.
+func (a *ApplierBuilder) WithPolicy(policy *Policy) *ApplierBuilder {
+	a.applier.policy = policy
+	return a
+}
+
+// WithAPIVersionChecker checks the apiVersions of the rendered objects against the deprecations
+// of the Kubernetes version of the checker before their validation, nothing is applied or returned
+// if an object uses a removed apiVersion and the error is a RemovedAPIVersionErrors.
+func (a *ApplierBuilder) WithAPIVersionChecker(checker *APIVersionChecker) *ApplierBuilder {
+	a.applier.apiVersionChecker = checker
+	return a
+}
+
 func (a *ApplierBuilder) GetKubeClient() kubernetes.Interface {
 	return a.applier.kubeClient
 }
@@ -12,9 +12,9 @@ import (
 
 	"github.com/stolostron/applier/pkg/asset"
 	"github.com/stolostron/applier/pkg/helpers"
+	"github.com/stolostron/applier/pkg/sops"
 
 	"github.com/Masterminds/sprig"
-	"github.com/ghodss/yaml"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -23,6 +23,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
@@ -51,6 +52,10 @@ func (a Applier) WithRestConfig(cfg *rest.Config) Applier {
 	applier.kubeClient = kubeClient
 	applier.apiExtensionsClient = apiExtensionsClient
 	applier.dynamicClient = dynamicClient
+	applier.restConfig = cfg
+	applier.restMapper = newRESTMapper(kubeClient)
+	// The lookup function of the compiled templates uses the clients
+	applier.templateCache = newTemplateCache()
 	return applier
 }
 
@@ -63,13 +68,40 @@ func (a Applier) WithClient(
 	applier.kubeClient = kubeClient
 	applier.apiExtensionsClient = apiExtensionsClient
 	applier.dynamicClient = dynamicClient
+	applier.restMapper = newRESTMapper(kubeClient)
+	// The lookup function of the compiled templates uses the clients
+	applier.templateCache = newTemplateCache()
 	return applier
 }
 
+//newRESTMapper returns the mapper of the kinds discovered with the client, nil without client
+func newRESTMapper(kubeClient kubernetes.Interface) meta.ResettableRESTMapper {
+	if kubeClient == nil {
+		return nil
+	}
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery()))
+}
+
+//restMapping returns the mapping of the kind, the discovered kinds are reset if the kind
+//is unknown as it can be a custom resource defined by a CRD created since the discovery.
+func (a Applier) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	if a.restMapper == nil {
+		return nil, fmt.Errorf("missing kubeClient")
+	}
+	mapping, err := a.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	a.restMapper.Reset()
+	return a.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
 // WithTemplateFuncMap add template.FuncMap to the applier.
 func (a Applier) WithTemplateFuncMap(fm template.FuncMap) Applier {
 	applier := a
 	applier.templateFuncMap = fm
+	applier.libraries = resetTemplateLibraries(a.libraries)
+	applier.templateCache = newTemplateCache()
 	return applier
 }
 
@@ -97,6 +129,93 @@ func (a Applier) WithCache(cache resourceapply.ResourceCache) Applier {
 func (a Applier) WithContext(ctx context.Context) Applier {
 	applier := a
 	applier.context = ctx
+	// The lookup function of the compiled templates uses the context
+	applier.templateCache = newTemplateCache()
+	return applier
+}
+
+// WithTemplateContext wraps the values in a template context, the templates access
+// the values with .Values and the context with .Release, .Capabilities, .Template and .Files like in helm.
+func (a Applier) WithTemplateContext(release Release) Applier {
+	applier := a
+	applier.release = &release
+	return applier
+}
+
+// WithCapabilities sets the .Capabilities of the template context instead of discovering them,
+// it can be used to render the templates for a given cluster without a client.
+func (a Applier) WithCapabilities(capabilities Capabilities) Applier {
+	applier := a
+	applier.capabilities = &capabilities
+	return applier
+}
+
+// WithDecrypter sets the decrypter used by the decrypt template function to decrypt
+// the age encrypted values.
+func (a Applier) WithDecrypter(decrypter *sops.Decrypter) Applier {
+	applier := a
+	applier.decrypter = decrypter
+	// The decrypt function of the compiled templates uses the decrypter
+	applier.templateCache = newTemplateCache()
+	return applier
+}
+
+// WithPatches adds strategic merge patches and JSON 6902 patches applied in order to the
+// rendered objects matching their target, before the post-renderers. It can be called multiple times.
+func (a Applier) WithPatches(patches ...Patch) Applier {
+	applier := a
+	applier.patches = append(append([]Patch{}, a.patches...), patches...)
+	return applier
+}
+
+// WithPostRenderer adds post-renderers called in order on each rendered object,
+// it can be called multiple times. The object is removed if a post-renderer empties it.
+func (a Applier) WithPostRenderer(postRenderers ...PostRenderer) Applier {
+	applier := a
+	applier.postRenderers = append(append([]PostRenderer{}, a.postRenderers...), postRenderers...)
+	return applier
+}
+
+// WithExecPostRenderer sets an executable receiving all rendered objects on its standard input
+// and writing the objects to apply on its standard output, it runs after the post-renderers.
+func (a Applier) WithExecPostRenderer(postRenderer *ExecPostRenderer) Applier {
+	applier := a
+	applier.execPostRenderer = postRenderer
+	return applier
+}
+
+// WithImageOverrides overrides the images of the containers and init containers of the rendered
+// Deployments, StatefulSets, DaemonSets, Jobs, CronJobs and Pods, the keys are the images to override
+// and the values are the new images, see ParseImageOverrides. It can be called multiple times.
+func (a Applier) WithImageOverrides(imageOverrides map[string]string) Applier {
+	applier := a
+	applier.imageOverrides = mergeImageOverrides(a.imageOverrides, imageOverrides)
+	return applier
+}
+
+// WithValidator validates the rendered objects against the OpenAPI schemas of the validator,
+// nothing is applied or returned if an object is invalid and the error is a ValidationErrors.
+func (a Applier) WithValidator(validator *Validator) Applier {
+	applier := a
+	applier.validator = validator
+	return applier
+}
+
+// WithPolicy checks the rendered objects against the rules of the policy after their validation,
+// in enforce mode nothing is applied or returned if an object violates a rule and the error
+// is a PolicyViolations, in warn mode the violations are logged.
+func (a Applier) WithPolicy(policy *Policy) Applier {
+	applier := a
+	applier.policy = policy
+	return applier
+}
+
+// WithAPIVersionChecker checks the apiVersions of the rendered objects against the deprecations
+// of the Kubernetes version of the checker before their validation, nothing is applied or returned
+// if an object uses a removed apiVersion and the error is a RemovedAPIVersionErrors.
+func (a Applier) WithAPIVersionChecker(checker *APIVersionChecker) Applier {
+	applier := a
+	applier.apiVersionChecker = checker
 	return applier
 }
 
@@ -107,6 +226,26 @@ func (a Applier) WithKindOrder(kindsOrder KindsOrder) Applier {
 	return applier
 }
 
+// WithPartials adds the partials located in the paths of the reader.
+// The named templates defined in the partials are parsed once and shared by all templates
+// like the helm _helpers.tpl. If no paths are provided all files of the reader are used.
+// This can be called multiple times.
+func (a Applier) WithPartials(reader asset.ScenarioReader, paths ...string) Applier {
+	applier := a
+	applier.libraries = append(append([]*templateLibrary{}, a.libraries...), newTemplateLibrary(reader, paths...))
+	applier.templateCache = newTemplateCache()
+	return applier
+}
+
+// WithHeaders adds the headers located in the paths of the reader.
+// The headers are parsed before each template like the header file, after the header file
+// and before the partials. This can be called multiple times.
+func (a Applier) WithHeaders(reader asset.ScenarioReader, paths ...string) Applier {
+	applier := a
+	applier.headers = append(append([]templateHeader{}, a.headers...), templateHeader{reader: reader, paths: paths})
+	return applier
+}
+
 func (a Applier) GetCache() resourceapply.ResourceCache {
 	return a.cache
 }
@@ -116,9 +255,9 @@ func (a Applier) Apply(reader asset.ScenarioReader,
 	dryRun bool,
 	headerFile string,
 	files ...string) ([]string, error) {
-	var err error
-	var memFSReader asset.ScenarioReader
-	memFSReader, files, err = getFiles(reader, files, headerFile)
+	a.dryRun = dryRun
+	// The files are rendered and split in documents
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
 	if err != nil {
 		return nil, err
 	}
@@ -181,15 +320,15 @@ func (a Applier) ApplyDeployments(
 	dryRun bool,
 	headerFile string,
 	files ...string) ([]string, error) {
+	a.dryRun = dryRun
 	output := make([]string, 0)
-	// Remove header files from the files as it should not be processed.
-	files = asset.Delete(files, headerFile)
-	//Render each file
+	// The files are rendered and split in documents
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
+	if err != nil {
+		return nil, err
+	}
 	for _, name := range files {
-		if name == headerFile {
-			continue
-		}
-		deployment, err := a.ApplyDeployment(reader, values, dryRun, headerFile, name)
+		deployment, err := a.ApplyDeployment(memFSReader, values, dryRun, headerFile, name)
 		if err != nil {
 			if helpers.IsEmptyAsset(err) {
 				continue
@@ -208,6 +347,7 @@ func (a Applier) ApplyDeployment(
 	dryRun bool,
 	headerFile string,
 	name string) (string, error) {
+	a.dryRun = dryRun
 	genericScheme.AddKnownTypes(appsv1.SchemeGroupVersion, &appsv1.Deployment{})
 	recorder := events.NewInMemoryRecorder(helpers.GetExampleHeader())
 	deploymentBytes, err := a.MustTemplateAsset(reader, values, headerFile, name)
@@ -239,12 +379,12 @@ func (a Applier) ApplyDirectly(
 	dryRun bool,
 	headerFile string,
 	files ...string) ([]string, error) {
+	a.dryRun = dryRun
 	if dryRun {
 		return a.MustTemplateAssets(reader, values, headerFile, files...)
 	}
-	var err error
-	var memFSReader asset.ScenarioReader
-	memFSReader, files, err = getFiles(reader, files, headerFile)
+	// The files are rendered and split in documents
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
 	if err != nil {
 		return nil, err
 	}
@@ -280,25 +420,80 @@ func (a Applier) ApplyDirectly(
 	return output, nil
 }
 
-func getFiles(reader asset.ScenarioReader, files []string, headerFile string) (asset.ScenarioReader, []string, error) {
+//renderFiles renders the files and splits the rendered files in documents stored in memory,
+//the documents are named after their source file and their index.
+//It returns a copy of the applier which loads the partials found in the files and
+//which doesn't render again the documents.
+func (a Applier) renderFiles(reader asset.ScenarioReader,
+	values interface{},
+	headerFile string,
+	files []string) (Applier, *asset.MemFS, []string, error) {
+	a = a.withRenderCache()
+	// The files are already rendered documents
+	if memFSReader, ok := a.renderCache.documentsReader(reader); ok {
+		return a, memFSReader, asset.Delete(append([]string{}, files...), headerFile), nil
+	}
+	// The partials already found must be part of the listing
+	files = append(append([]string{}, files...), a.partials...)
 	// Get all assets in the files array. The files could be a file name or directory
 	files, err := reader.AssetNames(files, []string{}, headerFile)
 	if err != nil {
-		return nil, nil, err
+		return a, nil, nil, err
 	}
-	// Files can contain multiple assets then we need to split all files
-	// and we stored them in memory
-	memFSReader, err := helpers.SplitFiles(reader, files)
+	// The partials contain only named templates and so they are not rendered.
+	applier, templates := a.withPartials(headerFile, files)
+	referenced, err := referencedKustomizations(reader, templates)
 	if err != nil {
-		return nil, nil, err
+		return a, nil, nil, err
 	}
-
-	// Get all assets in the files array. The files could be a file name or directory
-	files, err = memFSReader.AssetNames(files, nil, headerFile)
+	rendered := make([]helpers.Document, 0, len(templates))
+	for _, name := range templates {
+		if name == headerFile {
+			continue
+		}
+		// The files of a kustomization directory are built with their kustomization file
+		// and the bases with the kustomizations referencing them.
+		if asset.InKustomization(name, templates) || referenced[name] {
+			continue
+		}
+		documents, err := applier.renderDocuments(reader, values, headerFile, name)
+		if err != nil {
+			if helpers.IsEmptyAsset(err) {
+				applier.renderCache.addEmptyAsset(name)
+				continue
+			}
+			return a, nil, nil, err
+		}
+		rendered = append(rendered, documents...)
+	}
+	rendered, err = applier.finalizeDocuments(rendered)
 	if err != nil {
-		return nil, nil, err
+		return a, nil, nil, err
+	}
+	memFSReader := asset.NewMemFSReader()
+	names := make([]string, 0, len(rendered))
+	for _, document := range rendered {
+		memFSReader.AddAsset(document.Name, document.Content)
+		names = asset.AppendItNotExists(names, document.Name)
 	}
-	return memFSReader, files, nil
+	applier.renderCache.addDocumentsReader(memFSReader)
+	return applier, memFSReader, names, nil
+}
+
+//withPartials returns a copy of the applier which loads the partials found in the files
+//and the files which are not partials.
+func (a Applier) withPartials(headerFile string, files []string) (Applier, []string) {
+	applier := a
+	applier.partials = append([]string{}, a.partials...)
+	templates := make([]string, 0, len(files))
+	for _, f := range files {
+		if f != headerFile && asset.IsPartial(f) {
+			applier.partials = asset.AppendItNotExists(applier.partials, f)
+			continue
+		}
+		templates = append(templates, f)
+	}
+	return applier, templates
 }
 
 //ApplyCustomResources applies custom resources
@@ -308,14 +503,15 @@ func (a Applier) ApplyCustomResources(
 	dryRun bool,
 	headerFile string,
 	files ...string) ([]string, error) {
+	a.dryRun = dryRun
 	output := make([]string, 0)
-	// Remove header files from the files as it should not be processed.
-	files = asset.Delete(files, headerFile)
+	// The files are rendered and split in documents
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
+	if err != nil {
+		return nil, err
+	}
 	for _, name := range files {
-		if name == headerFile {
-			continue
-		}
-		asset, err := a.ApplyCustomResource(reader, values, dryRun, headerFile, name)
+		asset, err := a.ApplyCustomResource(memFSReader, values, dryRun, headerFile, name)
 		if err != nil {
 			if helpers.IsEmptyAsset(err) {
 				continue
@@ -334,6 +530,7 @@ func (a Applier) ApplyCustomResource(
 	dryRun bool,
 	headerFile string,
 	name string) (string, error) {
+	a.dryRun = dryRun
 	var output string
 	if a.kubeClient == nil {
 		return output, fmt.Errorf("missing apiExtensionsClient")
@@ -415,6 +612,9 @@ func getTemplate(templateName string, customFuncMap template.FuncMap) *template.
 		Option("missingkey=zero").
 		Funcs(FuncMap())
 	tmpl = tmpl.Funcs(TemplateFuncMap(tmpl)).
+		Funcs(Applier{}.lookupFuncMap()).
+		Funcs(Applier{}.decryptFuncMap()).
+		Funcs(filesFuncMap(asset.NewMemFSReader(), templateName)).
 		Funcs(sprig.TxtFuncMap())
 	if customFuncMap != nil {
 		tmpl = tmpl.Funcs(customFuncMap)
@@ -427,9 +627,8 @@ func (a Applier) MustTemplateAssets(reader asset.ScenarioReader,
 	values interface{},
 	headerFile string,
 	files ...string) ([]string, error) {
-	var err error
-	var memFSReader asset.ScenarioReader
-	memFSReader, files, err = getFiles(reader, files, headerFile)
+	// The files are rendered and split in documents
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
 	if err != nil {
 		return nil, err
 	}
@@ -461,7 +660,8 @@ func (a Applier) MustTemplateAssets(reader asset.ScenarioReader,
 }
 
 // MustTemplateAsset generates textual output for a template file name.
-// The headerfile will be added to each file.
+// The partials added with WithPartials, the headerfile, the headers added with WithHeaders
+// and the partials found in the files will be added to each file.
 // Usually it contains nested template definitions as described
 // https://golang.org/pkg/text/template/#hdr-Nested_template_definitions
 // This allows to add functions which can be use in each file.
@@ -469,7 +669,107 @@ func (a Applier) MustTemplateAssets(reader asset.ScenarioReader,
 func (a Applier) MustTemplateAsset(reader asset.ScenarioReader,
 	values interface{},
 	headerFile, name string) ([]byte, error) {
-	tmpl := getTemplate(name, a.templateFuncMap)
+	// The documents returned by renderFiles are already rendered
+	if _, ok := a.renderCache.documentsReader(reader); ok {
+		return reader.Asset(name)
+	}
+	documents, err := a.renderDocuments(reader, values, headerFile, name)
+	if err != nil {
+		return nil, err
+	}
+	documents, err = a.finalizeDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("asset %s becomes %s", name, helpers.ErrorEmptyAssetAfterTemplating)
+	}
+	out := make([]byte, 0)
+	for k, document := range documents {
+		out = append(out, document.Content...)
+		if k == len(documents)-1 {
+			break
+		}
+		out = append(out, []byte("\n---\n")...)
+	}
+	return out, nil
+}
+
+//finalizeDocuments runs the exec post-renderer on all the rendered documents at once and overrides
+//the images it writes, then checks their apiVersions, validates them and checks them against the policy.
+//The rendered documents go through it whether they are rendered from files, from a chart or from a single asset.
+func (a Applier) finalizeDocuments(documents []helpers.Document) ([]helpers.Document, error) {
+	documents, err := a.runExecPostRenderer(documents)
+	if err != nil {
+		return nil, err
+	}
+	documents, err = a.overrideDocumentImages(documents)
+	if err != nil {
+		return nil, err
+	}
+	documents, err = a.checkAPIVersions(documents)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.validateDocuments(documents); err != nil {
+		return nil, err
+	}
+	if err := a.checkPolicy(documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+//renderDocuments renders the template and splits the result in documents,
+//the owner reference is added to each document, the patches are applied and the post-renderers are called.
+//A kustomization file is built with kustomize instead of being rendered.
+func (a Applier) renderDocuments(reader asset.ScenarioReader,
+	values interface{},
+	headerFile, name string) ([]helpers.Document, error) {
+	var documents []helpers.Document
+	var err error
+	if asset.IsKustomization(name) {
+		documents, err = a.buildKustomization(reader, name)
+	} else {
+		documents, err = a.renderTemplate(reader, values, headerFile, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.processDocuments(name, documents)
+}
+
+//processDocuments adds the owner reference to the rendered documents of a file,
+//applies the patches and calls the post-renderers.
+func (a Applier) processDocuments(name string, documents []helpers.Document) ([]helpers.Document, error) {
+	var err error
+	//If the content is empty after rendering then returns an ErrorEmptyAssetAfterTemplating error.
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("asset %s becomes %s", name, helpers.ErrorEmptyAssetAfterTemplating)
+	}
+
+	if a.owner != nil {
+		for i := range documents {
+			documents[i].Content, err = a.addOwnerRef(documents[i].Content)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", documents[i].Name, err)
+			}
+		}
+	}
+	documents, err = a.postRenderDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("asset %s becomes %s", name, helpers.ErrorEmptyAssetAfterTemplating)
+	}
+	return documents, nil
+}
+
+//renderTemplate renders the template with the header and the partials and splits the result in documents
+func (a Applier) renderTemplate(reader asset.ScenarioReader,
+	values interface{},
+	headerFile, name string) ([]helpers.Document, error) {
 	h := []byte{}
 	var err error
 	if headerFile != "" {
@@ -478,91 +778,139 @@ func (a Applier) MustTemplateAsset(reader asset.ScenarioReader,
 			return nil, err
 		}
 	}
-	hasMultipleAssets, err := helpers.HasMultipleAssets(reader, name)
+	b, err := reader.Asset(name)
 	if err != nil {
 		return nil, err
 	}
-	if hasMultipleAssets {
-		memFSReader, files, err := getFiles(reader, []string{name}, headerFile)
+	sources := [][]byte{h}
+	for _, header := range a.headers {
+		headerSources, err := header.sources()
 		if err != nil {
 			return nil, err
 		}
-
-		rendered, err := a.MustTemplateAssets(memFSReader, values, headerFile, files...)
+		sources = append(sources, headerSources...)
+	}
+	for _, partial := range a.partials {
+		p, err := reader.Asset(partial)
 		if err != nil {
 			return nil, err
 		}
-		out := make([]byte, 0)
-		for k, r := range rendered {
-			out = append(out, []byte(r)...)
-			if k == len(rendered)-1 {
-				break
-			}
-			out = append(out, []byte("\n---\n")...)
+		sources = append(sources, p)
+	}
+	sources = append(sources, b)
+	key := templateKey(name, sources...)
+	rendered, ok := a.renderCache.get(key)
+	if !ok {
+		tmplParsed, err := a.compileTemplate(key, name, sources...)
+		if err != nil {
+			return nil, err
+		}
+		tmplParsed, err = a.bindFiles(tmplParsed, reader, name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := a.templateData(reader, values, name)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = tmplParsed.Execute(&buf, data)
+		if err != nil {
+			return nil, err
 		}
-		return []byte(out), nil
+		rendered = buf.Bytes()
+		a.renderCache.set(key, rendered)
 	}
-	b, err := reader.Asset(name)
+
+	documents, err := helpers.SplitFile(name, rendered)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%q: %v", name, err)
 	}
-	var buf bytes.Buffer
-	tmplParsed, err := tmpl.Parse(string(h))
+	return documents, nil
+}
+
+//addOwnerRef adds the owner reference to the document
+func (a Applier) addOwnerRef(b []byte) ([]byte, error) {
+	unstructuredObj := &unstructured.Unstructured{}
+	j, err := asset.ToJSON(b)
 	if err != nil {
 		return nil, err
 	}
-	tmplParsed, err = tmplParsed.Parse(string(b))
+
+	err = unstructuredObj.UnmarshalJSON(j)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tmplParsed.Execute(&buf, values)
+	unstructuredObjOwnerRef := unstructuredObj.GetOwnerReferences()
+	ownerRef, err := a.generateOwnerRef()
 	if err != nil {
 		return nil, err
 	}
 
-	//If the content is empty after rendering then returns an ErrorEmptyAssetAfterTemplating error.
-	if helpers.IsEmpty(buf.Bytes()) {
-		return nil, fmt.Errorf("asset %s becomes %s", name, helpers.ErrorEmptyAssetAfterTemplating)
-	}
+	var modified bool
+	resourcemerge.MergeOwnerRefs(&modified,
+		&unstructuredObjOwnerRef,
+		[]metav1.OwnerReference{ownerRef})
 
-	if a.owner != nil {
-		unstructuredObj := &unstructured.Unstructured{}
-		j, err := yaml.YAMLToJSON(buf.Bytes())
-		if err != nil {
-			return nil, err
-		}
+	if !modified {
+		return b, nil
+	}
+	unstructuredObj.SetOwnerReferences(unstructuredObjOwnerRef)
+	// The format of the document is preserved
+	return marshalDocument(unstructuredObj, b)
+}
 
-		err = unstructuredObj.UnmarshalJSON(j)
-		if err != nil {
+//compileTemplate returns the template named name parsed from the sources,
+//the compiled template is retrieved from the cache if it was already parsed.
+func (a Applier) compileTemplate(key, name string, sources ...[]byte) (*template.Template, error) {
+	// The lookup function is bound to the applier clients and dry-run mode
+	if !a.lookupEnabled() {
+		key = "no-lookup/" + key
+	}
+	if tmpl, ok := a.templateCache.get(key); ok {
+		return tmpl, nil
+	}
+	tmpl := getTemplate(name, a.templateFuncMap)
+	if _, ok := a.templateFuncMap["lookup"]; !ok {
+		tmpl = tmpl.Funcs(a.lookupFuncMap())
+	}
+	if _, ok := a.templateFuncMap["decrypt"]; !ok {
+		tmpl = tmpl.Funcs(a.decryptFuncMap())
+	}
+	for _, library := range a.libraries {
+		if err := library.addParseTrees(tmpl, a.templateFuncMap); err != nil {
 			return nil, err
 		}
-
-		unstructuredObjOwnerRef := unstructuredObj.GetOwnerReferences()
-		ownerRef, err := a.generateOwnerRef()
+	}
+	for _, source := range sources {
+		var err error
+		tmpl, err = tmpl.Parse(string(source))
 		if err != nil {
 			return nil, err
 		}
+	}
+	a.templateCache.set(key, tmpl)
+	return tmpl, nil
+}
 
-		var modified bool
-		resourcemerge.MergeOwnerRefs(&modified,
-			&unstructuredObjOwnerRef,
-			[]metav1.OwnerReference{ownerRef})
-
-		if modified {
-			unstructuredObj.SetOwnerReferences(unstructuredObjOwnerRef)
-			j, err := unstructuredObj.MarshalJSON()
-			if err != nil {
-				return nil, err
-			}
-			y, err := yaml.JSONToYAML(j)
-			if err != nil {
-				return nil, err
-			}
-			buf = *bytes.NewBuffer(y)
+//bindFiles returns a copy of the compiled template where the "files" function reads the files of the reader,
+//the compiled templates are shared by the readers so the function is bound for each rendering.
+func (a Applier) bindFiles(tmpl *template.Template, reader asset.ScenarioReader, name string) (*template.Template, error) {
+	if _, ok := a.templateFuncMap["files"]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// include and tpl must execute the copy to see the bound function
+	for k, f := range TemplateFuncMap(tmpl) {
+		if _, ok := a.templateFuncMap[k]; !ok {
+			tmpl = tmpl.Funcs(template.FuncMap{k: f})
 		}
 	}
-	return buf.Bytes(), nil
+	return tmpl.Funcs(filesFuncMap(reader, name)), nil
 }
 
 func (a Applier) generateOwnerRef() (ownerRef metav1.OwnerReference, err error) {
@@ -2,13 +2,25 @@
 package apply
 
 import (
+	"bytes"
 	"reflect"
+	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/sops"
 	"github.com/stolostron/applier/test/unit/resources/scenario"
 
+	"filippo.io/age"
+	"filippo.io/age/armor"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
 )
 
 func TestMustTemplateAsset(t *testing.T) {
@@ -99,6 +111,507 @@ spec:
 	}
 }
 
+func TestMustTemplateAssets(t *testing.T) {
+	type args struct {
+		files      []string
+		headerFile string
+		reader     asset.ScenarioReader
+		values     interface{}
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "success with partials",
+			args: args{
+				files:  []string{"partials"},
+				reader: scenario.GetScenarioResourcesReader(),
+				values: map[string]string{"Name": "my-name", "Namespace": "my-ns"},
+			},
+			want: []string{`# Copyright Red Hat
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-name
+  namespace: my-ns
+  labels:
+    app: my-name
+data:
+  key: value
+`},
+			wantErr: false,
+		},
+	}
+	ab := NewApplierBuilder()
+	a := ab.Build()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.MustTemplateAssets(tt.args.reader, tt.args.values, tt.args.headerFile, tt.args.files...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateAssets() = \n<EOF>%v</EOF>\n, want \n<EOF>%v</EOF>", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_WithPartials(t *testing.T) {
+	type args struct {
+		partials []string
+		files    []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "header as partial",
+			args: args{
+				partials: []string{"musttemplateasset/header.txt"},
+				files:    []string{"musttemplateasset/body_for_header.txt"},
+			},
+			want: []string{`apiVersion: example.com/v1
+kind: SampleCustomResource
+metadata:
+  name: "my-sample"
+spec:
+  data: hello
+`},
+			wantErr: false,
+		},
+		{
+			name: "partials directory",
+			args: args{
+				partials: []string{"musttemplateasset/header.txt", "partials"},
+				files:    []string{"partials/configmap.yaml"},
+			},
+			want: []string{`# Copyright Red Hat
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-name
+  namespace: my-ns
+  labels:
+    app: my-name
+data:
+  key: value
+`},
+			wantErr: false,
+		},
+		{
+			name: "missing partial",
+			args: args{
+				partials: []string{"musttemplateasset/header.txt"},
+				files:    []string{"partials/configmap.yaml"},
+			},
+			wantErr: true,
+		},
+	}
+	reader := scenario.GetScenarioResourcesReader()
+	values := map[string]string{"Name": "my-name", "Namespace": "my-ns"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApplierBuilder().WithPartials(reader, tt.args.partials...).Build()
+			got, err := a.MustTemplateAssets(reader, values, "", tt.args.files...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateAssets() = \n<EOF>%v</EOF>\n, want \n<EOF>%v</EOF>", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_WithHeaders(t *testing.T) {
+	headers := asset.NewMemFSReader()
+	headers.AddAsset("name.txt", []byte(`{{ define "name" }}{{ .Name }}{{ end }}`))
+	headers.AddAsset("labels.txt", []byte(`{{ define "labels" }}app: {{ template "name" . }}{{ end }}`))
+	headers.AddAsset("override.txt", []byte(`{{ define "name" }}override{{ end }}`))
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ template "name" . }}
+  labels:
+    {{ template "labels" . }}
+`))
+	tests := []struct {
+		name    string
+		headers []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "headers",
+			headers: []string{"name.txt", "labels.txt"},
+			want:    []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-name\n  labels:\n    app: my-name\n"},
+		},
+		{
+			name:    "last header wins",
+			headers: []string{"name.txt", "labels.txt", "override.txt"},
+			want:    []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: override\n  labels:\n    app: override\n"},
+		},
+		{
+			name:    "missing header",
+			headers: []string{"name.txt", "missing.txt"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApplierBuilder().WithHeaders(headers, tt.headers...).Build()
+			got, err := a.MustTemplateAssets(reader, map[string]string{"Name": "my-name"}, "", "configmap.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateAssets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_RenderOnce(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ count "configmap" }}
+`))
+	reader.AddAsset("namespace.yaml", []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ count "namespace" }}
+`))
+	renders := make(map[string]int)
+	a := NewApplierBuilder().
+		WithTemplateFuncMap(template.FuncMap{
+			"count": func(name string) string {
+				renders[name]++
+				return name
+			},
+		}).
+		Build()
+	got, err := a.MustTemplateAssets(reader, nil, "", "configmap.yaml", "namespace.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("MustTemplateAssets() returned %d assets, want 2", len(got))
+	}
+	// The sort pass and the render pass share the rendered templates
+	want := map[string]int{"configmap": 1, "namespace": 1}
+	if !reflect.DeepEqual(renders, want) {
+		t.Errorf("renders = %v, want %v", renders, want)
+	}
+	// The compiled templates are kept between calls but the rendering is done again
+	// as the values can be different.
+	_, err = a.MustTemplateAssets(reader, nil, "", "configmap.yaml", "namespace.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	want = map[string]int{"configmap": 2, "namespace": 2}
+	if !reflect.DeepEqual(renders, want) {
+		t.Errorf("renders = %v, want %v", renders, want)
+	}
+	if len(a.templateCache.templates) != 2 {
+		t.Errorf("templateCache contains %d templates, want 2", len(a.templateCache.templates))
+	}
+	// A template is compiled again when its content changes
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ count "configmap" }}-changed
+`))
+	got, err = a.MustTemplateAssets(reader, nil, "", "configmap.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(got) != 1 || !strings.Contains(got[0], "configmap-changed") {
+		t.Errorf("MustTemplateAssets() = %v, want the changed configmap", got)
+	}
+	if len(a.templateCache.templates) != 3 {
+		t.Errorf("templateCache contains %d templates, want 3", len(a.templateCache.templates))
+	}
+}
+
+func TestApplier_RenderThenSplit(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("tenants.yaml", []byte(`{{- range .Tenants }}
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ . }}
+{{- end }}
+`))
+	reader.AddAsset("list.yaml", []byte(`apiVersion: v1
+kind: List
+items:
+{{- range .Tenants }}
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: sa
+    namespace: {{ . }}
+{{- end }}
+`))
+	values := map[string]interface{}{"Tenants": []string{"t1", "t2"}}
+	a := NewApplierBuilder().Build()
+	_, _, names, err := a.renderFiles(reader, values, "", []string{"tenants.yaml", "list.yaml"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	wantNames := []string{"tenants.yaml#0", "tenants.yaml#1", "list.yaml#0.0", "list.yaml#0.1"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("renderFiles() names = %v, want %v", names, wantNames)
+	}
+	got, err := a.MustTemplateAssets(reader, values, "", "list.yaml", "tenants.yaml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []string{`apiVersion: v1
+kind: Namespace
+metadata:
+  name: t1
+`, `apiVersion: v1
+kind: Namespace
+metadata:
+  name: t2
+`, `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: sa
+  namespace: t1
+`, `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: sa
+  namespace: t2
+`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+	}
+	// No object is rendered if the range is empty
+	got, err = a.MustTemplateAssets(reader, map[string]interface{}{}, "", "tenants.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("MustTemplateAssets() = %q, want no object", got)
+	}
+}
+
+func TestApplier_JSONTemplates(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("array.json", []byte(`[
+{{- range $i, $tenant := .Tenants }}
+{{- if $i }},{{ end }}
+	{
+		"apiVersion": "v1",
+		"kind": "ServiceAccount",
+		"metadata": {"name": "sa", "namespace": "{{ $tenant }}"}
+	}
+{{- end }}
+]`))
+	reader.AddAsset("list.json", []byte(`{
+	"apiVersion": "v1",
+	"kind": "List",
+	"items": [{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "{{ .Namespace }}"}}]
+}`))
+	values := map[string]interface{}{"Tenants": []string{"t1", "t2"}, "Namespace": "ns"}
+	a := NewApplierBuilder().Build()
+	// The objects are sorted on their kind, the namespace first
+	got, err := a.MustTemplateAssets(reader, values, "", "array.json", "list.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []string{
+		"{\n  \"apiVersion\": \"v1\",\n  \"kind\": \"Namespace\",\n  \"metadata\": {\n    \"name\": \"ns\"\n  }\n}",
+		"{\n\t\t\"apiVersion\": \"v1\",\n\t\t\"kind\": \"ServiceAccount\",\n\t\t\"metadata\": {\"name\": \"sa\", \"namespace\": \"t1\"}\n\t}",
+		"{\n\t\t\"apiVersion\": \"v1\",\n\t\t\"kind\": \"ServiceAccount\",\n\t\t\"metadata\": {\"name\": \"sa\", \"namespace\": \"t2\"}\n\t}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+	}
+}
+
+func TestApplier_Lookup(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "my-secret", "namespace": "my-ns"},
+		"data":       map[string]interface{}{"password": "cGFzc3dvcmQ="},
+	}}
+	kubeClient := kubefake.NewSimpleClientset()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "secrets", Kind: "Secret", Namespaced: true}},
+		},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), secret)
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("secret.yaml", []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret
+  namespace: my-ns
+data:
+{{- $secret := lookup "v1" "Secret" "my-ns" "my-secret" }}
+{{- if $secret }}
+  password: {{ $secret.data.password }}
+{{- else }}
+  password: {{ "generated" | b64enc }}
+{{- end }}
+  count: {{ (lookup "v1" "Secret" "my-ns" "").items | default list | len | toString | b64enc }}
+`))
+	tests := []struct {
+		name    string
+		applier Applier
+		dryRun  bool
+		want    string
+	}{
+		{
+			name:    "existing secret",
+			applier: NewApplierBuilder().WithClient(kubeClient, nil, dynamicClient).Build(),
+			want:    "  password: cGFzc3dvcmQ=\n  count: MQ==\n",
+		},
+		{
+			name:    "dry-run",
+			applier: NewApplierBuilder().WithClient(kubeClient, nil, dynamicClient).Build(),
+			dryRun:  true,
+			want:    "  password: Z2VuZXJhdGVk\n  count: MA==\n",
+		},
+		{
+			name:    "no client",
+			applier: NewApplierBuilder().Build(),
+			want:    "  password: Z2VuZXJhdGVk\n  count: MA==\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var err error
+			if tt.dryRun {
+				got, err = tt.applier.ApplyDirectly(reader, nil, true, "", "secret.yaml")
+			} else {
+				got, err = tt.applier.MustTemplateAssets(reader, nil, "", "secret.yaml")
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(got) != 1 || !strings.HasSuffix(got[0], tt.want) {
+				t.Errorf("got %q, want suffix %q", got, tt.want)
+			}
+		})
+	}
+
+	// The kinds are discovered once per applier
+	kubeClient.ClearActions()
+	a := NewApplierBuilder().WithClient(kubeClient, nil, dynamicClient).Build()
+	for i := 0; i < 2; i++ {
+		if _, err := a.MustTemplateAssets(reader, nil, "", "secret.yaml"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	discoveries := 0
+	for _, action := range kubeClient.Actions() {
+		if action.GetResource().Resource == "group" {
+			discoveries++
+		}
+	}
+	if discoveries != 1 {
+		t.Errorf("Expected the kinds to be discovered once got %d discoveries", discoveries)
+	}
+}
+
+func TestApplier_Decrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armorWriter, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("my-password")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{"Password": buf.String()}
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("secret.yaml", []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret
+data:
+  password: {{ .Password | decrypt | b64enc }}
+`))
+	withoutKeys := NewApplierBuilder().Build()
+	tests := []struct {
+		name    string
+		applier Applier
+		wantErr bool
+	}{
+		{
+			name:    "builder decrypter",
+			applier: NewApplierBuilder().WithDecrypter(sops.NewDecrypter(identity)).Build(),
+		},
+		{
+			name:    "applier decrypter",
+			applier: withoutKeys.WithDecrypter(sops.NewDecrypter(identity)),
+		},
+		{
+			name:    "no keys",
+			applier: withoutKeys,
+			wantErr: true,
+		},
+	}
+	// The template is compiled without the decrypter first
+	if _, err := withoutKeys.MustTemplateAssets(reader, values, "", "secret.yaml"); err == nil {
+		t.Fatal("decrypt must fail without keys")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.applier.MustTemplateAssets(reader, values, "", "secret.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			want := "  password: bXktcGFzc3dvcmQ=\n"
+			if len(got) != 1 || !strings.HasSuffix(got[0], want) {
+				t.Errorf("got %q, want suffix %q", got, want)
+			}
+		})
+	}
+}
+
 func TestApplier_Default_GetCache(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,185 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+//helmHookAnnotation is the annotation of the helm hooks
+const helmHookAnnotation = "helm.sh/hook"
+
+//ApplyChart renders a local helm chart, a chart directory or a packaged chart (.tgz), and applies
+//the rendered objects like Apply. The chart is rendered in-process without release, the release
+//is the one of WithTemplateContext or is named after the chart in the default namespace.
+//The CRDs of the crds directories are applied with the other objects and the test hooks are skipped.
+func (a Applier) ApplyChart(chartPath string, values map[string]interface{}, dryRun bool) ([]string, error) {
+	a.dryRun = dryRun
+	a, memFSReader, files, err := a.renderChart(chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+	return a.Apply(memFSReader, values, dryRun, "", files...)
+}
+
+//MustTemplateChart renders a local helm chart like ApplyChart and returns the rendered objects
+func (a Applier) MustTemplateChart(chartPath string, values map[string]interface{}) ([]string, error) {
+	a, memFSReader, files, err := a.renderChart(chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+	return a.MustTemplateAssets(memFSReader, values, "", files...)
+}
+
+//renderChart renders the chart and splits the rendered templates in documents stored in memory
+//like renderFiles, the documents are named after the chart templates and their index.
+func (a Applier) renderChart(chartPath string, values map[string]interface{}) (Applier, *asset.MemFS, []string, error) {
+	a = a.withRenderCache()
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return a, nil, nil, err
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	if err := chartutil.ProcessDependencies(chrt, values); err != nil {
+		return a, nil, nil, err
+	}
+	capabilities, err := a.chartCapabilities()
+	if err != nil {
+		return a, nil, nil, err
+	}
+	renderValues, err := chartutil.ToRenderValues(chrt, values, a.chartReleaseOptions(chrt), capabilities)
+	if err != nil {
+		return a, nil, nil, err
+	}
+	var rendered map[string]string
+	// The lookup function returns empty maps in dry-run or without client
+	if a.restConfig != nil && !a.dryRun {
+		rendered, err = engine.RenderWithClient(chrt, renderValues, a.restConfig)
+	} else {
+		rendered, err = engine.Render(chrt, renderValues)
+	}
+	if err != nil {
+		return a, nil, nil, err
+	}
+	// The CRDs are not templates and are added first like with helm
+	files := make([]helpers.Document, 0, len(rendered))
+	for _, crd := range chrt.CRDObjects() {
+		files = append(files, helpers.Document{Name: crd.Filename, Content: crd.File.Data})
+	}
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasSuffix(name, "NOTES.txt") || strings.HasPrefix(path.Base(name), "_") {
+			continue
+		}
+		files = append(files, helpers.Document{Name: name, Content: []byte(rendered[name])})
+	}
+	documents := make([]helpers.Document, 0, len(files))
+	for _, file := range files {
+		split, err := helpers.SplitFile(file.Name, file.Content)
+		if err != nil {
+			return a, nil, nil, fmt.Errorf("%q: %v", file.Name, err)
+		}
+		split, err = a.processDocuments(file.Name, withoutTestHooks(split))
+		if err != nil {
+			if helpers.IsEmptyAsset(err) {
+				continue
+			}
+			return a, nil, nil, err
+		}
+		documents = append(documents, split...)
+	}
+	documents, err = a.finalizeDocuments(documents)
+	if err != nil {
+		return a, nil, nil, err
+	}
+	memFSReader := asset.NewMemFSReader()
+	for _, document := range documents {
+		memFSReader.AddAsset(document.Name, document.Content)
+	}
+	names, err = memFSReader.FileNames()
+	if err != nil {
+		return a, nil, nil, err
+	}
+	a.renderCache.addDocumentsReader(memFSReader)
+	return a, memFSReader, names, nil
+}
+
+//chartReleaseOptions returns the release exposed as .Release to the chart templates
+func (a Applier) chartReleaseOptions(chrt *chart.Chart) chartutil.ReleaseOptions {
+	options := chartutil.ReleaseOptions{
+		Name:      chrt.Name(),
+		Namespace: "default",
+		Revision:  1,
+		IsInstall: true,
+	}
+	if a.release != nil {
+		if len(a.release.Name) != 0 {
+			options.Name = a.release.Name
+		}
+		if len(a.release.Namespace) != 0 {
+			options.Namespace = a.release.Namespace
+		}
+	}
+	return options
+}
+
+//chartCapabilities returns the capabilities of the applier as helm capabilities
+func (a Applier) chartCapabilities() (*chartutil.Capabilities, error) {
+	capabilities, err := a.getCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	chartCapabilities := chartutil.DefaultCapabilities.Copy()
+	chartCapabilities.KubeVersion = chartutil.KubeVersion{
+		Version: capabilities.KubeVersion.Version,
+		Major:   capabilities.KubeVersion.Major,
+		Minor:   capabilities.KubeVersion.Minor,
+	}
+	chartCapabilities.APIVersions = chartutil.VersionSet(capabilities.APIVersions)
+	return chartCapabilities, nil
+}
+
+//withoutTestHooks returns the documents which are not helm test hooks
+func withoutTestHooks(documents []helpers.Document) []helpers.Document {
+	kept := make([]helpers.Document, 0, len(documents))
+	for _, document := range documents {
+		u := struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal(document.Content, &u); err == nil && isTestHook(u.Metadata.Annotations[helmHookAnnotation]) {
+			continue
+		}
+		kept = append(kept, document)
+	}
+	return kept
+}
+
+//isTestHook returns true if one of the comma separated hooks is a helm test hook
+func isTestHook(hooks string) bool {
+	for _, hook := range strings.Split(hooks, ",") {
+		switch strings.TrimSpace(hook) {
+		case "test", "test-success", "test-failure":
+			return true
+		}
+	}
+	return false
+}
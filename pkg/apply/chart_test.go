@@ -0,0 +1,178 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testChart = "../../test/unit/resources/chart/my-chart"
+
+func TestApplier_MustTemplateChart(t *testing.T) {
+	chrt, err := loader.Load(testChart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagedChart, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		applier   Applier
+		chartPath string
+		values    map[string]interface{}
+		want      []string
+		wantImage string
+		wantErr   bool
+	}{
+		{
+			name:      "directory",
+			applier:   NewApplierBuilder().Build(),
+			chartPath: testChart,
+			want: []string{
+				"ConfigMap/default/my-chart-my-chart",
+				"CustomResourceDefinition//mycharts.example.com",
+				"Deployment/default/my-chart-my-chart",
+			},
+			wantImage: "my-image:1.0.0",
+		},
+		{
+			name:      "packaged chart with release and values",
+			applier:   NewApplierBuilder().WithTemplateContext(Release{Name: "my-release", Namespace: "my-ns"}).Build(),
+			chartPath: packagedChart,
+			values:    map[string]interface{}{"image": map[string]interface{}{"tag": "2.0.0"}},
+			want: []string{
+				"ConfigMap/my-ns/my-release-my-chart",
+				"CustomResourceDefinition//mycharts.example.com",
+				"Deployment/my-ns/my-release-my-chart",
+			},
+			wantImage: "my-image:2.0.0",
+		},
+		{
+			name:      "chart not found",
+			applier:   NewApplierBuilder().Build(),
+			chartPath: "chart-not-found",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.applier.MustTemplateChart(tt.chartPath, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateChart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(output))
+			for _, o := range output {
+				j, err := asset.ToJSON([]byte(o))
+				if err != nil {
+					t.Fatal(err)
+				}
+				u := &unstructured.Unstructured{}
+				if err := u.UnmarshalJSON(j); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, u.GetKind()+"/"+u.GetNamespace()+"/"+u.GetName())
+				if u.GetKind() == "Deployment" && !strings.Contains(o, tt.wantImage) {
+					t.Errorf("Expected the image %s got %s", tt.wantImage, o)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateChart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_ApplyChart(t *testing.T) {
+	kc := kubefake.NewSimpleClientset()
+	kc.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true}}},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}}},
+	}
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+			{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+		})
+	a := NewApplierBuilder().WithClient(kc, apiextensionsfake.NewSimpleClientset(), dc).Build()
+	out, err := a.ApplyChart(testChart, map[string]interface{}{"config": map[string]interface{}{"log": "debug"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("got %d outputs: %v", len(out), out)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("default").Get(context.TODO(), "my-chart-my-chart", metav1.GetOptions{}); err == nil {
+		t.Fatal("the chart must not be applied in dry-run")
+	}
+	// The CRDs of the chart are removed as the fake client doesn't serve them
+	chrt, err := loader.Load(testChart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := chrt.Files[:0]
+	for _, f := range chrt.Files {
+		if !strings.HasPrefix(f.Name, "crds/") {
+			files = append(files, f)
+		}
+	}
+	chrt.Files = files
+	packagedChart, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ApplyChart(packagedChart, map[string]interface{}{"config": map[string]interface{}{"log": "debug"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := kc.CoreV1().ConfigMaps("default").Get(context.TODO(), "my-chart-my-chart", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["log"] != "debug" {
+		t.Errorf("Expected log: debug got %v", cm.Data)
+	}
+	if _, err := kc.AppsV1().Deployments("default").Get(context.TODO(), "my-chart-my-chart", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsTestHook(t *testing.T) {
+	tests := []struct {
+		hooks string
+		want  bool
+	}{
+		{hooks: "test", want: true},
+		{hooks: "test-success", want: true},
+		{hooks: "pre-install, test-failure", want: true},
+		{hooks: "pre-install,post-upgrade", want: false},
+		{hooks: "post-install-latest", want: false},
+		{hooks: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hooks, func(t *testing.T) {
+			if got := isTestHook(tt.hooks); got != tt.want {
+				t.Errorf("isTestHook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
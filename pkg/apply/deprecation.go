@@ -0,0 +1,247 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+//DeprecatedAPI is an apiVersion of a kind deprecated and then removed from Kubernetes
+type DeprecatedAPI struct {
+	APIVersion string
+	Kind       string
+	//DeprecatedIn and RemovedIn are the Kubernetes minor versions, for example 1.16
+	DeprecatedIn string
+	RemovedIn    string
+	//Replacement is the apiVersion to use instead, empty if the kind is removed
+	Replacement string
+	//Convertible is true if the object is converted by setting the replacement apiVersion,
+	//the schema of the kind is the same in both apiVersions
+	Convertible bool
+}
+
+//DeprecatedAPIs are the deprecated apiVersions of the built-in kinds
+var DeprecatedAPIs = []DeprecatedAPI{
+	{APIVersion: "extensions/v1beta1", Kind: "DaemonSet", DeprecatedIn: "1.8", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "extensions/v1beta1", Kind: "Deployment", DeprecatedIn: "1.8", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "extensions/v1beta1", Kind: "ReplicaSet", DeprecatedIn: "1.8", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "extensions/v1beta1", Kind: "NetworkPolicy", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "extensions/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.10", RemovedIn: "1.16", Replacement: "policy/v1beta1"},
+	{APIVersion: "extensions/v1beta1", Kind: "Ingress", DeprecatedIn: "1.14", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "apps/v1beta1", Kind: "Deployment", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta1", Kind: "StatefulSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta1", Kind: "ControllerRevision", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kind: "DaemonSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kind: "Deployment", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kind: "ReplicaSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kind: "StatefulSet", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kind: "ControllerRevision", DeprecatedIn: "1.9", RemovedIn: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "scheduling.k8s.io/v1beta1", Kind: "PriorityClass", DeprecatedIn: "1.14", RemovedIn: "1.22", Replacement: "scheduling.k8s.io/v1", Convertible: true},
+	{APIVersion: "apiextensions.k8s.io/v1beta1", Kind: "CustomResourceDefinition", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "apiextensions.k8s.io/v1"},
+	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "MutatingWebhookConfiguration", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1"},
+	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kind: "ValidatingWebhookConfiguration", DeprecatedIn: "1.16", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1"},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRole", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1", Convertible: true},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "ClusterRoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1", Convertible: true},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "Role", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1", Convertible: true},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kind: "RoleBinding", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1", Convertible: true},
+	{APIVersion: "apiregistration.k8s.io/v1beta1", Kind: "APIService", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "apiregistration.k8s.io/v1", Convertible: true},
+	{APIVersion: "certificates.k8s.io/v1beta1", Kind: "CertificateSigningRequest", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "certificates.k8s.io/v1"},
+	{APIVersion: "coordination.k8s.io/v1beta1", Kind: "Lease", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "coordination.k8s.io/v1", Convertible: true},
+	{APIVersion: "networking.k8s.io/v1beta1", Kind: "Ingress", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "networking.k8s.io/v1beta1", Kind: "IngressClass", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "CSIDriver", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1", Convertible: true},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "CSINode", DeprecatedIn: "1.17", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1"},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "StorageClass", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1", Convertible: true},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "VolumeAttachment", DeprecatedIn: "1.19", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1", Convertible: true},
+	{APIVersion: "batch/v1beta1", Kind: "CronJob", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "batch/v1", Convertible: true},
+	{APIVersion: "discovery.k8s.io/v1beta1", Kind: "EndpointSlice", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "discovery.k8s.io/v1"},
+	{APIVersion: "events.k8s.io/v1beta1", Kind: "Event", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "events.k8s.io/v1", Convertible: true},
+	{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "policy/v1", Convertible: true},
+	{APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.21", RemovedIn: "1.25"},
+	{APIVersion: "node.k8s.io/v1beta1", Kind: "RuntimeClass", DeprecatedIn: "1.20", RemovedIn: "1.25", Replacement: "node.k8s.io/v1", Convertible: true},
+	{APIVersion: "autoscaling/v2beta1", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.22", RemovedIn: "1.25", Replacement: "autoscaling/v2"},
+	{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "autoscaling/v2", Convertible: true},
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta1", Kind: "FlowSchema", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "flowcontrol.apiserver.k8s.io/v1beta2", Convertible: true},
+	{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta1", Kind: "PriorityLevelConfiguration", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "flowcontrol.apiserver.k8s.io/v1beta2", Convertible: true},
+	{APIVersion: "storage.k8s.io/v1beta1", Kind: "CSIStorageCapacity", DeprecatedIn: "1.24", RemovedIn: "1.27", Replacement: "storage.k8s.io/v1", Convertible: true},
+}
+
+//FindDeprecatedAPI returns the deprecation of the apiVersion of the kind
+func FindDeprecatedAPI(apiVersion, kind string) (DeprecatedAPI, bool) {
+	for _, deprecatedAPI := range DeprecatedAPIs {
+		if deprecatedAPI.APIVersion == apiVersion && deprecatedAPI.Kind == kind {
+			return deprecatedAPI, true
+		}
+	}
+	return DeprecatedAPI{}, false
+}
+
+//Message returns the description of the deprecation
+func (d DeprecatedAPI) Message() string {
+	message := d.APIVersion + " " + d.Kind + " is deprecated since Kubernetes " + d.DeprecatedIn + " and removed in " + d.RemovedIn
+	if len(d.Replacement) == 0 {
+		return message + " without replacement"
+	}
+	return message + ", use " + d.Replacement
+}
+
+//notConvertedReason returns why an object of the deprecated apiVersion is not converted to its replacement
+func (d DeprecatedAPI) notConvertedReason() string {
+	if len(d.Replacement) == 0 {
+		return "it is not converted as there is no replacement"
+	}
+	return "it is not converted as the schema of " + d.Replacement + " " + d.Kind + " differs, the object must be migrated"
+}
+
+//APIVersionChecker checks the apiVersions of the rendered objects against the deprecations
+//of a Kubernetes version. The objects using an apiVersion removed in the version are errors,
+//the ones using a deprecated apiVersion are logged as warnings. With the conversion, the objects
+//of a convertible deprecated apiVersion are converted to its replacement.
+type APIVersionChecker struct {
+	kubeVersion KubeVersion
+	convert     bool
+}
+
+//NewAPIVersionChecker returns a checker for a Kubernetes version such as v1.25.3 or 1.25
+func NewAPIVersionChecker(kubeVersion string, convert bool) (*APIVersionChecker, error) {
+	kv, err := parseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &APIVersionChecker{
+		kubeVersion: kv,
+		convert:     convert,
+	}, nil
+}
+
+//NewAPIVersionCheckerFromDiscovery returns a checker for the Kubernetes version of a cluster
+func NewAPIVersionCheckerFromDiscovery(client discovery.ServerVersionInterface, convert bool) (*APIVersionChecker, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	// Some distributions have a minor version such as 25+
+	kubeVersion := strings.TrimRight(info.Major, "+") + "." + strings.TrimRight(info.Minor, "+")
+	return NewAPIVersionChecker(kubeVersion, convert)
+}
+
+//KubeVersion returns the checked Kubernetes version
+func (c *APIVersionChecker) KubeVersion() string {
+	return c.kubeVersion.Version
+}
+
+//RemovedAPIVersionError is a rendered object using an apiVersion removed in the checked Kubernetes version
+type RemovedAPIVersionError struct {
+	//Document is the name of the rendered document, for example file.yaml#1
+	Document      string
+	Kind          string
+	Name          string
+	DeprecatedAPI DeprecatedAPI
+	KubeVersion   string
+	//NotConverted is true if the conversion was enabled but the apiVersion is not convertible
+	NotConverted bool
+}
+
+//File returns the source file of the document
+func (e RemovedAPIVersionError) File() string {
+	return helpers.SourceFile(e.Document)
+}
+
+func (e RemovedAPIVersionError) Error() string {
+	message := fmt.Sprintf("%s: %s %s: %s, the target version is %s", e.Document, e.Kind, e.Name, e.DeprecatedAPI.Message(), e.KubeVersion)
+	if e.NotConverted {
+		message += ", " + e.DeprecatedAPI.notConvertedReason()
+	}
+	return message
+}
+
+//RemovedAPIVersionErrors are the rendered objects using a removed apiVersion
+type RemovedAPIVersionErrors []RemovedAPIVersionError
+
+func (e RemovedAPIVersionErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, removed := range e {
+		messages[i] = removed.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+//Check returns the documents with the converted objects, the error is a RemovedAPIVersionErrors
+//if objects use a removed apiVersion which is not converted.
+func (c *APIVersionChecker) Check(documents []helpers.Document) ([]helpers.Document, error) {
+	checked := make([]helpers.Document, 0, len(documents))
+	removedErrors := make(RemovedAPIVersionErrors, 0)
+	for _, document := range documents {
+		u, err := documentToUnstructured(document.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", document.Name, err)
+		}
+		deprecatedAPI, ok := FindDeprecatedAPI(u.GetAPIVersion(), u.GetKind())
+		if !ok || !c.atLeast(deprecatedAPI.DeprecatedIn) {
+			checked = append(checked, document)
+			continue
+		}
+		switch {
+		case c.convert && deprecatedAPI.Convertible:
+			u.SetAPIVersion(deprecatedAPI.Replacement)
+			content, err := marshalDocument(u, document.Content)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", document.Name, err)
+			}
+			klog.Infof("%s: %s %s: converted from %s to %s", document.Name, u.GetKind(), u.GetName(), deprecatedAPI.APIVersion, deprecatedAPI.Replacement)
+			document = helpers.Document{Name: document.Name, Content: content}
+		case c.atLeast(deprecatedAPI.RemovedIn):
+			removedErrors = append(removedErrors, RemovedAPIVersionError{
+				Document:      document.Name,
+				Kind:          u.GetKind(),
+				Name:          u.GetName(),
+				DeprecatedAPI: deprecatedAPI,
+				KubeVersion:   c.kubeVersion.Version,
+				NotConverted:  c.convert,
+			})
+		case c.convert:
+			klog.Warningf("%s: %s %s: %s, %s", document.Name, u.GetKind(), u.GetName(), deprecatedAPI.Message(), deprecatedAPI.notConvertedReason())
+		default:
+			klog.Warningf("%s: %s %s: %s", document.Name, u.GetKind(), u.GetName(), deprecatedAPI.Message())
+		}
+		checked = append(checked, document)
+	}
+	if len(removedErrors) != 0 {
+		return nil, removedErrors
+	}
+	return checked, nil
+}
+
+//atLeast returns true if the checked Kubernetes version is at least the minor version such as 1.25
+func (c *APIVersionChecker) atLeast(version string) bool {
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	// The checked version is validated by parseKubeVersion
+	kubeMajor, _ := strconv.Atoi(c.kubeVersion.Major)
+	kubeMinor, _ := strconv.Atoi(c.kubeVersion.Minor)
+	return kubeMajor > major || (kubeMajor == major && kubeMinor >= minor)
+}
+
+//checkAPIVersions checks the apiVersions of the rendered documents with the checker of the applier
+func (a Applier) checkAPIVersions(documents []helpers.Document) ([]helpers.Document, error) {
+	if a.apiVersionChecker == nil {
+		return documents, nil
+	}
+	return a.apiVersionChecker.Check(documents)
+}
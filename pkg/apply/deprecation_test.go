@@ -0,0 +1,250 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplier_WithAPIVersionChecker(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("pdb.yaml", []byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: my-pdb
+  namespace: my-ns
+spec:
+  minAvailable: 1
+`))
+	reader.AddAsset("ingress.yaml", []byte(`apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: my-ingress
+  namespace: my-ns
+`))
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: my-deployment
+  namespace: my-ns
+`))
+	reader.AddAsset("crd.yaml", []byte(`apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+`))
+	tests := []struct {
+		name        string
+		kubeVersion string
+		convert     bool
+		files       []string
+		want        []string
+		wantRemoved []string
+		wantMessage string
+	}{
+		{
+			name:        "not deprecated",
+			kubeVersion: "v1.20.4",
+			files:       []string{"pdb.yaml"},
+			want:        []string{"policy/v1beta1"},
+		},
+		{
+			name:        "deprecated",
+			kubeVersion: "1.22",
+			files:       []string{"pdb.yaml"},
+			want:        []string{"policy/v1beta1"},
+		},
+		{
+			name:        "removed",
+			kubeVersion: "v1.25.0",
+			files:       []string{"pdb.yaml", "ingress.yaml"},
+			wantRemoved: []string{"pdb.yaml", "ingress.yaml"},
+		},
+		{
+			name:        "converted",
+			kubeVersion: "v1.25.0",
+			convert:     true,
+			files:       []string{"pdb.yaml"},
+			want:        []string{"policy/v1"},
+		},
+		{
+			name:        "converted deprecated",
+			kubeVersion: "v1.21.0",
+			convert:     true,
+			files:       []string{"pdb.yaml"},
+			want:        []string{"policy/v1"},
+		},
+		{
+			name:        "not convertible",
+			kubeVersion: "v1.25.0",
+			convert:     true,
+			files:       []string{"pdb.yaml", "ingress.yaml"},
+			wantRemoved: []string{"ingress.yaml"},
+			wantMessage: "it is not converted as the schema of networking.k8s.io/v1 Ingress differs",
+		},
+		{
+			name:        "not convertible deployment and crd",
+			kubeVersion: "v1.22.0",
+			convert:     true,
+			files:       []string{"deployment.yaml", "crd.yaml"},
+			wantRemoved: []string{"deployment.yaml", "crd.yaml"},
+			wantMessage: "it is not converted as the schema of apiextensions.k8s.io/v1 CustomResourceDefinition differs",
+		},
+		{
+			name:        "not convertible deprecated",
+			kubeVersion: "v1.21.0",
+			convert:     true,
+			files:       []string{"ingress.yaml"},
+			want:        []string{"extensions/v1beta1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewAPIVersionChecker(tt.kubeVersion, tt.convert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := NewApplierBuilder().WithAPIVersionChecker(checker).Build().
+				MustTemplateAssets(reader, map[string]interface{}{}, "", tt.files...)
+			if len(tt.wantRemoved) != 0 {
+				var removedErrors RemovedAPIVersionErrors
+				if !errors.As(err, &removedErrors) {
+					t.Fatalf("Expected a RemovedAPIVersionErrors error got %v", err)
+				}
+				documents := make([]string, len(removedErrors))
+				for i, removedError := range removedErrors {
+					documents[i] = removedError.Document
+				}
+				if !reflect.DeepEqual(documents, tt.wantRemoved) {
+					t.Errorf("Expected the removed apiVersions of %v got %v", tt.wantRemoved, documents)
+				}
+				if !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("Expected the error to contain %q got %v", tt.wantMessage, err)
+				}
+				if len(tt.wantMessage) == 0 && strings.Contains(err.Error(), "not converted") {
+					t.Errorf("Unexpected conversion message in %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			apiVersions := make([]string, len(output))
+			for i, o := range output {
+				u, err := documentToUnstructured([]byte(o))
+				if err != nil {
+					t.Fatal(err)
+				}
+				apiVersions[i] = u.GetAPIVersion()
+			}
+			if !reflect.DeepEqual(apiVersions, tt.want) {
+				t.Errorf("Expected the apiVersions %v got %v", tt.want, apiVersions)
+			}
+		})
+	}
+}
+
+func TestNewAPIVersionCheckerFromDiscovery(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	fakeDiscovery := kubeClient.Discovery().(*fakediscovery.FakeDiscovery)
+	fakeDiscovery.FakedServerVersion = &version.Info{GitVersion: "v1.25.3-eks-ba74326", Major: "1", Minor: "25+"}
+	checker, err := NewAPIVersionCheckerFromDiscovery(fakeDiscovery, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checker.KubeVersion() != "v1.25.0" {
+		t.Errorf("Expected the version v1.25.0 got %s", checker.KubeVersion())
+	}
+	if !checker.atLeast("1.25") || checker.atLeast("1.26") {
+		t.Errorf("Expected the version 1.25 to be at least 1.25 and not 1.26")
+	}
+}
+
+func TestNewAPIVersionChecker(t *testing.T) {
+	tests := []struct {
+		kubeVersion string
+		want        string
+		wantErr     bool
+	}{
+		{kubeVersion: "v1.25.3", want: "v1.25.3"},
+		{kubeVersion: "1.25", want: "v1.25.0"},
+		{kubeVersion: "1", wantErr: true},
+		{kubeVersion: "v1.x", wantErr: true},
+		{kubeVersion: "latest.25", wantErr: true},
+		{kubeVersion: "1.25+", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kubeVersion, func(t *testing.T) {
+			checker, err := NewAPIVersionChecker(tt.kubeVersion, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAPIVersionChecker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && checker.KubeVersion() != tt.want {
+				t.Errorf("Expected the version %s got %s", tt.want, checker.KubeVersion())
+			}
+		})
+	}
+}
+
+func TestRemovedAPIVersionError_Error(t *testing.T) {
+	deprecatedAPI, ok := FindDeprecatedAPI("policy/v1beta1", "PodDisruptionBudget")
+	if !ok {
+		t.Fatal("policy/v1beta1 PodDisruptionBudget must be deprecated")
+	}
+	err := RemovedAPIVersionError{
+		Document:      "pdb.yaml",
+		Kind:          "PodDisruptionBudget",
+		Name:          "my-pdb",
+		DeprecatedAPI: deprecatedAPI,
+		KubeVersion:   "v1.25.0",
+	}
+	if !strings.HasSuffix(err.Error(), "use policy/v1, the target version is v1.25.0") {
+		t.Errorf("Unexpected error message %s", err.Error())
+	}
+}
+
+func TestApplier_MustTemplateAssetAPIVersionChecker(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("pdb.yaml", []byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: my-pdb
+  namespace: my-ns
+spec:
+  minAvailable: 1
+`))
+	checker, err := NewAPIVersionChecker("v1.25.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewApplierBuilder().WithAPIVersionChecker(checker).Build().
+		MustTemplateAsset(reader, map[string]interface{}{}, "", "pdb.yaml")
+	var removedErrors RemovedAPIVersionErrors
+	if !errors.As(err, &removedErrors) {
+		t.Fatalf("Expected a RemovedAPIVersionErrors error got %v", err)
+	}
+	checker, err = NewAPIVersionChecker("v1.25.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewApplierBuilder().WithAPIVersionChecker(checker).Build().
+		MustTemplateAsset(reader, map[string]interface{}{}, "", "pdb.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := documentToUnstructured(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.GetAPIVersion() != "policy/v1" {
+		t.Errorf("Expected the apiVersion policy/v1 got %s", u.GetAPIVersion())
+	}
+}
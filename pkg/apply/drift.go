@@ -0,0 +1,406 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+//DriftedField is a field of a live object which is not the rendered one
+type DriftedField struct {
+	//Path is the path of the field, for example spec.template.spec.containers[0].image
+	Path string `json:"path"`
+	//Expected is the rendered value
+	Expected interface{} `json:"expected"`
+	//Actual is the live value, nil if the field is removed
+	Actual interface{} `json:"actual"`
+	//Managers are the managers of the live object owning the field, for example kubectl-edit
+	Managers []string `json:"managers,omitempty"`
+}
+
+//Drift is a live object which is not the rendered one
+type Drift struct {
+	//Document is the name of the rendered document, for example file.yaml#1
+	Document   string `json:"document"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	//Missing is true if the live object does not exist
+	Missing bool           `json:"missing,omitempty"`
+	Fields  []DriftedField `json:"fields,omitempty"`
+}
+
+//Strings returns the description of the drift, one line per drifted field
+func (d Drift) Strings() []string {
+	name := d.Name
+	if len(d.Namespace) != 0 {
+		name = d.Namespace + "/" + d.Name
+	}
+	prefix := fmt.Sprintf("%s: %s %s:", d.Document, d.Kind, name)
+	if d.Missing {
+		return []string{prefix + " the object does not exist"}
+	}
+	lines := make([]string, len(d.Fields))
+	for i, field := range d.Fields {
+		lines[i] = fmt.Sprintf("%s %s: expected %v, got %v", prefix, field.Path, formatValue(field.Expected), formatValue(field.Actual))
+		if len(field.Managers) != 0 {
+			lines[i] += fmt.Sprintf(" (managed by %s)", strings.Join(field.Managers, ", "))
+		}
+	}
+	return lines
+}
+
+//Drifts are the live objects which are not the rendered ones
+type Drifts []Drift
+
+//DetectDrift renders the files like MustTemplateAssets and compares the rendered objects with
+//the live objects. Only the fields of the rendered objects are compared and so the fields
+//defaulted or added by the cluster are ignored. The fields owned by other managers than the
+//field manager of the applier are ignored too, the drifted fields report the managers of
+//the live object owning them.
+func (a Applier) DetectDrift(reader asset.ScenarioReader,
+	values interface{},
+	headerFile string,
+	files ...string) (Drifts, error) {
+	if a.kubeClient == nil {
+		return nil, fmt.Errorf("missing kubeClient")
+	}
+	if a.dynamicClient == nil {
+		return nil, fmt.Errorf("missing dynamicClient")
+	}
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
+	if err != nil {
+		return nil, err
+	}
+	fieldManager := FieldManager(a.restConfig)
+	drifts := make(Drifts, 0)
+	for _, name := range files {
+		b, err := memFSReader.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		required, err := documentToUnstructured(b)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		gvk := required.GroupVersionKind()
+		mapping, err := a.restMapping(gvk)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		existing, err := a.getLiveObject(mapping.Resource, required)
+		switch {
+		case errors.IsNotFound(err):
+			existing = nil
+		case err != nil:
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		drift, err := DetectObjectDrift(name, fieldManager, required, existing)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+	return drifts, nil
+}
+
+//DetectObjectDrift compares a rendered object with its live object like DetectDrift, the fieldManager
+//is the manager of the fields updated by the applier and the existing object is nil if the live
+//object does not exist. It returns nil if the live object does not drift.
+func DetectObjectDrift(document, fieldManager string, required, existing *unstructured.Unstructured) (*Drift, error) {
+	drift := &Drift{
+		Document:   document,
+		APIVersion: required.GetAPIVersion(),
+		Kind:       required.GetKind(),
+		Namespace:  required.GetNamespace(),
+		Name:       required.GetName(),
+	}
+	if existing == nil {
+		drift.Missing = true
+		return drift, nil
+	}
+	fields, err := driftedFields(fieldManager, required, existing)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	drift.Fields = fields
+	return drift, nil
+}
+
+//FieldManager returns the manager of the fields updated by an applier using the rest config,
+//the API server names the manager after the user agent of the client as the applier updates
+//the objects without field manager.
+func FieldManager(cfg *rest.Config) string {
+	userAgent := rest.DefaultKubernetesUserAgent()
+	if cfg != nil && len(cfg.UserAgent) != 0 {
+		userAgent = cfg.UserAgent
+	}
+	return strings.Split(userAgent, "/")[0]
+}
+
+//getLiveObject returns the live object of the rendered object
+func (a Applier) getLiveObject(resource schema.GroupVersionResource, required *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	dr := a.dynamicClient.Resource(resource)
+	if len(required.GetNamespace()) == 0 {
+		return dr.Get(a.context, required.GetName(), metav1.GetOptions{})
+	}
+	return dr.Namespace(required.GetNamespace()).Get(a.context, required.GetName(), metav1.GetOptions{})
+}
+
+//driftedFields compares the fields of the rendered object with the live object, the fields
+//owned only by other managers than the field manager are not compared.
+func driftedFields(fieldManager string, required, existing *unstructured.Unstructured) ([]DriftedField, error) {
+	expected := required.DeepCopy().Object
+	// The status is not applied
+	delete(expected, "status")
+	// The stringData of the secrets is stored in their data
+	if required.GetKind() == "Secret" {
+		stringDataToData(expected)
+	}
+	managedFields, err := parseManagedFields(existing)
+	if err != nil {
+		return nil, err
+	}
+	c := &driftComparator{fieldManager: fieldManager, managedFields: managedFields}
+	c.compare("", fieldpath.Path{}, expected, existing.Object)
+	return c.drifted, nil
+}
+
+//stringDataToData moves the base64 encoded stringData of a secret to its data
+func stringDataToData(secret map[string]interface{}) {
+	stringData, ok := secret["stringData"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok {
+		data = make(map[string]interface{})
+	}
+	for k, v := range stringData {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+	}
+	secret["data"] = data
+	delete(secret, "stringData")
+}
+
+//managedFieldSet is the set of fields owned by a manager of the live object
+type managedFieldSet struct {
+	manager string
+	set     *fieldpath.Set
+}
+
+//parseManagedFields returns the field sets of the managers of the object
+func parseManagedFields(u *unstructured.Unstructured) ([]managedFieldSet, error) {
+	managedFields := make([]managedFieldSet, 0)
+	for _, entry := range u.GetManagedFields() {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		set := &fieldpath.Set{}
+		if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, fmt.Errorf("managedFields of %s: %v", entry.Manager, err)
+		}
+		managedFields = append(managedFields, managedFieldSet{manager: entry.Manager, set: set})
+	}
+	return managedFields, nil
+}
+
+//driftComparator records the drifted fields
+type driftComparator struct {
+	fieldManager  string
+	managedFields []managedFieldSet
+	drifted       []DriftedField
+}
+
+//compare compares the expected value with the actual value, the path is the
+//field path and the fieldPath is the path of the field in the managed fields.
+func (c *driftComparator) compare(path string, fieldPath fieldpath.Path, expected, actual interface{}) {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			c.addDrift(path, fieldPath, expected, actual)
+			return
+		}
+		keys := make([]string, 0, len(e))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := k
+			if len(path) != 0 {
+				childPath = path + "." + k
+			}
+			c.compare(childPath, append(copyPath(fieldPath), fieldpath.PathElement{FieldName: stringPtr(k)}), e[k], a[k])
+		}
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			c.addDrift(path, fieldPath, expected, actual)
+			return
+		}
+		// The lists of named objects such as the containers are compared by name
+		// and the other lists are compared as a whole
+		if !namedList(e) || !namedList(a) {
+			if !equalValues(e, a) {
+				c.addDrift(path, fieldPath, expected, actual)
+			}
+			return
+		}
+		for i, item := range e {
+			name := item.(map[string]interface{})["name"]
+			var actualItem interface{}
+			for _, candidate := range a {
+				if candidate.(map[string]interface{})["name"] == name {
+					actualItem = candidate
+					break
+				}
+			}
+			key := value.FieldList{{Name: "name", Value: value.NewValueInterface(name)}}
+			c.compare(fmt.Sprintf("%s[%d]", path, i), append(copyPath(fieldPath), fieldpath.PathElement{Key: &key}), item, actualItem)
+		}
+	default:
+		if !equalValues(expected, actual) && !(quantityPath(path) && equalQuantities(expected, actual)) {
+			c.addDrift(path, fieldPath, expected, actual)
+		}
+	}
+}
+
+//addDrift records a drifted field with the managers owning it, the field is ignored
+//if it is owned only by other managers than the field manager.
+func (c *driftComparator) addDrift(path string, fieldPath fieldpath.Path, expected, actual interface{}) {
+	managers := make([]string, 0)
+	owned := false
+	for _, managedField := range c.managedFields {
+		if managedField.set.Has(fieldPath) {
+			managers = append(managers, managedField.manager)
+			owned = owned || managedField.manager == c.fieldManager
+		}
+	}
+	if len(managers) != 0 && !owned {
+		return
+	}
+	c.drifted = append(c.drifted, DriftedField{
+		Path:     path,
+		Expected: expected,
+		Actual:   actual,
+		Managers: managers,
+	})
+}
+
+//namedList returns true if all items of the list are objects having a name
+func namedList(list []interface{}) bool {
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//equalValues compares two values, the numbers are compared by value
+func equalValues(expected, actual interface{}) bool {
+	if reflect.DeepEqual(expected, actual) {
+		return true
+	}
+	if e, ok := toFloat(expected); ok {
+		a, ok := toFloat(actual)
+		return ok && e == a
+	}
+	el, ok := expected.([]interface{})
+	if !ok {
+		return false
+	}
+	al, ok := actual.([]interface{})
+	if !ok || len(el) != len(al) {
+		return false
+	}
+	for i := range el {
+		if !equalValues(el[i], al[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//quantityFields are the fields containing quantities, such as the resources of the containers
+var quantityFields = []string{".limits.", ".requests.", ".hard.", ".capacity."}
+
+//quantityPath returns true if the field contains a quantity
+func quantityPath(path string) bool {
+	for _, field := range quantityFields {
+		if strings.Contains(path, field) {
+			return true
+		}
+	}
+	return false
+}
+
+//equalQuantities compares two quantities such as 500m and 0.5
+func equalQuantities(expected, actual interface{}) bool {
+	eq, err := resource.ParseQuantity(fmt.Sprint(expected))
+	if err != nil {
+		return false
+	}
+	aq, err := resource.ParseQuantity(fmt.Sprint(actual))
+	if err != nil {
+		return false
+	}
+	return eq.Cmp(aq) == 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+//formatValue formats a value of a drifted field
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func copyPath(path fieldpath.Path) fieldpath.Path {
+	return append(fieldpath.Path{}, path...)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
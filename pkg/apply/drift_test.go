@@ -0,0 +1,222 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplier_DetectDrift(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+  namespace: my-ns
+data:
+  log: debug
+`))
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+  namespace: my-ns
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/app:1.0
+        resources:
+          limits:
+            cpu: "0.5"
+`))
+	reader.AddAsset("secret.yaml", []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret
+  namespace: my-ns
+stringData:
+  password: my-password
+`))
+	reader.AddAsset("missing.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-missing-cm
+  namespace: my-ns
+`))
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "my-cm",
+			"namespace": "my-ns",
+		},
+		"data": map[string]interface{}{"log": "info"},
+	}}
+	// The applier updates the objects without field manager
+	fieldManager := FieldManager(nil)
+	configMap.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationUpdate, FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:log":{}}}`)}},
+	})
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "my-deployment",
+			"namespace": "my-ns",
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":            "sidecar",
+							"image":           "quay.io/sidecar:1.0",
+							"imagePullPolicy": "IfNotPresent",
+						},
+						map[string]interface{}{
+							"name":            "app",
+							"image":           "quay.io/app:2.0",
+							"imagePullPolicy": "IfNotPresent",
+							"resources": map[string]interface{}{
+								"limits": map[string]interface{}{"cpu": "500m"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	deployment.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-edit", Operation: metav1.ManagedFieldsOperationUpdate, FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"app\"}":{"f:image":{}}}}}}}`)}},
+	})
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "my-secret",
+			"namespace": "my-ns",
+		},
+		// my-password
+		"data": map[string]interface{}{"password": "bXktcGFzc3dvcmQ="},
+	}}
+	kubeClient := kubefake.NewSimpleClientset()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true}}},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}, {Name: "secrets", Kind: "Secret", Namespaced: true}}},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+			{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+			{Version: "v1", Resource: "secrets"}:                    "SecretList",
+		}, configMap, deployment, secret)
+	applier := NewApplierBuilder().WithClient(kubeClient, apiextensionsfake.NewSimpleClientset(), dynamicClient).Build()
+
+	drifts, err := applier.DetectDrift(reader, map[string]interface{}{}, "", "configmap.yaml", "deployment.yaml", "secret.yaml", "missing.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, drift := range drifts {
+		got = append(got, drift.Strings()...)
+	}
+	want := []string{
+		"configmap.yaml: ConfigMap my-ns/my-cm: data.log: expected debug, got info (managed by " + fieldManager + ")",
+		"deployment.yaml: Deployment my-ns/my-deployment: spec.replicas: expected 1, got 3",
+		"missing.yaml: ConfigMap my-ns/my-missing-cm: the object does not exist",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if _, err := NewApplierBuilder().Build().DetectDrift(reader, map[string]interface{}{}, "", "configmap.yaml"); err == nil {
+		t.Error("an applier without client must fail")
+	}
+}
+
+func TestDetectObjectDrift(t *testing.T) {
+	required := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "my-cm",
+			"namespace": "my-ns",
+		},
+		"data": map[string]interface{}{"log": "debug"},
+	}}
+	existing := required.DeepCopy()
+	existing.SetResourceVersion("2")
+	existing.SetUID("e7b3c4a4-4d1f-4c5e-9a3b-2f1d6e8c9b0a")
+	managedBy := func(manager string) *unstructured.Unstructured {
+		u := existing.DeepCopy()
+		u.Object["data"] = map[string]interface{}{"log": "info"}
+		u.SetManagedFields([]metav1.ManagedFieldsEntry{
+			{Manager: manager, Operation: metav1.ManagedFieldsOperationUpdate, FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:log":{}}}`)}},
+		})
+		return u
+	}
+	tests := []struct {
+		name     string
+		existing *unstructured.Unstructured
+		want     []string
+	}{
+		{
+			name:     "not drifted",
+			existing: existing,
+		},
+		{
+			name:     "owned by the field manager",
+			existing: managedBy("applier"),
+			want:     []string{"configmap.yaml: ConfigMap my-ns/my-cm: data.log: expected debug, got info (managed by applier)"},
+		},
+		{
+			name:     "owned by another manager",
+			existing: managedBy("my-controller"),
+		},
+		{
+			name: "drifted",
+			existing: func() *unstructured.Unstructured {
+				u := existing.DeepCopy()
+				u.Object["data"] = map[string]interface{}{"log": "info"}
+				return u
+			}(),
+			want: []string{"configmap.yaml: ConfigMap my-ns/my-cm: data.log: expected debug, got info"},
+		},
+		{
+			name: "missing",
+			want: []string{"configmap.yaml: ConfigMap my-ns/my-cm: the object does not exist"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drift, err := DetectObjectDrift("configmap.yaml", "applier", required, tt.existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if drift != nil {
+					t.Errorf("Expected no drift got %v", drift.Strings())
+				}
+				return
+			}
+			if drift == nil || !reflect.DeepEqual(drift.Strings(), tt.want) {
+				t.Errorf("Expected %v got %v", tt.want, drift)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"encoding/base64"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/klog/v2"
+)
+
+//FilesKey is the key of the Files in the template context
+const FilesKey = "Files"
+
+//Files gives access in the templates to the files of the reader supplying the templates,
+//like the helm .Files object. The files are read only when they are used.
+//The names are resolved relative to the directory of the rendered template first
+//and then as names of the reader.
+//With an asset.FileReader all files are accessible whatever their extension,
+//with the other readers only the assets are accessible.
+type Files struct {
+	reader asset.ScenarioReader
+	//dir is the directory of the rendered template
+	dir string
+	//names restricts the files to the ones returned by Glob, nil means all files
+	names []string
+}
+
+//NewFiles returns the Files of the reader for the template, it is exposed as .Files by the
+//template context and it can be added to the values when the template context is not used.
+func NewFiles(reader asset.ScenarioReader, templateName string) Files {
+	return Files{
+		reader: reader,
+		dir:    path.Dir(filepath.ToSlash(templateName)),
+	}
+}
+
+//fileNames returns the names of the files
+func (f Files) fileNames() []string {
+	if f.names != nil {
+		return f.names
+	}
+	var names []string
+	var err error
+	if fileReader, ok := f.reader.(asset.FileReader); ok {
+		names, err = fileReader.FileNames()
+	} else {
+		names, err = f.reader.AssetNames(nil, nil, "")
+	}
+	if err != nil {
+		klog.Error(err)
+		return []string{}
+	}
+	return names
+}
+
+//readFile reads a file of the reader
+func (f Files) readFile(name string) ([]byte, error) {
+	if fileReader, ok := f.reader.(asset.FileReader); ok {
+		return fileReader.File(name)
+	}
+	return f.reader.Asset(name)
+}
+
+//find returns the reader name of the file, the name is resolved
+//relative to the template directory first.
+func (f Files) find(name string) (string, bool) {
+	names := f.fileNames()
+	for _, candidate := range []string{path.Join(f.dir, filepath.ToSlash(name)), path.Clean(filepath.ToSlash(name))} {
+		for _, n := range names {
+			if filepath.ToSlash(n) == candidate {
+				return n, true
+			}
+		}
+	}
+	return "", false
+}
+
+//GetBytes returns the content of a file, nil is returned if the file doesn't exist
+func (f Files) GetBytes(name string) []byte {
+	n, ok := f.find(name)
+	if !ok {
+		return nil
+	}
+	b, err := f.readFile(n)
+	if err != nil {
+		klog.Error(err)
+		return nil
+	}
+	return b
+}
+
+//Get returns the content of a file as a string, like in helm an empty string
+//is returned if the file doesn't exist
+func (f Files) Get(name string) string {
+	return string(f.GetBytes(name))
+}
+
+//Lines returns the lines of a file
+func (f Files) Lines(name string) []string {
+	s := f.Get(name)
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+}
+
+//Glob returns the files matching the doublestar glob pattern relative to the template directory
+//or matching the pattern as names of the reader.
+func (f Files) Glob(pattern string) Files {
+	pattern = filepath.ToSlash(pattern)
+	patterns := []string{path.Join(f.dir, pattern), pattern}
+	names := make([]string, 0)
+	for _, n := range f.fileNames() {
+		for _, p := range patterns {
+			if ok, _ := doublestar.Match(p, filepath.ToSlash(n)); ok {
+				names = append(names, n)
+				break
+			}
+		}
+	}
+	return Files{
+		reader: f.reader,
+		dir:    f.dir,
+		names:  names,
+	}
+}
+
+//Names returns the names of the files
+func (f Files) Names() []string {
+	return append([]string{}, f.fileNames()...)
+}
+
+//AsConfig returns the files as the YAML data of a ConfigMap, the keys are the base names of the files
+func (f Files) AsConfig() string {
+	m := make(map[string]string)
+	for _, n := range f.fileNames() {
+		m[path.Base(filepath.ToSlash(n))] = string(f.GetBytes(n))
+	}
+	return toYamlData(m)
+}
+
+//AsSecrets returns the files as the base64 encoded YAML data of a Secret,
+//the keys are the base names of the files
+func (f Files) AsSecrets() string {
+	m := make(map[string]string)
+	for _, n := range f.fileNames() {
+		m[path.Base(filepath.ToSlash(n))] = base64.StdEncoding.EncodeToString(f.GetBytes(n))
+	}
+	return toYamlData(m)
+}
+
+//toYamlData returns the map as YAML, an empty string is returned for an empty map
+func toYamlData(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		klog.Error(err)
+		return ""
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
@@ -0,0 +1,192 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+func TestApplier_Files(t *testing.T) {
+	files := map[string]string{
+		"cm/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Values.Name }}
+data:
+  run.sh: |
+{{ .Files.Get "scripts/run.sh" | trim | indent 4 }}
+{{- (.Files.Glob "conf/*.conf").AsConfig | nindent 2 }}
+`,
+		"cm/secret.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .Values.Name }}
+data:
+{{- (.Files.Glob "conf/a.conf").AsSecrets | nindent 2 }}
+  lines: "{{ len (.Files.Lines "conf/b.conf") }}"
+  missing: "{{ .Files.Get "missing.sh" }}"
+`,
+		"cm/scripts/run.sh": "#!/bin/sh\necho run\n",
+		"cm/conf/a.conf":    "a=1\n",
+		"cm/conf/b.conf":    "b=2\nc=3\n",
+	}
+	want := []string{
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-name\ndata:\n  run.sh: |\n    #!/bin/sh\n    echo run\n  a.conf: |\n    a=1\n  b.conf: |\n    b=2\n    c=3\n",
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  name: my-name\ndata:\n  a.conf: YT0xCg==\n  lines: \"2\"\n  missing: \"\"\n",
+	}
+
+	memFSReader := asset.NewMemFSReader()
+	mapFS := fstest.MapFS{}
+	dir, err := os.MkdirTemp("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The in-memory reader lists the assets in the order they are added
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := files[name]
+		memFSReader.AddAsset(name, []byte(content))
+		mapFS[name] = &fstest.MapFile{Data: []byte(content)}
+		f := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	directoriesReader, err := asset.NewDirectoriesReader("", []string{filepath.Join(dir, "cm")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		reader asset.ScenarioReader
+		files  []string
+	}{
+		{
+			name:   "in-memory reader",
+			reader: memFSReader,
+			files:  []string{"cm/configmap.yaml", "cm/secret.yaml"},
+		},
+		{
+			name:   "fs reader",
+			reader: asset.NewFSReader(mapFS),
+			files:  []string{"cm/configmap.yaml", "cm/secret.yaml"},
+		},
+		{
+			name:   "directories reader",
+			reader: directoriesReader,
+			files:  []string{filepath.Join(dir, "cm", "configmap.yaml"), filepath.Join(dir, "cm", "secret.yaml")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]interface{}{"Name": "my-name"}
+			a := NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).WithTemplateContext(Release{Name: "my-release"}).Build()
+			got, err := a.MustTemplateAssets(tt.reader, values, "", tt.files...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestApplier_FilesWithoutTemplateContext(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+data:
+{{- toYaml . | trim | nindent 2 }}
+`))
+	values := map[string]interface{}{"log": "debug"}
+	got, err := NewApplierBuilder().Build().MustTemplateAssets(reader, values, "", "configmap.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\ndata:\n  log: debug\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+	}
+	if len(values) != 1 {
+		t.Errorf("the values must not be modified, got %v", values)
+	}
+}
+
+func TestApplier_FilesFunction(t *testing.T) {
+	partials := asset.NewMemFSReader()
+	partials.AddAsset("_helpers.tpl", []byte(`{{- define "script" }}{{ (files).Get "scripts/run.sh" | trim }}{{ end }}`))
+	newReader := func(conf string) *asset.MemFS {
+		reader := asset.NewMemFSReader()
+		reader.AddAsset("dir/configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+data:
+  log: {{ .log }}
+  script: {{ include "script" . | quote }}
+{{- ((files).Glob "*.conf").AsConfig | nindent 2 }}
+`))
+		reader.AddAsset("dir/a.conf", []byte(conf))
+		reader.AddAsset("scripts/run.sh", []byte("echo run\n"))
+		return reader
+	}
+	values := map[string]interface{}{"log": "debug"}
+	a := NewApplierBuilder().WithPartials(partials, "").Build()
+	// The compiled template is shared, the function must read the files of each reader
+	for _, conf := range []string{"a=1", "a=2"} {
+		got, err := a.MustTemplateAssets(newReader(conf+"\n"), values, "", "dir/configmap.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\ndata:\n  log: debug\n  script: \"echo run\"\n  a.conf: |\n    " + conf + "\n"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFiles_Names(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("dir/template.yaml", []byte("kind: ConfigMap\n"))
+	reader.AddAsset("dir/scripts/a.sh", []byte("a"))
+	reader.AddAsset("dir/scripts/sub/b.sh", []byte("b"))
+	reader.AddAsset("other/c.sh", []byte("c"))
+	files := NewFiles(reader, "dir/template.yaml")
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "scripts/*.sh", want: []string{"dir/scripts/a.sh"}},
+		{pattern: "scripts/**/*.sh", want: []string{"dir/scripts/a.sh", "dir/scripts/sub/b.sh"}},
+		{pattern: "**/*.sh", want: []string{"dir/scripts/a.sh", "dir/scripts/sub/b.sh", "other/c.sh"}},
+		{pattern: "other/*.sh", want: []string{"other/c.sh"}},
+		{pattern: "*.txt", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := files.Glob(tt.pattern).Names(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Glob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
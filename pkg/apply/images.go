@@ -0,0 +1,202 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//podSpecPaths are the paths of the pod spec of the workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+//containerFields are the fields of a pod spec containing containers with an image
+var containerFields = []string{"initContainers", "containers"}
+
+//ParseImageOverrides parses the image overrides formatted as old=new[@digest]
+//and returns them as a map for WithImageOverrides.
+func ParseImageOverrides(overrides []string) (map[string]string, error) {
+	imageOverrides := make(map[string]string, len(overrides))
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("invalid image override %q, the format is old=new[@digest]", override)
+		}
+		if _, _, digest := splitImage(kv[1]); len(digest) != 0 && !strings.Contains(digest, ":") {
+			return nil, fmt.Errorf("invalid image override %q, the digest must be formatted as algorithm:hex", override)
+		}
+		imageOverrides[kv[0]] = kv[1]
+	}
+	return imageOverrides, nil
+}
+
+//mergeImageOverrides returns a new map containing the image overrides of both maps
+func mergeImageOverrides(imageOverrides, added map[string]string) map[string]string {
+	merged := make(map[string]string, len(imageOverrides)+len(added))
+	for k, v := range imageOverrides {
+		merged[k] = v
+	}
+	for k, v := range added {
+		merged[k] = v
+	}
+	return merged
+}
+
+//splitImage returns the name, the tag and the digest of an image reference
+func splitImage(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i != -1 {
+		name, digest = name[:i], name[i+1:]
+	}
+	// The colon of a registry port is followed by a slash
+	if i := strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i:], "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return name, tag, digest
+}
+
+//overrideImage returns the overridden image and true if it changed. An override of the whole reference
+//takes precedence over an override of the image name, which matches all tags and digests of the image.
+//The tag and the digest are kept unless the new image sets one of them, so an image pinned
+//with new@digest has no tag.
+func overrideImage(image string, imageOverrides map[string]string) (string, bool) {
+	if newImage, ok := imageOverrides[image]; ok {
+		return newImage, newImage != image
+	}
+	name, tag, digest := splitImage(image)
+	newImage, ok := imageOverrides[name]
+	if !ok {
+		return image, false
+	}
+	newName, newTag, newDigest := splitImage(newImage)
+	if len(newTag) != 0 || len(newDigest) != 0 {
+		tag, digest = newTag, newDigest
+	}
+	overridden := newName
+	if len(tag) != 0 {
+		overridden += ":" + tag
+	}
+	if len(digest) != 0 {
+		overridden += "@" + digest
+	}
+	return overridden, overridden != image
+}
+
+//overrideDocumentImages overrides the images of the documents written by the exec post-renderer
+func (a Applier) overrideDocumentImages(documents []helpers.Document) ([]helpers.Document, error) {
+	if len(a.imageOverrides) == 0 || a.execPostRenderer == nil {
+		return documents, nil
+	}
+	postRenderers := []PostRenderer{imageOverridesPostRenderer(a.imageOverrides)}
+	overridden := make([]helpers.Document, 0, len(documents))
+	for _, document := range documents {
+		content, err := postRender(postRenderers, document.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", document.Name, err)
+		}
+		overridden = append(overridden, helpers.Document{Name: document.Name, Content: content})
+	}
+	return overridden, nil
+}
+
+//imageOverridesPostRenderer returns the post-renderer overriding the images of the containers
+//and init containers of the workloads
+func imageOverridesPostRenderer(imageOverrides map[string]string) PostRenderer {
+	return func(u *unstructured.Unstructured) error {
+		return visitContainers(u, func(container map[string]interface{}) bool {
+			image, ok := container["image"].(string)
+			if !ok {
+				return false
+			}
+			overridden, changed := overrideImage(image, imageOverrides)
+			if changed {
+				container["image"] = overridden
+			}
+			return changed
+		})
+	}
+}
+
+//visitContainers calls visit on the containers and init containers of a workload,
+//the containers are updated if visit returns true for one of them.
+func visitContainers(u *unstructured.Unstructured, visit func(container map[string]interface{}) bool) error {
+	podSpecPath, ok := podSpecPaths[u.GetKind()]
+	if !ok {
+		return nil
+	}
+	for _, field := range containerFields {
+		fields := append(append([]string{}, podSpecPath...), field)
+		containers, found, err := unstructured.NestedSlice(u.Object, fields...)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", u.GetKind(), u.GetName(), err)
+		}
+		if !found {
+			continue
+		}
+		changed := false
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if visit(container) {
+				changed = true
+			}
+		}
+		if changed {
+			if err := unstructured.SetNestedSlice(u.Object, containers, fields...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//ListImages returns the sorted list of the images of the containers and init containers
+//of the workloads in the rendered documents, such as the output of MustTemplateAssets.
+func ListImages(rendered []string) ([]string, error) {
+	images := make(map[string]bool)
+	for _, r := range rendered {
+		documents, err := helpers.SplitDocuments([]byte(r))
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range documents {
+			j, err := asset.ToJSON(document)
+			if err != nil {
+				return nil, err
+			}
+			u := &unstructured.Unstructured{}
+			if err := u.UnmarshalJSON(j); err != nil {
+				return nil, err
+			}
+			err = visitContainers(u, func(container map[string]interface{}) bool {
+				if image, ok := container["image"].(string); ok && len(image) != 0 {
+					images[image] = true
+				}
+				return false
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	list := make([]string, 0, len(images))
+	for image := range images {
+		list = append(list, image)
+	}
+	sort.Strings(list)
+	return list, nil
+}
@@ -0,0 +1,165 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestOverrideImage(t *testing.T) {
+	imageOverrides := map[string]string{
+		"nginx":                    "mirror.example.com/nginx",
+		"quay.io/app:v1":           "mirror.example.com/app:v1-patched",
+		"localhost:5000/tool":      "mirror.example.com/tool@" + digest,
+		"registry.example.com/api": "mirror.example.com/api:v2",
+	}
+	tests := []struct {
+		image       string
+		want        string
+		wantChanged bool
+	}{
+		{image: "nginx", want: "mirror.example.com/nginx", wantChanged: true},
+		{image: "nginx:1.23", want: "mirror.example.com/nginx:1.23", wantChanged: true},
+		{image: "nginx@" + digest, want: "mirror.example.com/nginx@" + digest, wantChanged: true},
+		{image: "quay.io/app:v1", want: "mirror.example.com/app:v1-patched", wantChanged: true},
+		{image: "quay.io/app:v2", want: "quay.io/app:v2", wantChanged: false},
+		{image: "localhost:5000/tool:latest", want: "mirror.example.com/tool@" + digest, wantChanged: true},
+		{image: "registry.example.com/api:v1", want: "mirror.example.com/api:v2", wantChanged: true},
+		{image: "busybox", want: "busybox", wantChanged: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, changed := overrideImage(tt.image, imageOverrides)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("overrideImage() = %v, %v, want %v, %v", got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestParseImageOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "overrides",
+			overrides: []string{"nginx=mirror.example.com/nginx", "app:v1=mirror.example.com/app@" + digest},
+			want: map[string]string{
+				"nginx":  "mirror.example.com/nginx",
+				"app:v1": "mirror.example.com/app@" + digest,
+			},
+		},
+		{
+			name:      "missing new image",
+			overrides: []string{"nginx="},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid digest",
+			overrides: []string{"nginx=mirror.example.com/nginx@0123"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImageOverrides(tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseImageOverrides() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImageOverrides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_ImageOverrides(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("cronjob.yaml", []byte(`apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: my-cronjob
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - name: init
+            image: busybox:1.35
+          containers:
+          - name: job
+            image: {{ .Image }}
+`))
+	reader.AddAsset("pod.yaml", []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: my-pod
+spec:
+  containers:
+  - name: app
+    image: nginx:1.23
+`))
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+data:
+  image: nginx:1.23
+`))
+	values := map[string]interface{}{"Image": "quay.io/job:v1"}
+	files := []string{"cronjob.yaml", "pod.yaml", "configmap.yaml"}
+	imageOverrides, err := ParseImageOverrides([]string{"busybox=mirror.example.com/busybox", "quay.io/job:v1=mirror.example.com/job@" + digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		applier Applier
+		want    []string
+	}{
+		{
+			name:    "no overrides",
+			applier: NewApplierBuilder().Build(),
+			want:    []string{"busybox:1.35", "nginx:1.23", "quay.io/job:v1"},
+		},
+		{
+			name:    "builder",
+			applier: NewApplierBuilder().WithImageOverrides(imageOverrides).WithImageOverrides(map[string]string{"nginx": "mirror.example.com/nginx"}).Build(),
+			want:    []string{"mirror.example.com/busybox:1.35", "mirror.example.com/job@" + digest, "mirror.example.com/nginx:1.23"},
+		},
+		{
+			name:    "applier",
+			applier: NewApplierBuilder().Build().WithImageOverrides(imageOverrides),
+			want:    []string{"mirror.example.com/busybox:1.35", "mirror.example.com/job@" + digest, "nginx:1.23"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := tt.applier.MustTemplateAssets(reader, values, "", files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rendered) != 3 {
+				t.Fatalf("got %d outputs: %v", len(rendered), rendered)
+			}
+			got, err := ListImages(rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListImages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
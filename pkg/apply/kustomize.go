@@ -0,0 +1,184 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+//buildKustomization builds the kustomization directory of the kustomization file with kustomize,
+//the files of the kustomization are copied from the reader in an in-memory file system so the bases
+//and resources referenced by the kustomization must be part of the reader.
+//The built objects are named after the kustomization file and their index.
+func (a Applier) buildKustomization(reader asset.ScenarioReader, name string) ([]helpers.Document, error) {
+	fSys, sources, err := kustomizeFileSystem(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	key := templateKey(name, sources...)
+	built, ok := a.renderCache.get(key)
+	if !ok {
+		resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, kustomizePath(path.Dir(filepath.ToSlash(name))))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		built, err = resMap.AsYaml()
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		a.renderCache.set(key, built)
+	}
+	documents, err := helpers.SplitFile(name, built)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", name, err)
+	}
+	return documents, nil
+}
+
+//kustomizeFileSystem returns an in-memory file system containing the files of the kustomization
+//root of the kustomization file and of the bases, resources and components it references,
+//and the names and contents of the files.
+//With an asset.FileReader all files are copied whatever their extension, such as the files
+//of the configMapGenerator, with the other readers only the assets are copied.
+func kustomizeFileSystem(reader asset.ScenarioReader, name string) (filesys.FileSystem, [][]byte, error) {
+	var names []string
+	var err error
+	read := reader.Asset
+	if fileReader, ok := reader.(asset.FileReader); ok {
+		names, err = fileReader.FileNames()
+		read = fileReader.File
+	} else {
+		names, err = reader.AssetNames(nil, nil, "")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	roots, err := kustomizationRoots(names, read, path.Dir(filepath.ToSlash(name)))
+	if err != nil {
+		return nil, nil, err
+	}
+	fSys := filesys.MakeFsInMemory()
+	sources := make([][]byte, 0, 2*len(names))
+	copied := make(map[string]string)
+	for _, name := range names {
+		if !inRoots(filepath.ToSlash(name), roots) {
+			continue
+		}
+		p := kustomizePath(filepath.ToSlash(name))
+		if other, ok := copied[p]; ok {
+			return nil, nil, fmt.Errorf("%q and %q have the same path %q in the kustomization", other, name, p)
+		}
+		copied[p] = name
+		b, err := read(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fSys.WriteFile(p, b); err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, []byte(name), b)
+	}
+	return fSys, sources, nil
+}
+
+//kustomizationRoots returns the kustomization root dir and the bases, resources and components
+//referenced by its kustomization and by the kustomizations of the referenced directories.
+//A reference which is not a file or a directory of the reader returns an error,
+//it would otherwise be resolved to another file once copied in the in-memory file system.
+func kustomizationRoots(names []string, read func(string) ([]byte, error), dir string) ([]string, error) {
+	roots := []string{dir}
+	visited := map[string]bool{dir: true}
+	for i := 0; i < len(roots); i++ {
+		for _, name := range names {
+			if !asset.IsKustomization(name) || path.Dir(filepath.ToSlash(name)) != roots[i] {
+				continue
+			}
+			b, err := read(name)
+			if err != nil {
+				return nil, err
+			}
+			k := &types.Kustomization{}
+			if err := k.Unmarshal(b); err != nil {
+				return nil, fmt.Errorf("%q: %v", name, err)
+			}
+			for _, r := range append(append(append([]string{}, k.Resources...), k.Bases...), k.Components...) {
+				ref := path.Join(roots[i], r)
+				if visited[ref] {
+					continue
+				}
+				if !inReader(ref, names) {
+					return nil, fmt.Errorf("%q: the resource %q is not a file or a directory of the reader", name, r)
+				}
+				visited[ref] = true
+				roots = append(roots, ref)
+			}
+		}
+	}
+	return roots, nil
+}
+
+//inRoots returns true if the name is one of the roots or is located under one of them
+func inRoots(name string, roots []string) bool {
+	for _, root := range roots {
+		if name == root || strings.HasPrefix(name, root+"/") ||
+			(root == "." && name != ".." && !strings.HasPrefix(name, "../")) {
+			return true
+		}
+	}
+	return false
+}
+
+//inReader returns true if the name is a file or a directory of the names
+func inReader(name string, names []string) bool {
+	for _, n := range names {
+		n = filepath.ToSlash(n)
+		if n == name || strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+//kustomizePath returns the path of a file of the reader in the in-memory file system
+func kustomizePath(name string) string {
+	return path.Join("/", name)
+}
+
+//referencedKustomizations returns the kustomization files of the files which are referenced
+//as a resource, a base or a component by another kustomization of the files,
+//they are built as part of the kustomization referencing them.
+func referencedKustomizations(reader asset.ScenarioReader, files []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, name := range files {
+		if !asset.IsKustomization(name) {
+			continue
+		}
+		b, err := reader.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		k := &types.Kustomization{}
+		if err := k.Unmarshal(b); err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		dir := filepath.Dir(name)
+		for _, r := range append(append(append([]string{}, k.Resources...), k.Bases...), k.Components...) {
+			resourceDir := filepath.Join(dir, filepath.FromSlash(r))
+			for _, f := range files {
+				if f != name && asset.IsKustomization(f) && filepath.Dir(filepath.Clean(f)) == resourceDir {
+					referenced[f] = true
+				}
+			}
+		}
+	}
+	return referenced, nil
+}
@@ -0,0 +1,132 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplier_Kustomization(t *testing.T) {
+	directoriesReader, err := asset.NewDirectoriesReader("", []string{"../../test/unit/resources/kustomize"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memFSReader := asset.NewMemFSReader()
+	memFSReader.AddAsset("base/kustomization.yaml", []byte("resources:\n- service.yaml\n"))
+	memFSReader.AddAsset("base/service.yaml", []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: my-app\n"))
+	memFSReader.AddAsset("templates/configmap.yaml", []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Name }}\n"))
+	missingReader := asset.NewMemFSReader()
+	missingReader.AddAsset("kustomization.yaml", []byte("resources:\n- missing.yaml\n"))
+	outsideReader := asset.NewMemFSReader()
+	outsideReader.AddAsset("app/kustomization.yaml", []byte("resources:\n- ../../app\n"))
+	outsideReader.AddAsset("app/service.yaml", []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: my-app\n"))
+	tests := []struct {
+		name    string
+		reader  asset.ScenarioReader
+		files   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "overlay",
+			reader: directoriesReader,
+			files:  []string{"../../test/unit/resources/kustomize"},
+			want: []string{
+				"ConfigMap/prod/prod-my-config-94mg667h6h",
+				"Service/prod/prod-my-app",
+				"Deployment/prod/prod-my-app",
+			},
+		},
+		{
+			name:   "base and template",
+			reader: memFSReader,
+			files:  []string{"base", "templates"},
+			want: []string{
+				"ConfigMap//my-cm",
+				"Service//my-app",
+			},
+		},
+		{
+			name:    "missing resource",
+			reader:  missingReader,
+			files:   []string{"kustomization.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "resource outside of the reader",
+			reader:  outsideReader,
+			files:   []string{"app"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := NewApplierBuilder().Build().MustTemplateAssets(tt.reader, map[string]interface{}{"Name": "my-cm"}, "", tt.files...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(output))
+			for _, o := range output {
+				j, err := asset.ToJSON([]byte(o))
+				if err != nil {
+					t.Fatal(err)
+				}
+				u := &unstructured.Unstructured{}
+				if err := u.UnmarshalJSON(j); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, u.GetKind()+"/"+u.GetNamespace()+"/"+u.GetName())
+				if u.GetKind() == "Deployment" {
+					replicas, _, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+					if replicas != 3 {
+						t.Errorf("Expected 3 replicas got %d", replicas)
+					}
+					if u.GetLabels()["app"] != "my-app" {
+						t.Errorf("Expected the label app: my-app got %v", u.GetLabels())
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateAssets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomizeFileSystem(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("overlays/prod/kustomization.yaml", []byte("resources:\n- ../../base\n"))
+	reader.AddAsset("overlays/prod/patch.yaml", []byte("kind: Service\n"))
+	reader.AddAsset("overlays/dev/kustomization.yaml", []byte("resources:\n- ../../base\n"))
+	reader.AddAsset("base/kustomization.yaml", []byte("resources:\n- service.yaml\n- ../common/namespace.yaml\n"))
+	reader.AddAsset("base/service.yaml", []byte("kind: Service\n"))
+	reader.AddAsset("common/namespace.yaml", []byte("kind: Namespace\n"))
+	reader.AddAsset("common/configmap.yaml", []byte("kind: ConfigMap\n"))
+	reader.AddAsset("templates/configmap.yaml", []byte("kind: ConfigMap\n"))
+	fSys, _, err := kustomizeFileSystem(reader, "overlays/prod/kustomization.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"/overlays/prod/kustomization.yaml": true,
+		"/overlays/prod/patch.yaml":         true,
+		"/base/kustomization.yaml":          true,
+		"/base/service.yaml":                true,
+		"/common/namespace.yaml":            true,
+		"/overlays/dev/kustomization.yaml":  false,
+		"/common/configmap.yaml":            false,
+		"/templates/configmap.yaml":         false,
+	} {
+		if got := fSys.Exists(name); got != want {
+			t.Errorf("Exists(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//LintSeverity is the severity of a lint issue
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+//The lint rules
+const (
+	//LintRuleDuplicate reports the objects having the same apiVersion, kind, namespace and name
+	LintRuleDuplicate = "duplicate"
+	//LintRuleMissingNamespace reports the namespaced objects without namespace
+	LintRuleMissingNamespace = "missing-namespace"
+	//LintRuleClusterScopedNamespace reports the cluster scoped objects with a namespace
+	LintRuleClusterScopedNamespace = "cluster-scoped-namespace"
+	//LintRuleRequiredLabel reports the objects without one of the required labels
+	LintRuleRequiredLabel = "required-label"
+	//LintRuleUnknownKind reports the kinds which are not in the kinds order, not known and not defined by a CRD
+	LintRuleUnknownKind = "unknown-kind"
+	//LintRuleEmptyAsset reports the files which are empty after rendering and so skipped
+	LintRuleEmptyAsset = "empty-asset"
+	//LintRuleDeprecatedAPIVersion reports the objects using a deprecated apiVersion
+	LintRuleDeprecatedAPIVersion = "deprecated-api-version"
+	//LintRulePolicy reports the violations of the policy rules set by WithPolicy,
+	//the violations are errors in enforce mode and warnings in warn mode
+	LintRulePolicy = "policy"
+)
+
+//lintRuleSeverities are the severities of the lint rules
+var lintRuleSeverities = map[string]LintSeverity{
+	LintRuleDuplicate:              LintError,
+	LintRuleMissingNamespace:       LintWarning,
+	LintRuleClusterScopedNamespace: LintError,
+	LintRuleRequiredLabel:          LintError,
+	LintRuleUnknownKind:            LintWarning,
+	LintRuleEmptyAsset:             LintWarning,
+	LintRuleDeprecatedAPIVersion:   LintWarning,
+	LintRulePolicy:                 LintError,
+}
+
+//clusterScopedKinds are the built-in cluster scoped kinds
+var clusterScopedKinds = []string{
+	"APIService",
+	"CertificateSigningRequest",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ClusterRoleBindingList",
+	"ClusterRoleList",
+	"ComponentStatus",
+	"CSIDriver",
+	"CSINode",
+	"CustomResourceDefinition",
+	"FlowSchema",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PodSecurityPolicy",
+	"PriorityClass",
+	"PriorityLevelConfiguration",
+	"RuntimeClass",
+	"StorageClass",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+//LintConfig configures the lint rules
+type LintConfig struct {
+	//RequiredLabels are the labels each object must have
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+	//KnownKinds are the kinds which are not in the kinds order and not reported as unknown
+	KnownKinds []string `json:"knownKinds,omitempty"`
+	//ClusterScopedKinds are the cluster scoped kinds in addition to the built-in ones
+	//and to the ones defined by the CRDs of the linted objects
+	ClusterScopedKinds []string `json:"clusterScopedKinds,omitempty"`
+	//DisabledRules are the rules which are not checked
+	DisabledRules []string `json:"disabledRules,omitempty"`
+}
+
+//ParseLintConfig parses a YAML or JSON lint configuration
+func ParseLintConfig(b []byte) (*LintConfig, error) {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	config := &LintConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, rule := range config.DisabledRules {
+		if _, ok := lintRuleSeverities[rule]; !ok {
+			return nil, fmt.Errorf("unknown lint rule %q", rule)
+		}
+	}
+	return config, nil
+}
+
+//LintIssue is an issue found by a lint rule
+type LintIssue struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	//Document is the name of the rendered document, for example file.yaml#1, or the name of the empty file
+	Document   string `json:"document"`
+	File       string `json:"file"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	s := fmt.Sprintf("%s: %s:", i.Severity, i.Document)
+	if len(i.Kind) != 0 {
+		s += " " + i.Kind + " "
+		if len(i.Namespace) != 0 {
+			s += i.Namespace + "/"
+		}
+		s += i.Name + ":"
+	}
+	return fmt.Sprintf("%s %s (%s)", s, i.Message, i.Rule)
+}
+
+//LintIssues are the issues found by the lint rules
+type LintIssues []LintIssue
+
+//HasErrors returns true if one of the issues is an error
+func (issues LintIssues) HasErrors() bool {
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+//lintedObject is a rendered object
+type lintedObject struct {
+	document string
+	object   *unstructured.Unstructured
+}
+
+//Lint renders the files like MustTemplateAssets and checks the rendered objects with the lint rules.
+//The namespaced and the cluster scoped kinds are the built-in ones, the ones defined
+//by the CRDs found in the rendered objects and the ones of the configuration,
+//the kinds of the kinds order are known. The violations of the policy set by WithPolicy
+//are reported as issues instead of failing the rendering.
+func (a Applier) Lint(reader asset.ScenarioReader,
+	values interface{},
+	headerFile string,
+	config LintConfig,
+	files ...string) (LintIssues, error) {
+	// The render cache records the empty files
+	a = a.withRenderCache()
+	policy := a.policy
+	a.policy = nil
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]lintedObject, 0, len(files))
+	documents := make([]helpers.Document, 0, len(files))
+	for _, name := range files {
+		b, err := memFSReader.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		u, err := documentToUnstructured(b)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		objects = append(objects, lintedObject{document: name, object: u})
+		documents = append(documents, helpers.Document{Name: name, Content: b})
+	}
+	// The policy violations are reported with the issues of their object
+	violations := make(map[string]PolicyViolations)
+	if policy != nil {
+		policyViolations, err := policy.Check(documents)
+		if err != nil {
+			return nil, err
+		}
+		for _, violation := range policyViolations {
+			violations[violation.Document] = append(violations[violation.Document], violation)
+		}
+	}
+	l := newLinter(a.kindOrder, config, objects)
+	issues := make(LintIssues, 0)
+	for _, o := range objects {
+		issues = append(issues, l.lintObject(o)...)
+		for _, violation := range violations[o.document] {
+			issue := l.newIssue(LintRulePolicy, o.document, o.object, fmt.Sprintf("%s: %s", violation.Rule, violation.Message))
+			if policy.Mode == PolicyWarn {
+				issue.Severity = LintWarning
+			}
+			issues = append(issues, issue)
+		}
+	}
+	for _, name := range a.renderCache.getEmptyAssets() {
+		issues = append(issues, l.newIssue(LintRuleEmptyAsset, name, nil, "the file is empty after rendering and is skipped"))
+	}
+	return l.enabled(issues), nil
+}
+
+//linter holds the state of the lint rules
+type linter struct {
+	config LintConfig
+	//knownKinds are the kinds of the kinds order, the configuration and the CRDs
+	knownKinds map[string]bool
+	//clusterScoped records if the known kinds are cluster scoped
+	clusterScoped map[string]bool
+	//documents are the documents of the objects by key to find the duplicates
+	documents map[string]string
+}
+
+func newLinter(kindOrder KindsOrder, config LintConfig, objects []lintedObject) *linter {
+	l := &linter{
+		config:        config,
+		knownKinds:    make(map[string]bool),
+		clusterScoped: make(map[string]bool),
+		documents:     make(map[string]string),
+	}
+	for _, kind := range kindOrder {
+		l.knownKinds[kind] = true
+	}
+	for _, kind := range config.KnownKinds {
+		l.knownKinds[kind] = true
+	}
+	for _, kind := range append(append([]string{}, clusterScopedKinds...), config.ClusterScopedKinds...) {
+		l.knownKinds[kind] = true
+		l.clusterScoped[kind] = true
+	}
+	// The kinds defined by the CRDs
+	for _, o := range objects {
+		if o.object.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(o.object.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(o.object.Object, "spec", "scope")
+		if len(kind) != 0 {
+			l.knownKinds[kind] = true
+			l.clusterScoped[kind] = scope == "Cluster"
+		}
+	}
+	return l
+}
+
+//newIssue returns an issue of the rule for the object, the object can be nil
+func (l *linter) newIssue(rule, document string, u *unstructured.Unstructured, message string) LintIssue {
+	issue := LintIssue{
+		Rule:     rule,
+		Severity: lintRuleSeverities[rule],
+		Document: document,
+		File:     helpers.SourceFile(document),
+		Message:  message,
+	}
+	if u != nil {
+		issue.APIVersion = u.GetAPIVersion()
+		issue.Kind = u.GetKind()
+		issue.Namespace = u.GetNamespace()
+		issue.Name = u.GetName()
+	}
+	return issue
+}
+
+//lintObject checks an object with the lint rules
+func (l *linter) lintObject(o lintedObject) LintIssues {
+	u := o.object
+	issues := make(LintIssues, 0)
+	key := strings.Join([]string{u.GetAPIVersion(), u.GetKind(), u.GetNamespace(), u.GetName()}, "/")
+	if document, ok := l.documents[key]; ok {
+		issues = append(issues, l.newIssue(LintRuleDuplicate, o.document, u, fmt.Sprintf("the object is already defined in %s", document)))
+	} else {
+		l.documents[key] = o.document
+	}
+	if l.knownKinds[u.GetKind()] {
+		switch {
+		case l.clusterScoped[u.GetKind()] && len(u.GetNamespace()) != 0:
+			issues = append(issues, l.newIssue(LintRuleClusterScopedNamespace, o.document, u, "the object is cluster scoped and has a namespace"))
+		case !l.clusterScoped[u.GetKind()] && len(u.GetNamespace()) == 0:
+			issues = append(issues, l.newIssue(LintRuleMissingNamespace, o.document, u, "the object is namespaced and has no namespace"))
+		}
+	} else {
+		issues = append(issues, l.newIssue(LintRuleUnknownKind, o.document, u, fmt.Sprintf("the kind %s is not in the kinds order, not known and not defined by a CRD", u.GetKind())))
+	}
+	labels := u.GetLabels()
+	for _, label := range l.config.RequiredLabels {
+		if _, ok := labels[label]; !ok {
+			issues = append(issues, l.newIssue(LintRuleRequiredLabel, o.document, u, fmt.Sprintf("the label %s is missing", label)))
+		}
+	}
+	if deprecatedAPI, ok := FindDeprecatedAPI(u.GetAPIVersion(), u.GetKind()); ok {
+		issues = append(issues, l.newIssue(LintRuleDeprecatedAPIVersion, o.document, u, deprecatedAPI.Message()))
+	}
+	return issues
+}
+
+//enabled returns the issues of the rules which are not disabled
+func (l *linter) enabled(issues LintIssues) LintIssues {
+	disabled := make(map[string]bool)
+	for _, rule := range l.config.DisabledRules {
+		disabled[rule] = true
+	}
+	enabled := make(LintIssues, 0, len(issues))
+	for _, issue := range issues {
+		if !disabled[issue.Rule] {
+			enabled = append(enabled, issue)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,165 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+func TestApplier_Lint(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("namespace.yaml", []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-ns
+  namespace: default
+  labels:
+    app: my-app
+`))
+	reader.AddAsset("configmaps.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+  namespace: my-ns
+  labels:
+    app: my-app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+  namespace: my-ns
+  labels:
+    app: my-app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-other-cm
+`))
+	reader.AddAsset("crd.yaml", []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+  labels:
+    app: my-app
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Cluster
+`))
+	reader.AddAsset("widget.yaml", []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-widget
+  labels:
+    app: my-app
+---
+apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: my-gadget
+  namespace: my-ns
+  labels:
+    app: my-app
+`))
+	reader.AddAsset("pdb.yaml", []byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: my-pdb
+  namespace: my-ns
+  labels:
+    app: my-app
+`))
+	reader.AddAsset("empty.yaml", []byte(`{{ if .Enabled }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-secret
+{{ end }}
+`))
+	files := []string{"namespace.yaml", "configmaps.yaml", "crd.yaml", "widget.yaml", "pdb.yaml", "empty.yaml"}
+	issue := func(rule, document, kind, namespace, name, message string) string {
+		return LintIssue{
+			Rule:      rule,
+			Severity:  lintRuleSeverities[rule],
+			Document:  document,
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+			Message:   message,
+		}.String()
+	}
+	tests := []struct {
+		name       string
+		config     LintConfig
+		want       []string
+		wantErrors bool
+	}{
+		{
+			name:   "default",
+			config: LintConfig{RequiredLabels: []string{"app"}},
+			want: []string{
+				issue(LintRuleClusterScopedNamespace, "namespace.yaml", "Namespace", "default", "my-ns", "the object is cluster scoped and has a namespace"),
+				issue(LintRuleDuplicate, "configmaps.yaml#1", "ConfigMap", "my-ns", "my-cm", "the object is already defined in configmaps.yaml#0"),
+				issue(LintRuleMissingNamespace, "configmaps.yaml#2", "ConfigMap", "", "my-other-cm", "the object is namespaced and has no namespace"),
+				issue(LintRuleRequiredLabel, "configmaps.yaml#2", "ConfigMap", "", "my-other-cm", "the label app is missing"),
+				issue(LintRuleUnknownKind, "widget.yaml#1", "Gadget", "my-ns", "my-gadget", "the kind Gadget is not in the kinds order, not known and not defined by a CRD"),
+				issue(LintRuleDeprecatedAPIVersion, "pdb.yaml", "PodDisruptionBudget", "my-ns", "my-pdb", "policy/v1beta1 PodDisruptionBudget is deprecated since Kubernetes 1.21 and removed in 1.25, use policy/v1"),
+				issue(LintRuleEmptyAsset, "empty.yaml", "", "", "", "the file is empty after rendering and is skipped"),
+			},
+			wantErrors: true,
+		},
+		{
+			name: "config",
+			config: LintConfig{
+				KnownKinds:    []string{"Gadget"},
+				DisabledRules: []string{LintRuleDuplicate, LintRuleClusterScopedNamespace, LintRuleEmptyAsset},
+			},
+			want: []string{
+				issue(LintRuleMissingNamespace, "configmaps.yaml#2", "ConfigMap", "", "my-other-cm", "the object is namespaced and has no namespace"),
+				issue(LintRuleDeprecatedAPIVersion, "pdb.yaml", "PodDisruptionBudget", "my-ns", "my-pdb", "policy/v1beta1 PodDisruptionBudget is deprecated since Kubernetes 1.21 and removed in 1.25, use policy/v1"),
+			},
+			wantErrors: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := NewApplierBuilder().Build().Lint(reader, map[string]interface{}{}, "", tt.config, files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(issues))
+			for i, issue := range issues {
+				got[i] = issue.String()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %q, want %q", got, tt.want)
+			}
+			if issues.HasErrors() != tt.wantErrors {
+				t.Errorf("HasErrors() = %v, want %v", issues.HasErrors(), tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestParseLintConfig(t *testing.T) {
+	config, err := ParseLintConfig([]byte("requiredLabels:\n- app\ndisabledRules:\n- unknown-kind\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.RequiredLabels, []string{"app"}) {
+		t.Errorf("Expected the required label app got %v", config.RequiredLabels)
+	}
+	if _, err := ParseLintConfig([]byte("disabledRules:\n- not-a-rule\n")); err == nil {
+		t.Error("an unknown rule must be rejected")
+	}
+	if _, err := ParseLintConfig([]byte("requiredLabel:\n- app\n")); err == nil {
+		t.Error("an unknown field must be rejected")
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+//PatchTarget selects the objects to patch like the kustomize patch targets,
+//the empty fields match all objects.
+type PatchTarget struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	//Name and Namespace are regular expressions matching the whole name and namespace
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	//LabelSelector and AnnotationSelector are label selectors such as app=my-app,tier!=db
+	LabelSelector      string `json:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+//Patch is a strategic merge patch or a JSON 6902 patch applied to the rendered objects
+//matching its target. A strategic merge patch without target patches the object having
+//its apiVersion, kind, name and namespace.
+type Patch struct {
+	//Patch is a strategic merge patch object or a JSON 6902 array of operations, in YAML or JSON
+	Patch string `json:"patch"`
+	//Target selects the objects to patch, it is required for the JSON 6902 patches
+	Target *PatchTarget `json:"target,omitempty"`
+}
+
+//ParsePatches returns the patches of a YAML or JSON stream. A document containing a patch key
+//is a patch with an optional target like the kustomize patches entries, a document which is an array
+//contains such entries and the other documents are strategic merge patches.
+func ParsePatches(b []byte) ([]Patch, error) {
+	documents, err := helpers.SplitDocuments(b)
+	if err != nil {
+		return nil, err
+	}
+	patches := make([]Patch, 0, len(documents))
+	for _, document := range documents {
+		// A list of kustomize like entries
+		entries := make([]Patch, 0)
+		if err := yaml.Unmarshal(document, &entries); err == nil {
+			for _, entry := range entries {
+				if len(entry.Patch) == 0 {
+					return nil, fmt.Errorf("the patch entries require a patch, the JSON 6902 patches are set in the patch of an entry with a target")
+				}
+				if err := entry.validate(); err != nil {
+					return nil, err
+				}
+			}
+			patches = append(patches, entries...)
+			continue
+		}
+		m := make(map[string]interface{})
+		if err := yaml.Unmarshal(document, &m); err != nil {
+			return nil, err
+		}
+		patch := Patch{Patch: string(document)}
+		if _, ok := m["patch"]; ok {
+			patch = Patch{}
+			if err := yaml.Unmarshal(document, &patch); err != nil {
+				return nil, err
+			}
+		}
+		if err := patch.validate(); err != nil {
+			return nil, err
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+//LoadPatches returns the patches of the files
+func LoadPatches(paths ...string) ([]Patch, error) {
+	patches := make([]Patch, 0)
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+		filePatches, err := ParsePatches(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		patches = append(patches, filePatches...)
+	}
+	return patches, nil
+}
+
+//validate returns an error if the patch can not be applied
+func (p Patch) validate() error {
+	j, err := yaml.YAMLToJSON([]byte(p.Patch))
+	if err != nil {
+		return fmt.Errorf("invalid patch: %v", err)
+	}
+	if p.isJSON6902(j) {
+		if p.Target == nil {
+			return fmt.Errorf("the JSON 6902 patch %s requires a target", bytes.TrimSpace([]byte(p.Patch)))
+		}
+		if _, err := jsonpatch.DecodePatch(j); err != nil {
+			return fmt.Errorf("invalid JSON 6902 patch: %v", err)
+		}
+	}
+	if p.Target == nil {
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(j); err != nil || len(u.GetName()) == 0 {
+			return fmt.Errorf("the strategic merge patch %s requires an apiVersion, a kind and a name or a target", bytes.TrimSpace([]byte(p.Patch)))
+		}
+	}
+	if p.Target != nil {
+		if _, err := p.Target.matcher(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//isJSON6902 returns true if the patch is a list of operations
+func (p Patch) isJSON6902(j []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(j), []byte("["))
+}
+
+//PostRenderer returns the post-renderer applying the patch to the matching objects
+func (p Patch) PostRenderer() PostRenderer {
+	j, err := yaml.YAMLToJSON([]byte(p.Patch))
+	if err != nil {
+		return func(u *unstructured.Unstructured) error {
+			return fmt.Errorf("invalid patch: %v", err)
+		}
+	}
+	match, err := p.matcher(j)
+	if err != nil {
+		return func(u *unstructured.Unstructured) error {
+			return err
+		}
+	}
+	return func(u *unstructured.Unstructured) error {
+		if !match(u) {
+			return nil
+		}
+		return p.apply(j, u)
+	}
+}
+
+//matcher returns a function returning true if the object is selected by the patch target
+//or if it is the object of a strategic merge patch without target, a strategic merge patch
+//without namespace matches the object in any namespace.
+func (p Patch) matcher(j []byte) (func(u *unstructured.Unstructured) bool, error) {
+	if p.Target != nil {
+		return p.Target.matcher()
+	}
+	patch := &unstructured.Unstructured{}
+	if err := patch.UnmarshalJSON(j); err != nil {
+		return nil, err
+	}
+	return func(u *unstructured.Unstructured) bool {
+		return patch.GetAPIVersion() == u.GetAPIVersion() &&
+			patch.GetKind() == u.GetKind() &&
+			patch.GetName() == u.GetName() &&
+			(len(patch.GetNamespace()) == 0 || patch.GetNamespace() == u.GetNamespace())
+	}, nil
+}
+
+//apply applies the JSON patch to the object, the object is emptied by a strategic merge patch
+//with the $patch: delete directive.
+func (p Patch) apply(j []byte, u *unstructured.Unstructured) error {
+	original, err := u.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var patched []byte
+	if p.isJSON6902(j) {
+		operations, err := jsonpatch.DecodePatch(j)
+		if err != nil {
+			return err
+		}
+		patched, err = operations.Apply(original)
+		if err != nil {
+			return fmt.Errorf("failed to apply the JSON 6902 patch: %v", err)
+		}
+	} else {
+		patched, err = strategicMergePatch(u.GroupVersionKind(), original, j, p.Target != nil)
+		if err != nil {
+			return fmt.Errorf("failed to apply the strategic merge patch: %v", err)
+		}
+	}
+	object := make(map[string]interface{})
+	if err := json.Unmarshal(patched, &object); err != nil {
+		return err
+	}
+	u.Object = object
+	return nil
+}
+
+//strategicMergePatch applies a strategic merge patch, the patch strategies are the ones of the
+//built-in types and the patch is merged like a JSON merge patch for the other types.
+//With a target the name and namespace of the patch are ignored.
+func strategicMergePatch(gvk schema.GroupVersionKind, original, patch []byte, withTarget bool) ([]byte, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(patch, &m); err != nil {
+		return nil, err
+	}
+	// The object is removed like with kustomize
+	if m["$patch"] == "delete" {
+		return []byte("{}"), nil
+	}
+	if withTarget {
+		if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "name")
+			delete(metadata, "namespace")
+		}
+		var err error
+		patch, err = json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if obj, err := scheme.Scheme.New(gvk); err == nil {
+		return strategicpatch.StrategicMergePatch(original, patch, obj)
+	}
+	return jsonpatch.MergePatch(original, patch)
+}
+
+//matcher returns a function returning true if the object matches the target
+func (t PatchTarget) matcher() (func(u *unstructured.Unstructured) bool, error) {
+	name, err := regexp.Compile("^(?:" + t.Name + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid target name %q: %v", t.Name, err)
+	}
+	namespace, err := regexp.Compile("^(?:" + t.Namespace + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid target namespace %q: %v", t.Namespace, err)
+	}
+	labelSelector, err := labels.Parse(t.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target label selector %q: %v", t.LabelSelector, err)
+	}
+	annotationSelector, err := labels.Parse(t.AnnotationSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target annotation selector %q: %v", t.AnnotationSelector, err)
+	}
+	return func(u *unstructured.Unstructured) bool {
+		gvk := u.GroupVersionKind()
+		return (len(t.Group) == 0 || t.Group == gvk.Group) &&
+			(len(t.Version) == 0 || t.Version == gvk.Version) &&
+			(len(t.Kind) == 0 || t.Kind == gvk.Kind) &&
+			(len(t.Name) == 0 || name.MatchString(u.GetName())) &&
+			(len(t.Namespace) == 0 || namespace.MatchString(u.GetNamespace())) &&
+			labelSelector.Matches(labels.Set(u.GetLabels())) &&
+			annotationSelector.Matches(labels.Set(u.GetAnnotations()))
+	}, nil
+}
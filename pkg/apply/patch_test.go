@@ -0,0 +1,272 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplier_Patches(t *testing.T) {
+	b, err := ioutil.ReadFile("../../test/unit/resources/patches/patches.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := ParsePatches(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: my-image
+        env:
+        - name: LOG
+          value: debug
+      - name: sidecar
+        image: sidecar-image
+`))
+	reader.AddAsset("configmaps.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: frontend
+  labels:
+    tier: frontend
+data:
+  a: b
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: backend
+  labels:
+    tier: backend
+data:
+  a: b
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: debug
+`))
+	reader.AddAsset("myresource.yaml", []byte(`apiVersion: example.com/v1
+kind: MyResource
+metadata:
+  name: my-resource
+spec:
+  size: small
+  replicas: 1
+`))
+	want := []string{
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-deployment\nspec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n      - env:\n        - name: ENV\n          value: prod\n        - name: LOG\n          value: debug\n        image: my-image\n        name: app\n      - image: sidecar-image\n        name: sidecar\n",
+		"apiVersion: v1\ndata:\n  a: b\n  env: prod\nkind: ConfigMap\nmetadata:\n  labels:\n    tier: frontend\n  name: frontend\n",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: backend\n  labels:\n    tier: backend\ndata:\n  a: b\n",
+		"apiVersion: example.com/v1\nkind: MyResource\nmetadata:\n  name: my-resource\nspec:\n  replicas: 1\n  size: large\n",
+	}
+	tests := []struct {
+		name    string
+		applier Applier
+	}{
+		{
+			name:    "builder",
+			applier: NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).WithPatches(patches...).Build(),
+		},
+		{
+			name:    "applier",
+			applier: NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).Build().WithPatches(patches[:2]...).WithPatches(patches[2:]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.applier.MustTemplateAssets(reader, nil, "", "deployment.yaml", "configmaps.yaml", "myresource.yaml")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	failing := Patch{
+		Patch:  `[{"op": "replace", "path": "/spec/missing/field", "value": 1}]`,
+		Target: &PatchTarget{Kind: "MyResource"},
+	}
+	a := NewApplierBuilder().WithPatches(failing).Build()
+	if _, err := a.MustTemplateAssets(reader, nil, "", "myresource.yaml"); err == nil {
+		t.Errorf("MustTemplateAssets() must fail when a patch can not be applied")
+	}
+}
+
+func TestPatch_PostRendererNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		patch     string
+		namespace string
+		want      bool
+	}{
+		{
+			name:      "no namespace matches any namespace",
+			patch:     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\ndata:\n  a: c\n",
+			namespace: "my-ns",
+			want:      true,
+		},
+		{
+			name:      "same namespace",
+			patch:     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\n  namespace: my-ns\ndata:\n  a: c\n",
+			namespace: "my-ns",
+			want:      true,
+		},
+		{
+			name:      "other namespace",
+			patch:     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\n  namespace: other-ns\ndata:\n  a: c\n",
+			namespace: "my-ns",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{}
+			u.SetAPIVersion("v1")
+			u.SetKind("ConfigMap")
+			u.SetName("my-cm")
+			u.SetNamespace(tt.namespace)
+			u.Object["data"] = map[string]interface{}{"a": "b"}
+			if err := (Patch{Patch: tt.patch}).PostRenderer()(u); err != nil {
+				t.Fatal(err)
+			}
+			if got := u.Object["data"].(map[string]interface{})["a"] == "c"; got != tt.want {
+				t.Errorf("patched = %v, want %v", got, tt.want)
+			}
+			if u.GetNamespace() != tt.namespace {
+				t.Errorf("namespace = %s, want %s", u.GetNamespace(), tt.namespace)
+			}
+		})
+	}
+}
+
+func TestParsePatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		patches string
+		want    []Patch
+		wantErr bool
+	}{
+		{
+			name:    "strategic merge patch",
+			patches: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\ndata:\n  a: b\n",
+			want:    []Patch{{Patch: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-cm\ndata:\n  a: b\n"}},
+		},
+		{
+			name:    "entry",
+			patches: "target:\n  kind: ConfigMap\n  name: my-.*\npatch: '[{\"op\": \"remove\", \"path\": \"/data\"}]'\n",
+			want:    []Patch{{Patch: `[{"op": "remove", "path": "/data"}]`, Target: &PatchTarget{Kind: "ConfigMap", Name: "my-.*"}}},
+		},
+		{
+			name:    "JSON entries",
+			patches: `[{"target": {"labelSelector": "app=my-app"}, "patch": "metadata:\n  labels:\n    env: prod\n"}]`,
+			want:    []Patch{{Patch: "metadata:\n  labels:\n    env: prod\n", Target: &PatchTarget{LabelSelector: "app=my-app"}}},
+		},
+		{
+			name:    "JSON 6902 patch without target",
+			patches: "patch: '[{\"op\": \"remove\", \"path\": \"/data\"}]'\n",
+			wantErr: true,
+		},
+		{
+			name:    "operations without entry",
+			patches: "- op: remove\n  path: /data\n",
+			wantErr: true,
+		},
+		{
+			name:    "strategic merge patch without name",
+			patches: "apiVersion: v1\nkind: ConfigMap\ndata:\n  a: b\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid label selector",
+			patches: "target:\n  labelSelector: 'app in ('\npatch: 'data: {}'\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			patches: "target:\n  name: 'my-(.*'\npatch: 'data: {}'\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePatches([]byte(tt.patches))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePatches() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePatches() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPatches(t *testing.T) {
+	invalidPath := filepath.Join(t.TempDir(), "invalid.yaml")
+	if err := ioutil.WriteFile(invalidPath, []byte("- target:\n    kind: ConfigMap\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		paths       []string
+		wantPatches int
+		wantErr     string
+	}{
+		{
+			name: "no file",
+		},
+		{
+			name:        "files",
+			paths:       []string{"../../test/unit/resources/patches/patches.yaml", "../../test/unit/resources/patches/patches.yaml"},
+			wantPatches: 8,
+		},
+		{
+			name:    "missing file",
+			paths:   []string{"../../test/unit/resources/patches/missing.yaml"},
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "invalid file",
+			paths:   []string{invalidPath},
+			wantErr: invalidPath + ": ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := LoadPatches(tt.paths...)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected an error containing %q got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(patches) != tt.wantPatches {
+				t.Errorf("Expected %d patches got %d", tt.wantPatches, len(patches))
+			}
+		})
+	}
+}
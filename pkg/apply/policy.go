@@ -0,0 +1,359 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+//PolicyMode defines what happens when a rendered object violates a policy rule
+type PolicyMode string
+
+const (
+	//PolicyEnforce fails the rendering and nothing is applied or returned
+	PolicyEnforce PolicyMode = "enforce"
+	//PolicyWarn logs the violations as warnings
+	PolicyWarn PolicyMode = "warn"
+)
+
+//The built-in policy rules
+const (
+	//PolicyRuleNoPrivileged reports the privileged containers
+	PolicyRuleNoPrivileged = "no-privileged"
+	//PolicyRuleNoHostPath reports the hostPath volumes
+	PolicyRuleNoHostPath = "no-host-path"
+	//PolicyRuleNoLatestImage reports the images with the latest tag or without tag
+	PolicyRuleNoLatestImage = "no-latest-image"
+)
+
+//PolicyRule checks a rendered object
+type PolicyRule interface {
+	//Name returns the name of the rule reported with the violations
+	Name() string
+	//Check returns the violation messages of the object, none if the object complies with the rule
+	Check(u *unstructured.Unstructured) ([]string, error)
+}
+
+//Policy checks the rendered objects against its rules
+type Policy struct {
+	Mode  PolicyMode
+	Rules []PolicyRule
+}
+
+//NewPolicy returns a policy checking the rules, the mode is enforce or warn
+func NewPolicy(mode PolicyMode, rules ...PolicyRule) (*Policy, error) {
+	switch mode {
+	case PolicyEnforce, PolicyWarn:
+	default:
+		return nil, fmt.Errorf("unsupported policy mode %q, the mode must be %s or %s", mode, PolicyEnforce, PolicyWarn)
+	}
+	return &Policy{
+		Mode:  mode,
+		Rules: rules,
+	}, nil
+}
+
+//PolicyViolation is a violation of a policy rule by a rendered object
+type PolicyViolation struct {
+	Rule string
+	//Document is the name of the rendered document, for example file.yaml#1
+	Document  string
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+}
+
+//File returns the source file of the document
+func (v PolicyViolation) File() string {
+	return helpers.SourceFile(v.Document)
+}
+
+func (v PolicyViolation) Error() string {
+	name := v.Name
+	if len(v.Namespace) != 0 {
+		name = v.Namespace + "/" + v.Name
+	}
+	return fmt.Sprintf("%s: %s %s: %s (%s)", v.Document, v.Kind, name, v.Message, v.Rule)
+}
+
+//PolicyViolations are the violations of the rendered objects
+type PolicyViolations []PolicyViolation
+
+func (v PolicyViolations) Error() string {
+	messages := make([]string, len(v))
+	for i, violation := range v {
+		messages[i] = violation.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+//Check returns the violations of the rendered documents
+func (p *Policy) Check(documents []helpers.Document) (PolicyViolations, error) {
+	violations := make(PolicyViolations, 0)
+	for _, document := range documents {
+		u, err := documentToUnstructured(document.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", document.Name, err)
+		}
+		for _, rule := range p.Rules {
+			messages, err := rule.Check(u)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %s: %v", document.Name, rule.Name(), err)
+			}
+			for _, message := range messages {
+				violations = append(violations, PolicyViolation{
+					Rule:      rule.Name(),
+					Document:  document.Name,
+					Kind:      u.GetKind(),
+					Namespace: u.GetNamespace(),
+					Name:      u.GetName(),
+					Message:   message,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+//checkPolicy checks the rendered documents against the policy of the applier,
+//the violations are returned as error in enforce mode and logged in warn mode.
+func (a Applier) checkPolicy(documents []helpers.Document) error {
+	if a.policy == nil {
+		return nil
+	}
+	violations, err := a.policy.Check(documents)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	if a.policy.Mode == PolicyWarn {
+		for _, violation := range violations {
+			klog.Warning(violation.Error())
+		}
+		return nil
+	}
+	return violations
+}
+
+//BuiltinPolicyRules returns the built-in rules: no-privileged, no-host-path and no-latest-image
+func BuiltinPolicyRules() []PolicyRule {
+	return []PolicyRule{
+		containerRule{name: PolicyRuleNoPrivileged, check: checkPrivileged},
+		hostPathRule{},
+		containerRule{name: PolicyRuleNoLatestImage, check: checkLatestImage},
+	}
+}
+
+//containerRule checks each container and init container of the workloads
+type containerRule struct {
+	name  string
+	check func(container map[string]interface{}) (string, bool)
+}
+
+func (r containerRule) Name() string {
+	return r.name
+}
+
+func (r containerRule) Check(u *unstructured.Unstructured) ([]string, error) {
+	messages := make([]string, 0)
+	err := visitContainers(u, func(container map[string]interface{}) bool {
+		if message, violated := r.check(container); violated {
+			messages = append(messages, message)
+		}
+		return false
+	})
+	return messages, err
+}
+
+func checkPrivileged(container map[string]interface{}) (string, bool) {
+	privileged, _, _ := unstructured.NestedBool(container, "securityContext", "privileged")
+	return fmt.Sprintf("the container %v is privileged", container["name"]), privileged
+}
+
+func checkLatestImage(container map[string]interface{}) (string, bool) {
+	image, ok := container["image"].(string)
+	if !ok {
+		return "", false
+	}
+	_, tag, digest := splitImage(image)
+	return fmt.Sprintf("the container %v uses the image %s without a pinned tag", container["name"], image),
+		len(digest) == 0 && (len(tag) == 0 || tag == "latest")
+}
+
+//hostPathRule checks the volumes of the workloads
+type hostPathRule struct{}
+
+func (r hostPathRule) Name() string {
+	return PolicyRuleNoHostPath
+}
+
+func (r hostPathRule) Check(u *unstructured.Unstructured) ([]string, error) {
+	podSpecPath, ok := podSpecPaths[u.GetKind()]
+	if !ok {
+		return nil, nil
+	}
+	volumes, _, err := unstructured.NestedSlice(u.Object, append(append([]string{}, podSpecPath...), "volumes")...)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]string, 0)
+	for _, v := range volumes {
+		volume, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := volume["hostPath"]; ok {
+			messages = append(messages, fmt.Sprintf("the volume %v is a hostPath volume", volume["name"]))
+		}
+	}
+	return messages, nil
+}
+
+//CELPolicyRule is a rule evaluating a CEL expression, the rendered object is the object variable
+//and the object complies with the rule if the expression is true.
+type CELPolicyRule struct {
+	name string
+	//kinds are the checked kinds, all kinds if empty
+	kinds   map[string]bool
+	message string
+	program cel.Program
+}
+
+//NewCELPolicyRule compiles the expression of a rule checking the objects of the kinds,
+//all objects if no kind is provided. The message is reported when the expression is false.
+func NewCELPolicyRule(name, expression, message string, kinds ...string) (*CELPolicyRule, error) {
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("object", decls.Dyn)))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("rule %s: %v", name, issues.Err())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %v", name, err)
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("the expression %s is false", expression)
+	}
+	rule := &CELPolicyRule{
+		name:    name,
+		kinds:   make(map[string]bool),
+		message: message,
+		program: program,
+	}
+	for _, kind := range kinds {
+		rule.kinds[kind] = true
+	}
+	return rule, nil
+}
+
+func (r *CELPolicyRule) Name() string {
+	return r.name
+}
+
+//Check evaluates the expression, an evaluation error such as a missing field is a violation
+func (r *CELPolicyRule) Check(u *unstructured.Unstructured) ([]string, error) {
+	if len(r.kinds) != 0 && !r.kinds[u.GetKind()] {
+		return nil, nil
+	}
+	val, _, err := r.program.Eval(map[string]interface{}{"object": u.Object})
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", r.message, err)}, nil
+	}
+	compliant, ok := val.Value().(bool)
+	if !ok {
+		return nil, fmt.Errorf("the expression returns %v and not a bool", val.Value())
+	}
+	if compliant {
+		return nil, nil
+	}
+	return []string{r.message}, nil
+}
+
+//celPolicyRules is the format of a CEL policy rules file
+type celPolicyRules struct {
+	Rules []struct {
+		Name       string   `json:"name"`
+		Kinds      []string `json:"kinds,omitempty"`
+		Expression string   `json:"expression"`
+		Message    string   `json:"message,omitempty"`
+	} `json:"rules"`
+}
+
+//ParsePolicyRules parses a YAML or JSON file of CEL rules, for example:
+//
+//  rules:
+//  - name: replicas
+//    kinds:
+//    - Deployment
+//    expression: object.spec.replicas <= 5
+//    message: the deployments must not have more than 5 replicas
+func ParsePolicyRules(b []byte) ([]PolicyRule, error) {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	file := &celPolicyRules{}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil && err != io.EOF {
+		return nil, err
+	}
+	rules := make([]PolicyRule, 0, len(file.Rules))
+	for i, r := range file.Rules {
+		if len(r.Name) == 0 || len(r.Expression) == 0 {
+			return nil, fmt.Errorf("the rule %d must have a name and an expression", i)
+		}
+		rule, err := NewCELPolicyRule(r.Name, r.Expression, r.Message, r.Kinds...)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+//LoadPolicy returns a policy checking the built-in rules if builtin is set and the rules of the files,
+//nil if there is no rule. The mode defaults to enforce.
+func LoadPolicy(mode PolicyMode, builtin bool, paths ...string) (*Policy, error) {
+	rules := make([]PolicyRule, 0)
+	if builtin {
+		rules = append(rules, BuiltinPolicyRules()...)
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+		fileRules, err := ParsePolicyRules(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		rules = append(rules, fileRules...)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if len(mode) == 0 {
+		mode = PolicyEnforce
+	}
+	return NewPolicy(mode, rules...)
+}
@@ -0,0 +1,333 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplier_WithPolicy(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+  namespace: my-ns
+spec:
+  replicas: {{ .Replicas }}
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: app
+        image: quay.io/app:1.0
+        securityContext:
+          privileged: true
+      - name: sidecar
+        image: quay.io/sidecar:latest
+      volumes:
+      - name: host
+        hostPath:
+          path: /var/run
+      - name: config
+        configMap:
+          name: my-cm
+`))
+	reader.AddAsset("pod.yaml", []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: my-pod
+  namespace: my-ns
+spec:
+  containers:
+  - name: app
+    image: quay.io/app@sha256:2d3a1b7c1c6e2f64cf0dd4d1a9b1b4b5b4e4d2b4d5d8a6e0a0b3c8d1e7f9a4c2
+`))
+	replicasRule, err := NewCELPolicyRule("max-replicas", "object.spec.replicas <= 3", "the deployments must not have more than 3 replicas", "Deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		mode           PolicyMode
+		rules          []PolicyRule
+		values         map[string]interface{}
+		wantViolations []string
+	}{
+		{
+			name:   "builtin enforce",
+			mode:   PolicyEnforce,
+			rules:  BuiltinPolicyRules(),
+			values: map[string]interface{}{"Replicas": 1},
+			wantViolations: []string{
+				"deployment.yaml: Deployment my-ns/my-deployment: the container app is privileged (no-privileged)",
+				"deployment.yaml: Deployment my-ns/my-deployment: the volume host is a hostPath volume (no-host-path)",
+				"deployment.yaml: Deployment my-ns/my-deployment: the container init uses the image busybox without a pinned tag (no-latest-image)",
+				"deployment.yaml: Deployment my-ns/my-deployment: the container sidecar uses the image quay.io/sidecar:latest without a pinned tag (no-latest-image)",
+			},
+		},
+		{
+			name:   "cel enforce",
+			mode:   PolicyEnforce,
+			rules:  []PolicyRule{replicasRule},
+			values: map[string]interface{}{"Replicas": 5},
+			wantViolations: []string{
+				"deployment.yaml: Deployment my-ns/my-deployment: the deployments must not have more than 3 replicas (max-replicas)",
+			},
+		},
+		{
+			name:   "cel compliant",
+			mode:   PolicyEnforce,
+			rules:  []PolicyRule{replicasRule},
+			values: map[string]interface{}{"Replicas": 2},
+		},
+		{
+			name:   "builtin warn",
+			mode:   PolicyWarn,
+			rules:  BuiltinPolicyRules(),
+			values: map[string]interface{}{"Replicas": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.mode, tt.rules...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := NewApplierBuilder().WithPolicy(policy).Build().
+				MustTemplateAssets(reader, tt.values, "", "deployment.yaml", "pod.yaml")
+			if len(tt.wantViolations) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(output) != 2 {
+					t.Errorf("Expected 2 rendered objects got %d", len(output))
+				}
+				return
+			}
+			var violations PolicyViolations
+			if !errors.As(err, &violations) {
+				t.Fatalf("Expected a PolicyViolations error got %v", err)
+			}
+			got := make([]string, len(violations))
+			for i, violation := range violations {
+				got[i] = violation.Error()
+			}
+			if !reflect.DeepEqual(got, tt.wantViolations) {
+				t.Errorf("Expected %q got %q", tt.wantViolations, got)
+			}
+		})
+	}
+}
+
+func TestParsePolicyRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name: "rules",
+			rules: `rules:
+- name: max-replicas
+  kinds:
+  - Deployment
+  expression: object.spec.replicas <= 3
+- name: team-label
+  expression: "'team' in object.metadata.labels"
+  message: the objects must have a team label
+`,
+			wantNames: []string{"max-replicas", "team-label"},
+		},
+		{
+			name: "invalid expression",
+			rules: `rules:
+- name: invalid
+  expression: object.spec.replicas <=
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing expression",
+			rules: `rules:
+- name: missing
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			rules: `rules:
+- name: unknown
+  expresion: "true"
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParsePolicyRules([]byte(tt.rules))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicyRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			names := make([]string, len(rules))
+			for i, rule := range rules {
+				names[i] = rule.Name()
+			}
+			if !tt.wantErr && !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("Expected %v got %v", tt.wantNames, names)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	rulesPath := filepath.Join(dir, "rules.yaml")
+	if err := ioutil.WriteFile(rulesPath, []byte(`rules:
+- name: max-replicas
+  expression: object.spec.replicas <= 3
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		mode      PolicyMode
+		builtin   bool
+		paths     []string
+		wantNil   bool
+		wantMode  PolicyMode
+		wantRules int
+		wantErr   bool
+	}{
+		{
+			name:    "no rule",
+			wantNil: true,
+		},
+		{
+			name:      "default mode",
+			paths:     []string{rulesPath},
+			wantMode:  PolicyEnforce,
+			wantRules: 1,
+		},
+		{
+			name:      "builtin rules and files",
+			mode:      PolicyWarn,
+			builtin:   true,
+			paths:     []string{rulesPath},
+			wantMode:  PolicyWarn,
+			wantRules: len(BuiltinPolicyRules()) + 1,
+		},
+		{
+			name:    "missing file",
+			paths:   []string{filepath.Join(dir, "missing.yaml")},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported mode",
+			mode:    "audit",
+			builtin: true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := LoadPolicy(tt.mode, tt.builtin, tt.paths...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if policy != nil {
+					t.Errorf("Expected no policy got %v", policy)
+				}
+				return
+			}
+			if policy.Mode != tt.wantMode || len(policy.Rules) != tt.wantRules {
+				t.Errorf("Expected the mode %s and %d rules got %s and %d rules", tt.wantMode, tt.wantRules, policy.Mode, len(policy.Rules))
+			}
+		})
+	}
+}
+
+func TestApplier_LintPolicy(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+  namespace: my-ns
+`))
+	rule, err := NewCELPolicyRule("team-label", "has(object.metadata.labels) && 'team' in object.metadata.labels", "the objects must have a team label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []PolicyMode{PolicyEnforce, PolicyWarn} {
+		policy, err := NewPolicy(mode, rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issues, err := NewApplierBuilder().WithPolicy(policy).Build().
+			Lint(reader, map[string]interface{}{}, "", LintConfig{}, "configmap.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 1 || issues[0].Rule != LintRulePolicy || issues[0].Message != "team-label: the objects must have a team label" {
+			t.Fatalf("Expected the policy issue got %v", issues)
+		}
+		if issues.HasErrors() != (mode == PolicyEnforce) {
+			t.Errorf("Expected the %s mode to report errors %v", mode, mode == PolicyEnforce)
+		}
+	}
+}
+
+func TestApplier_ApplyDeploymentPolicy(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+  namespace: my-ns
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/app:1.0
+        securityContext:
+          privileged: true
+`))
+	policy, err := NewPolicy(PolicyEnforce, BuiltinPolicyRules()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := kubefake.NewSimpleClientset()
+	applier := NewApplierBuilder().
+		WithClient(kubeClient, apiextensionsfake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())).
+		WithPolicy(policy).
+		Build()
+	_, err = applier.ApplyDeployment(reader, map[string]interface{}{}, false, "", "deployment.yaml")
+	var violations PolicyViolations
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected a PolicyViolations error got %v", err)
+	}
+	if _, err := kubeClient.AppsV1().Deployments("my-ns").Get(context.TODO(), "my-deployment", metav1.GetOptions{}); err == nil {
+		t.Error("The deployment violating the policy must not be applied")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//PostRenderer mutates a rendered object, the post-renderers are called in order on each
+//rendered document after the owner reference is added. The document is removed if a
+//post-renderer empties the object.
+type PostRenderer func(*unstructured.Unstructured) error
+
+//ExecPostRenderer runs an executable receiving all rendered documents as a YAML stream
+//on its standard input and writing the modified documents on its standard output,
+//like the helm post-renderers.
+type ExecPostRenderer struct {
+	binaryPath string
+	args       []string
+}
+
+//NewExecPostRenderer returns an ExecPostRenderer running the executable with the args,
+//the executable is searched in the PATH if the binaryPath doesn't contain a path separator.
+func NewExecPostRenderer(binaryPath string, args ...string) (*ExecPostRenderer, error) {
+	path, err := exec.LookPath(binaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer %q not found: %w", binaryPath, err)
+	}
+	return &ExecPostRenderer{
+		binaryPath: path,
+		args:       args,
+	}, nil
+}
+
+//Run runs the executable with the manifests on its standard input and returns its standard output
+func (p *ExecPostRenderer) Run(ctx context.Context, manifests []byte) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := exec.CommandContext(ctx, p.binaryPath, p.args...)
+	cmd.Stdin = bytes.NewReader(manifests)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("post-renderer %s failed: %v: %s", p.binaryPath, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+//postRenderDocuments applies the patches, runs the post-renderers and overrides the images on each document,
+//the documents emptied by a patch or a post-renderer are removed.
+func (a Applier) postRenderDocuments(documents []helpers.Document) ([]helpers.Document, error) {
+	if len(a.postRenderers) == 0 && len(a.patches) == 0 && len(a.imageOverrides) == 0 {
+		return documents, nil
+	}
+	// The patches are applied before the post-renderers
+	postRenderers := make([]PostRenderer, 0, len(a.patches)+len(a.postRenderers)+1)
+	for _, patch := range a.patches {
+		postRenderers = append(postRenderers, patch.PostRenderer())
+	}
+	postRenderers = append(postRenderers, a.postRenderers...)
+	// The images added by the patches and the post-renderers are overridden too,
+	// with an exec post-renderer they are overridden after it by finalizeDocuments
+	if len(a.imageOverrides) != 0 && a.execPostRenderer == nil {
+		postRenderers = append(postRenderers, imageOverridesPostRenderer(a.imageOverrides))
+	}
+	rendered := make([]helpers.Document, 0, len(documents))
+	for _, document := range documents {
+		content, err := postRender(postRenderers, document.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", document.Name, err)
+		}
+		if content == nil {
+			continue
+		}
+		rendered = append(rendered, helpers.Document{Name: document.Name, Content: content})
+	}
+	return rendered, nil
+}
+
+//postRender runs the post-renderers on a document, the format of the document is preserved.
+//nil is returned if a post-renderer emptied the object.
+func postRender(postRenderers []PostRenderer, b []byte) ([]byte, error) {
+	j, err := asset.ToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(j); err != nil {
+		return nil, err
+	}
+	original := u.DeepCopy()
+	for _, postRenderer := range postRenderers {
+		if err := postRenderer(u); err != nil {
+			return nil, err
+		}
+		if len(u.Object) == 0 {
+			return nil, nil
+		}
+	}
+	// The document is kept as is if it is not modified
+	if reflect.DeepEqual(original.Object, u.Object) {
+		return b, nil
+	}
+	return marshalDocument(u, b)
+}
+
+//marshalDocument marshals the object in the format of the original document
+func marshalDocument(u *unstructured.Unstructured, original []byte) ([]byte, error) {
+	j, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if helpers.IsJSON(original) {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, j, "", "  "); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return yaml.JSONToYAML(j)
+}
+
+//runExecPostRenderer pipes the documents to the exec post-renderer and returns the documents it writes.
+//A returned document keeps the name of the document having the same apiVersion, kind, namespace and name,
+//the new documents are named after the post-renderer and their index.
+func (a Applier) runExecPostRenderer(documents []helpers.Document) ([]helpers.Document, error) {
+	if a.execPostRenderer == nil {
+		return documents, nil
+	}
+	var manifests bytes.Buffer
+	names := make(map[string]string, len(documents))
+	for _, document := range documents {
+		manifests.WriteString("---\n")
+		manifests.Write(document.Content)
+		if !bytes.HasSuffix(document.Content, []byte("\n")) {
+			manifests.WriteString("\n")
+		}
+		key := objectKey(document.Content)
+		if _, ok := names[key]; !ok {
+			names[key] = document.Name
+		}
+	}
+	out, err := a.execPostRenderer.Run(a.context, manifests.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	postRendererName := filepath.Base(a.execPostRenderer.binaryPath)
+	split, err := helpers.SplitFile(postRendererName, out)
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer %s: %v", postRendererName, err)
+	}
+	rendered := make([]helpers.Document, 0, len(split))
+	for i, document := range split {
+		name := helpers.DocumentName(postRendererName, i)
+		key := objectKey(document.Content)
+		if n, ok := names[key]; ok {
+			name = n
+			// A name is used once
+			delete(names, key)
+		}
+		rendered = append(rendered, helpers.Document{Name: name, Content: document.Content})
+	}
+	return rendered, nil
+}
+
+//objectKey returns the apiVersion, kind, namespace and name of an object
+func objectKey(b []byte) string {
+	u := struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}{}
+	if err := yaml.Unmarshal(b, &u); err != nil {
+		return ""
+	}
+	return strings.Join([]string{u.APIVersion, u.Kind, u.Metadata.Namespace, u.Metadata.Name}, "/")
+}
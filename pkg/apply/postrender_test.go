@@ -0,0 +1,202 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func postRendererReader() *asset.MemFS {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: old-image
+`))
+	reader.AddAsset("configmaps.yaml", []byte(`{{- range .Names }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ . }}
+{{- end }}
+`))
+	reader.AddAsset("service.json", []byte(`{
+  "apiVersion": "v1",
+  "kind": "Service",
+  "metadata": {"name": "my-service"}
+}
+`))
+	return reader
+}
+
+func TestApplier_PostRenderer(t *testing.T) {
+	values := map[string]interface{}{"Names": []interface{}{"cm-1", "cm-2"}}
+	addLabel := func(u *unstructured.Unstructured) error {
+		labels := u.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["team"] = "my-team"
+		u.SetLabels(labels)
+		return nil
+	}
+	addSidecar := func(u *unstructured.Unstructured) error {
+		if u.GetKind() != "Deployment" {
+			return nil
+		}
+		containers, _, err := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+		if err != nil {
+			return err
+		}
+		containers = append(containers, map[string]interface{}{"name": "sidecar", "image": "sidecar-image"})
+		return unstructured.SetNestedSlice(u.Object, containers, "spec", "template", "spec", "containers")
+	}
+	removeConfigMap := func(u *unstructured.Unstructured) error {
+		if u.GetKind() == "ConfigMap" && u.GetName() == "cm-1" {
+			u.Object = nil
+		}
+		return nil
+	}
+	tests := []struct {
+		name    string
+		applier Applier
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "chain",
+			applier: NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).WithPostRenderer(addLabel).WithPostRenderer(addSidecar, removeConfigMap).Build(),
+			want: []string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    team: my-team\n  name: my-deployment\nspec:\n  template:\n    spec:\n      containers:\n      - image: old-image\n        name: app\n      - image: sidecar-image\n        name: sidecar\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  labels:\n    team: my-team\n  name: cm-2\n",
+				"{\n  \"apiVersion\": \"v1\",\n  \"kind\": \"Service\",\n  \"metadata\": {\n    \"labels\": {\n      \"team\": \"my-team\"\n    },\n    \"name\": \"my-service\"\n  }\n}\n",
+			},
+		},
+		{
+			name:    "applier level",
+			applier: NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).Build().WithPostRenderer(removeConfigMap),
+			want: []string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-deployment\nspec:\n  template:\n    spec:\n      containers:\n      - name: app\n        image: old-image\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-2\n",
+				"{\n  \"apiVersion\": \"v1\",\n  \"kind\": \"Service\",\n  \"metadata\": {\"name\": \"my-service\"}\n}",
+			},
+		},
+		{
+			name: "error",
+			applier: NewApplierBuilder().WithPostRenderer(func(u *unstructured.Unstructured) error {
+				return fmt.Errorf("forbidden")
+			}).Build(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.applier.MustTemplateAssets(postRendererReader(), values, "", "deployment.yaml", "configmaps.yaml", "service.json")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MustTemplateAssets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MustTemplateAssets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_ExecPostRenderer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the post-renderer scripts require a shell")
+	}
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"replace.sh": "#!/bin/sh\nsed -e 's/old-image/new-image/'\n",
+		"add.sh":     "#!/bin/sh\ncat\nprintf -- '---\\napiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: added\\n'\n",
+		"fail.sh":    "#!/bin/sh\necho 'invalid manifests' >&2\nexit 1\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := map[string]interface{}{"Names": []interface{}{"cm-1"}}
+	tests := []struct {
+		name           string
+		script         string
+		imageOverrides map[string]string
+		wantNames      []string
+		wantContent    string
+		wantErr        bool
+	}{
+		{
+			name:        "replace",
+			script:      "replace.sh",
+			wantNames:   []string{"deployment.yaml", "configmaps.yaml", "service.json"},
+			wantContent: "image: new-image",
+		},
+		{
+			name:           "override the images written",
+			script:         "replace.sh",
+			imageOverrides: map[string]string{"new-image": "mirror.example.com/new-image:1.0"},
+			wantNames:      []string{"deployment.yaml", "configmaps.yaml", "service.json"},
+			wantContent:    "image: mirror.example.com/new-image:1.0",
+		},
+		{
+			name:      "add",
+			script:    "add.sh",
+			wantNames: []string{"deployment.yaml", "configmaps.yaml", "service.json", "add.sh#3"},
+		},
+		{
+			name:    "fail",
+			script:  "fail.sh",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postRenderer, err := NewExecPostRenderer(filepath.Join(dir, tt.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := NewApplierBuilder().WithKindOrder(NoCreateUpdateKindsOrder).WithExecPostRenderer(postRenderer).
+				WithImageOverrides(tt.imageOverrides).Build()
+			a, memFSReader, names, err := a.renderFiles(postRendererReader(), values, "", []string{"deployment.yaml", "configmaps.yaml", "service.json"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("renderFiles() names = %v, want %v", names, tt.wantNames)
+			}
+			got, err := a.MustTemplateAsset(memFSReader, values, "", "deployment.yaml")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !strings.Contains(string(got), tt.wantContent) {
+				t.Errorf("MustTemplateAsset() = %s, want %s", got, tt.wantContent)
+			}
+		})
+	}
+	if _, err := NewExecPostRenderer(filepath.Join(dir, "missing.sh")); err == nil {
+		t.Errorf("NewExecPostRenderer() must fail for a missing executable")
+	}
+}
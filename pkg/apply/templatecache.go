@@ -0,0 +1,181 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"text/template"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+//templateCache holds the compiled templates of an applier,
+//the templates are parsed only once.
+type templateCache struct {
+	mutex     sync.Mutex
+	templates map[string]*template.Template
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		templates: make(map[string]*template.Template),
+	}
+}
+
+//get returns the compiled template for the key, a nil cache never contains templates
+func (c *templateCache) get(key string) (*template.Template, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tmpl, ok := c.templates[key]
+	return tmpl, ok
+}
+
+func (c *templateCache) set(key string, tmpl *template.Template) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.templates[key] = tmpl
+}
+
+//renderCache holds the rendered templates of a single Apply, ApplyDirectly... call,
+//as the values are the same during the call, a template is rendered only once
+//between the sort pass and the apply pass.
+//It also holds the readers containing the documents split from the rendered templates,
+//these documents are not rendered again.
+type renderCache struct {
+	mutex    sync.Mutex
+	rendered map[string][]byte
+	//documentsReaders are the readers containing the rendered documents
+	documentsReaders []*asset.MemFS
+	//emptyAssets are the files skipped as they are empty after rendering
+	emptyAssets []string
+	//capabilities are computed once per call
+	capabilitiesOnce sync.Once
+	capabilities     *Capabilities
+	capabilitiesErr  error
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{
+		rendered: make(map[string][]byte),
+	}
+}
+
+//get returns the rendered template for the key, a nil cache never contains rendered templates
+func (c *renderCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	b, ok := c.rendered[key]
+	return b, ok
+}
+
+func (c *renderCache) set(key string, b []byte) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rendered[key] = b
+}
+
+//addDocumentsReader records a reader containing rendered documents
+func (c *renderCache) addDocumentsReader(reader *asset.MemFS) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.documentsReaders = append(c.documentsReaders, reader)
+}
+
+//addEmptyAsset records a file skipped as it is empty after rendering
+func (c *renderCache) addEmptyAsset(name string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.emptyAssets = asset.AppendItNotExists(c.emptyAssets, name)
+}
+
+//getEmptyAssets returns the files skipped as they are empty after rendering
+func (c *renderCache) getEmptyAssets() []string {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string{}, c.emptyAssets...)
+}
+
+//documentsReader returns the reader if it contains rendered documents
+func (c *renderCache) documentsReader(reader asset.ScenarioReader) (*asset.MemFS, bool) {
+	if c == nil {
+		return nil, false
+	}
+	memFSReader, ok := reader.(*asset.MemFS)
+	if !ok {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, r := range c.documentsReaders {
+		if r == memFSReader {
+			return memFSReader, true
+		}
+	}
+	return nil, false
+}
+
+//getCapabilities returns the capabilities computed once with get, a nil cache always calls get
+func (c *renderCache) getCapabilities(get func() (*Capabilities, error)) (*Capabilities, error) {
+	if c == nil {
+		return get()
+	}
+	c.capabilitiesOnce.Do(func() {
+		c.capabilities, c.capabilitiesErr = get()
+	})
+	return c.capabilities, c.capabilitiesErr
+}
+
+//withRenderCache returns a copy of the applier with a new render cache
+//if it doesn't have one yet.
+func (a Applier) withRenderCache() Applier {
+	if a.renderCache != nil {
+		return a
+	}
+	applier := a
+	applier.renderCache = newRenderCache()
+	return applier
+}
+
+//templateKey returns the hash of the template name and of the contents
+//of the header, the partials and the template.
+func templateKey(name string, sources ...[]byte) string {
+	h := sha256.New()
+	writeKeyPart(h.Write, []byte(name))
+	for _, source := range sources {
+		writeKeyPart(h.Write, source)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//writeKeyPart writes the length followed by the content
+//to avoid collisions between different splits of the same bytes.
+func writeKeyPart(write func([]byte) (int, error), b []byte) {
+	l := make([]byte, 8)
+	binary.BigEndian.PutUint64(l, uint64(len(b)))
+	_, _ = write(l)
+	_, _ = write(b)
+}
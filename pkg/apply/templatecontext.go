@@ -0,0 +1,204 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+//DefaultKubeVersion is the Kubernetes version of the default capabilities
+//when it can not be computed from the client-go version
+const DefaultKubeVersion = "v1.24.0"
+
+//Release identifies the scenario the templates are rendered for, it is exposed as .Release
+type Release struct {
+	Name      string
+	Namespace string
+}
+
+//TemplateInfo describes the rendered template, it is exposed as .Template
+type TemplateInfo struct {
+	//Name is the name of the template file in the reader
+	Name string
+	//BasePath is the directory of the template file
+	BasePath string
+}
+
+//KubeVersion is the Kubernetes version exposed as .Capabilities.KubeVersion
+type KubeVersion struct {
+	Version string
+	Major   string
+	Minor   string
+}
+
+//String returns the version
+func (kv KubeVersion) String() string {
+	return kv.Version
+}
+
+//GitVersion returns the version like in helm
+func (kv KubeVersion) GitVersion() string {
+	return kv.Version
+}
+
+//VersionSet is the list of the available apiVersions, it contains the group/version
+//and the group/version/kind of the available resources.
+type VersionSet []string
+
+//Has returns true if the apiVersion or the apiVersion/kind is available
+func (v VersionSet) Has(apiVersion string) bool {
+	for _, x := range v {
+		if x == apiVersion {
+			return true
+		}
+	}
+	return false
+}
+
+//Capabilities describes the cluster the templates are rendered for, it is exposed as .Capabilities
+type Capabilities struct {
+	KubeVersion KubeVersion
+	APIVersions VersionSet
+}
+
+//DefaultCapabilities returns the capabilities used when the applier has no client,
+//the Kubernetes version is the one of the client-go library and the apiVersions are
+//the built-in ones.
+func DefaultCapabilities() *Capabilities {
+	version := DefaultKubeVersion
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			// client-go v0.x.y supports Kubernetes v1.x.y
+			if dep.Path == "k8s.io/client-go" && strings.HasPrefix(dep.Version, "v0.") {
+				version = "v1." + strings.TrimPrefix(dep.Version, "v0.")
+				break
+			}
+		}
+	}
+	capabilities, err := NewCapabilities(version, nil)
+	if err != nil {
+		capabilities, _ = NewCapabilities(DefaultKubeVersion, nil)
+	}
+	return capabilities
+}
+
+//NewCapabilities returns the capabilities for a Kubernetes version, the apiVersions
+//are added to the built-in ones.
+func NewCapabilities(kubeVersion string, apiVersions []string) (*Capabilities, error) {
+	kv, err := parseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	versions := sets.NewString(apiVersions...)
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		versions.Insert(gvk.GroupVersion().String(), fmt.Sprintf("%s/%s", gvk.GroupVersion().String(), gvk.Kind))
+	}
+	return &Capabilities{
+		KubeVersion: kv,
+		APIVersions: VersionSet(versions.List()),
+	}, nil
+}
+
+//parseKubeVersion parses a version such as v1.24.3 or 1.24
+func parseKubeVersion(version string) (KubeVersion, error) {
+	v := strings.TrimPrefix(version, "v")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 || !isNumber(parts[0]) || !isNumber(parts[1]) {
+		return KubeVersion{}, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	if len(parts) == 2 {
+		v += ".0"
+	}
+	return KubeVersion{
+		Version: "v" + v,
+		Major:   parts[0],
+		Minor:   parts[1],
+	}, nil
+}
+
+//isNumber returns true if s is a non empty sequence of digits
+func isNumber(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+//discoverCapabilities returns the capabilities of the cluster using the discovery,
+//the groups which can not be discovered are skipped.
+func discoverCapabilities(client discovery.DiscoveryInterface) (*Capabilities, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	_, resources, err := client.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	versions := sets.NewString()
+	for _, list := range resources {
+		versions.Insert(list.GroupVersion)
+		for _, resource := range list.APIResources {
+			versions.Insert(fmt.Sprintf("%s/%s", list.GroupVersion, resource.Kind))
+		}
+	}
+	return &Capabilities{
+		KubeVersion: KubeVersion{
+			Version: info.GitVersion,
+			Major:   info.Major,
+			Minor:   info.Minor,
+		},
+		APIVersions: VersionSet(versions.List()),
+	}, nil
+}
+
+//getCapabilities returns the capabilities set with WithCapabilities, the ones discovered
+//with the applier client or the default capabilities if the applier has no client.
+func (a Applier) getCapabilities() (*Capabilities, error) {
+	if a.capabilities != nil {
+		return a.capabilities, nil
+	}
+	return a.renderCache.getCapabilities(func() (*Capabilities, error) {
+		if a.kubeClient == nil {
+			return DefaultCapabilities(), nil
+		}
+		return discoverCapabilities(a.kubeClient.Discovery())
+	})
+}
+
+//templateData returns the data passed to a template.
+//With a template context, the values are wrapped in a context exposing .Values, .Release,
+//.Capabilities, .Template and .Files, otherwise the values are passed as is.
+func (a Applier) templateData(reader asset.ScenarioReader, values interface{}, templateName string) (interface{}, error) {
+	if a.release == nil {
+		return values, nil
+	}
+	capabilities, err := a.getCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"Values":       values,
+		"Release":      *a.release,
+		"Capabilities": capabilities,
+		"Template": TemplateInfo{
+			Name:     templateName,
+			BasePath: path.Dir(filepath.ToSlash(templateName)),
+		},
+		FilesKey: NewFiles(reader, templateName),
+	}, nil
+}
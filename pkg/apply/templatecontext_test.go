@@ -0,0 +1,116 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplier_TemplateContext(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	fakeDiscovery := kubeClient.Discovery().(*fakediscovery.FakeDiscovery)
+	fakeDiscovery.FakedServerVersion = &version.Info{GitVersion: "v1.23.5", Major: "1", Minor: "23"}
+	fakeDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "route.openshift.io/v1",
+			APIResources: []metav1.APIResource{{Name: "routes", Kind: "Route", Namespaced: true}},
+		},
+	}
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("templates/configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+  namespace: {{ .Release.Namespace }}
+data:
+  key: {{ .Values.key }}
+  template: {{ .Template.Name }}
+  basePath: {{ .Template.BasePath }}
+  kubeVersion: {{ .Capabilities.KubeVersion }}
+  minor: "{{ .Capabilities.KubeVersion.Minor }}"
+  route: "{{ .Capabilities.APIVersions.Has "route.openshift.io/v1" }}"
+  routeKind: "{{ .Capabilities.APIVersions.Has "route.openshift.io/v1/Route" }}"
+  file: {{ .Files.Get "data.txt" }}
+`))
+	reader.AddAsset("templates/data.txt", []byte("content"))
+	capabilities, err := NewCapabilities("1.25", []string{"route.openshift.io/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := Release{Name: "my-release", Namespace: "my-ns"}
+	tests := []struct {
+		name    string
+		applier Applier
+		want    string
+	}{
+		{
+			name:    "discovered capabilities",
+			applier: NewApplierBuilder().WithClient(kubeClient, nil, nil).WithTemplateContext(release).Build(),
+			want:    "  kubeVersion: v1.23.5\n  minor: \"23\"\n  route: \"true\"\n  routeKind: \"true\"\n",
+		},
+		{
+			name:    "capabilities",
+			applier: NewApplierBuilder().WithTemplateContext(release).WithCapabilities(*capabilities).Build(),
+			want:    "  kubeVersion: v1.25.0\n  minor: \"25\"\n  route: \"true\"\n  routeKind: \"false\"\n",
+		},
+		{
+			name:    "default capabilities",
+			applier: NewApplierBuilder().WithTemplateContext(release).Build(),
+			want:    "  kubeVersion: " + DefaultCapabilities().KubeVersion.Version + "\n  minor: \"" + DefaultCapabilities().KubeVersion.Minor + "\"\n  route: \"false\"\n  routeKind: \"false\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.applier.MustTemplateAssets(reader, map[string]interface{}{"key": "value"}, "", "templates/configmap.yaml")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-release\n  namespace: my-ns\ndata:\n" +
+				"  key: value\n  template: templates/configmap.yaml\n  basePath: templates\n" +
+				tt.want + "  file: content\n"
+			if len(got) != 1 || got[0] != want {
+				t.Errorf("MustTemplateAssets() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNewCapabilities(t *testing.T) {
+	tests := []struct {
+		kubeVersion string
+		want        KubeVersion
+		wantErr     bool
+	}{
+		{kubeVersion: "v1.24.3", want: KubeVersion{Version: "v1.24.3", Major: "1", Minor: "24"}},
+		{kubeVersion: "1.22", want: KubeVersion{Version: "v1.22.0", Major: "1", Minor: "22"}},
+		{kubeVersion: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kubeVersion, func(t *testing.T) {
+			got, err := NewCapabilities(tt.kubeVersion, []string{"my.group/v1"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCapabilities() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.KubeVersion, tt.want) {
+				t.Errorf("NewCapabilities() = %v, want %v", got.KubeVersion, tt.want)
+			}
+			for _, apiVersion := range []string{"my.group/v1", "v1", "apps/v1", "apps/v1/Deployment", "policy/v1/PodDisruptionBudget"} {
+				if !got.APIVersions.Has(apiVersion) {
+					t.Errorf("APIVersions.Has(%q) = false", apiVersion)
+				}
+			}
+		})
+	}
+}
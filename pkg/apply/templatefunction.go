@@ -5,9 +5,19 @@ package apply
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"text/template"
 
+	"github.com/BurntSushi/toml"
 	"github.com/ghodss/yaml"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/sops"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 )
 
@@ -26,8 +36,16 @@ func GenericFuncMap() map[string]interface{} {
 }
 
 var genericMap = map[string]interface{}{
-	"toYaml":       toYaml,
-	"encodeBase64": encodeBase64,
+	"toYaml":        toYaml,
+	"encodeBase64":  encodeBase64,
+	"fromYaml":      fromYaml,
+	"fromYamlArray": fromYamlArray,
+	"toJson":        toJson,
+	"fromJson":      fromJson,
+	"fromJsonArray": fromJsonArray,
+	"toToml":        toToml,
+	"required":      required,
+	"fail":          fail,
 }
 
 func toYaml(o interface{}) (string, error) {
@@ -44,7 +62,79 @@ func encodeBase64(s string) string {
 	return base64.StdEncoding.EncodeToString([]byte(s))
 }
 
-//TemplateFuncMap generates function map for "include"
+//fromYaml converts a YAML document to a map, like in helm the error is returned in the "Error" key
+func fromYaml(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+//fromYamlArray converts a YAML array to a slice, like in helm the error is returned as the only item
+func fromYamlArray(str string) []interface{} {
+	a := []interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+//toJson converts an object to JSON, like in helm an empty string is returned on error
+func toJson(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+//fromJson converts a JSON document to a map, like in helm the error is returned in the "Error" key
+func fromJson(str string) map[string]interface{} {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+//fromJsonArray converts a JSON array to a slice, like in helm the error is returned as the only item
+func fromJsonArray(str string) []interface{} {
+	a := []interface{}{}
+	if err := json.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+//toToml converts an object to TOML, like in helm the error message is returned on error
+func toToml(v interface{}) string {
+	b := bytes.NewBuffer(nil)
+	e := toml.NewEncoder(b)
+	err := e.Encode(v)
+	if err != nil {
+		return err.Error()
+	}
+	return b.String()
+}
+
+//required fails if the value is nil or an empty string
+func required(warn string, val interface{}) (interface{}, error) {
+	if val == nil {
+		return val, errors.New(warn)
+	}
+	if s, ok := val.(string); ok && s == "" {
+		return val, errors.New(warn)
+	}
+	return val, nil
+}
+
+//fail fails the rendering with the message
+func fail(msg string) (string, error) {
+	return "", errors.New(msg)
+}
+
+//TemplateFuncMap generates function map for "include" and "tpl"
 func TemplateFuncMap(tmpl *template.Template) (funcMap template.FuncMap) {
 	funcMap = make(template.FuncMap)
 	funcMap["include"] = func(name string, data interface{}) (string, error) {
@@ -54,5 +144,97 @@ func TemplateFuncMap(tmpl *template.Template) (funcMap template.FuncMap) {
 		}
 		return buf.String(), nil
 	}
+	// tpl renders a string as a template with the same functions and named templates
+	funcMap["tpl"] = func(text string, data interface{}) (string, error) {
+		t, err := tmpl.Clone()
+		if err != nil {
+			return "", err
+		}
+		t, err = t.New(tmpl.Name() + "/tpl").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := t.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
 	return funcMap
 }
+
+//lookupFuncMap generates the function map for "lookup" which reads the objects with the applier clients
+func (a Applier) lookupFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"lookup": a.lookup,
+	}
+}
+
+//filesFuncMap generates the function map for "files" which returns the Files of the reader for the template,
+//it gives access to the files when the template context is not used.
+func filesFuncMap(reader asset.ScenarioReader, templateName string) template.FuncMap {
+	return template.FuncMap{
+		"files": func() Files {
+			return NewFiles(reader, templateName)
+		},
+	}
+}
+
+//decryptFuncMap generates the function map for "decrypt" which decrypts the age encrypted values
+func (a Applier) decryptFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"decrypt": a.decrypt,
+	}
+}
+
+//decrypt decrypts an armored or base64 encoded age encrypted value with the applier decrypter
+func (a Applier) decrypt(ciphertext string) (string, error) {
+	if a.decrypter == nil {
+		return "", sops.ErrNoKeys
+	}
+	return a.decrypter.Decrypt(ciphertext)
+}
+
+//lookupEnabled returns true if the lookup function reads the cluster
+func (a Applier) lookupEnabled() bool {
+	return !a.dryRun && a.kubeClient != nil && a.dynamicClient != nil
+}
+
+//lookup returns the object as a map like the helm lookup function, if the name is empty
+//the list of objects is returned. An empty map is returned if the object is not found
+//or if the applier has no clients or runs in dry-run.
+func (a Applier) lookup(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	if !a.lookupEnabled() {
+		return map[string]interface{}{}, nil
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	mapping, err := a.restMapping(gv.WithKind(kind))
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	var dr dynamic.ResourceInterface = a.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && len(namespace) != 0 {
+		dr = a.dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+	if len(name) != 0 {
+		obj, err := dr.Get(a.context, name, metav1.GetOptions{})
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				return map[string]interface{}{}, nil
+			}
+			return map[string]interface{}{}, err
+		}
+		return obj.UnstructuredContent(), nil
+	}
+	list, err := dr.List(a.context, metav1.ListOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return map[string]interface{}{}, nil
+		}
+		return map[string]interface{}{}, err
+	}
+	return list.UnstructuredContent(), nil
+}
@@ -0,0 +1,100 @@
+// Copyright Red Hat
+package apply
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		tpl, expect string
+		vars        interface{}
+		wantErr     bool
+	}{{
+		tpl:    `{{ toYaml . }}`,
+		expect: "foo: bar\n",
+		vars:   map[string]interface{}{"foo": "bar"},
+	}, {
+		tpl:    `{{ toToml . }}`,
+		expect: "foo = \"bar\"\n",
+		vars:   map[string]interface{}{"foo": "bar"},
+	}, {
+		tpl:    `{{ toJson . }}`,
+		expect: `{"foo":"bar"}`,
+		vars:   map[string]interface{}{"foo": "bar"},
+	}, {
+		tpl:    `{{ fromYaml . }}`,
+		expect: "map[hello:world]",
+		vars:   `hello: world`,
+	}, {
+		tpl:    `{{ fromYamlArray . }}`,
+		expect: "[one 2 map[name:helm]]",
+		vars:   "- one\n- 2\n- name: helm\n",
+	}, {
+		tpl:    `{{ fromYamlArray . }}`,
+		expect: "[error unmarshaling JSON: json: cannot unmarshal object into Go value of type []interface {}]",
+		vars:   `hello: world`,
+	}, {
+		tpl:    `{{ fromJson . }}`,
+		expect: "map[hello:world]",
+		vars:   `{"hello":"world"}`,
+	}, {
+		tpl:    `{{ fromJson . }}`,
+		expect: "map[Error:json: cannot unmarshal array into Go value of type map[string]interface {}]",
+		vars:   `["one", "two"]`,
+	}, {
+		tpl:    `{{ fromJsonArray . }}`,
+		expect: "[one 2 map[name:helm]]",
+		vars:   `["one", 2, { "name": "helm" }]`,
+	}, {
+		tpl:    `{{ fromYaml . | toJson }}`,
+		expect: `{"hello":"world"}`,
+		vars:   `hello: world`,
+	}, {
+		tpl:    `{{ required "foo is required" .foo }}`,
+		expect: "bar",
+		vars:   map[string]interface{}{"foo": "bar"},
+	}, {
+		tpl:     `{{ required "foo is required" .foo }}`,
+		vars:    map[string]interface{}{"foo": ""},
+		wantErr: true,
+	}, {
+		tpl:     `{{ required "foo is required" .foo }}`,
+		vars:    map[string]interface{}{},
+		wantErr: true,
+	}, {
+		tpl:     `{{ fail "the rendering failed" }}`,
+		vars:    nil,
+		wantErr: true,
+	}, {
+		tpl:    `{{ define "name" }}{{ .name }}{{ end }}{{ tpl .template . }}`,
+		expect: "hello world",
+		vars:   map[string]interface{}{"name": "world", "template": `hello {{ include "name" . }}`},
+	}, {
+		tpl:     `{{ tpl .template . }}`,
+		vars:    map[string]interface{}{"template": `{{ fail "in tpl" }}`},
+		wantErr: true,
+	}, {
+		tpl:    `a:{{ toYaml . | nindent 2 }}`,
+		expect: "a:\n  foo: bar\n  ",
+		vars:   map[string]interface{}{"foo": "bar"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.tpl, func(t *testing.T) {
+			tmpl, err := getTemplate("test", nil).Parse(tt.tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			err = tmpl.Execute(&b, tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && b.String() != tt.expect {
+				t.Errorf("Execute() = %q, want %q", b.String(), tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+const libraryTemplateName = "applier-partials-library"
+
+//templateLibrary holds the named templates defined in partials shared by all templates,
+//the partials are read and parsed only once.
+type templateLibrary struct {
+	reader asset.ScenarioReader
+	paths  []string
+	once   sync.Once
+	trees  map[string]*parse.Tree
+	err    error
+}
+
+func newTemplateLibrary(reader asset.ScenarioReader, paths ...string) *templateLibrary {
+	return &templateLibrary{
+		reader: reader,
+		paths:  paths,
+	}
+}
+
+//resetTemplateLibraries returns new libraries with the same partials as the partials
+//must be parsed again when the function map changes.
+func resetTemplateLibraries(libraries []*templateLibrary) []*templateLibrary {
+	if libraries == nil {
+		return nil
+	}
+	reset := make([]*templateLibrary, len(libraries))
+	for i, l := range libraries {
+		reset[i] = newTemplateLibrary(l.reader, l.paths...)
+	}
+	return reset
+}
+
+//addParseTrees adds the named templates of the library to the template
+func (l *templateLibrary) addParseTrees(tmpl *template.Template, customFuncMap template.FuncMap) error {
+	l.once.Do(func() {
+		l.trees, l.err = l.parse(customFuncMap)
+	})
+	if l.err != nil {
+		return l.err
+	}
+	for name, tree := range l.trees {
+		if _, err := tmpl.AddParseTree(name, tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *templateLibrary) parse(customFuncMap template.FuncMap) (map[string]*parse.Tree, error) {
+	files, err := l.reader.AssetNames(l.paths, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	tmpl := getTemplate(libraryTemplateName, customFuncMap)
+	isFile := map[string]bool{libraryTemplateName: true}
+	for _, name := range files {
+		b, err := l.reader.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.New(name).Parse(string(b)); err != nil {
+			return nil, err
+		}
+		isFile[name] = true
+	}
+	// Only the named templates are kept, not the content of the files
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.Templates() {
+		if isFile[t.Name()] || t.Tree == nil {
+			continue
+		}
+		trees[t.Name()] = t.Tree
+	}
+	return trees, nil
+}
+
+//templateHeader holds the headers provided by WithHeaders, they are read and parsed
+//before each template like the header file.
+type templateHeader struct {
+	reader asset.ScenarioReader
+	paths  []string
+}
+
+//sources returns the contents of the headers in the order of their paths
+func (h templateHeader) sources() ([][]byte, error) {
+	sources := make([][]byte, 0, len(h.paths))
+	for _, path := range h.paths {
+		b, err := h.reader.Asset(path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, b)
+	}
+	return sources, nil
+}
@@ -0,0 +1,423 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/helpers"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/discovery"
+	protovalidation "k8s.io/kube-openapi/pkg/util/proto/validation"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"k8s.io/kubectl/pkg/util/openapi"
+	kubectlvalidation "k8s.io/kubectl/pkg/util/openapi/validation"
+)
+
+//Validator validates the rendered objects against the OpenAPI schemas of their kind.
+//The schemas are the OpenAPI v2 schemas served by a cluster or read from a directory,
+//the schemas of the CRDs found in the validated objects take precedence.
+//The objects of a kind without schema are not validated.
+type Validator struct {
+	//resources are the OpenAPI v2 schemas of the kinds
+	resources openapi.Resources
+	//crdSchemas are the schemas of the CRDs of the schema directory
+	crdSchemas map[schema.GroupVersionKind]*crdSchema
+}
+
+//crdSchema is the schema of a version of a CRD
+type crdSchema struct {
+	validator  *validate.SchemaValidator
+	structural *structuralschema.Structural
+}
+
+//ValidationError is an error of a rendered object
+type ValidationError struct {
+	//Document is the name of the rendered document, for example file.yaml#1
+	Document string
+	Kind     string
+	Name     string
+	//Field is the path of the field in error, for example spec.template.spec.containers[0].image
+	Field   string
+	Message string
+}
+
+//File returns the source file of the document
+func (e ValidationError) File() string {
+	return helpers.SourceFile(e.Document)
+}
+
+func (e ValidationError) Error() string {
+	s := e.Document + ":"
+	if len(e.Kind) != 0 {
+		s += fmt.Sprintf(" %s %s:", e.Kind, e.Name)
+	}
+	if len(e.Field) != 0 {
+		s += fmt.Sprintf(" %s:", e.Field)
+	}
+	return s + " " + e.Message
+}
+
+//ValidationErrors are the errors of the rendered objects
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+//NewValidator returns a Validator using the OpenAPI v2 schemas served by the cluster,
+//for example with the discovery client of a kubernetes.Interface.
+func NewValidator(client discovery.OpenAPISchemaInterface) (*Validator, error) {
+	doc, err := client.OpenAPISchema()
+	if err != nil {
+		return nil, err
+	}
+	return newValidator(doc)
+}
+
+//DiscoveryClientGetter returns the discovery client of a cluster, for example a kubectl factory
+type DiscoveryClientGetter interface {
+	ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error)
+}
+
+//LoadValidator returns a Validator using the schemas of the directory if it is set
+//or else the schemas of the cluster, the discovery client is only got in that case.
+func LoadValidator(dir string, clientGetter DiscoveryClientGetter) (*Validator, error) {
+	if len(dir) != 0 {
+		return NewValidatorFromDir(dir)
+	}
+	discoveryClient, err := clientGetter.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return NewValidator(discoveryClient)
+}
+
+//NewValidatorFromDir returns a Validator using the schemas of a directory to validate offline.
+//The directory contains OpenAPI v2 documents, for example saved with `kubectl get --raw /openapi/v2`,
+//and CRDs, the files are read recursively.
+func NewValidatorFromDir(dir string) (*Validator, error) {
+	var doc *openapi_v2.Document
+	crds := make([]*unstructured.Unstructured, 0)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch filepath.Ext(name) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+		b, err := ioutil.ReadFile(filepath.Clean(name))
+		if err != nil {
+			return err
+		}
+		if isOpenAPIDocument(name, b) {
+			d, err := openapi_v2.ParseDocument(b)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			doc = mergeOpenAPIDocuments(doc, d)
+			return nil
+		}
+		objects, err := helpers.SplitDocuments(b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		for _, object := range objects {
+			u, err := documentToUnstructured(object)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			crds = append(crds, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	v, err := newValidator(doc)
+	if err != nil {
+		return nil, err
+	}
+	v.crdSchemas, err = addCRDSchemas(v.crdSchemas, crds)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+//newValidator returns a Validator using the OpenAPI document, the document can be nil
+func newValidator(doc *openapi_v2.Document) (*Validator, error) {
+	v := &Validator{
+		crdSchemas: make(map[schema.GroupVersionKind]*crdSchema),
+	}
+	if doc == nil {
+		return v, nil
+	}
+	resources, err := openapi.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, err
+	}
+	v.resources = resources
+	return v, nil
+}
+
+//isOpenAPIDocument returns true if the file is an OpenAPI v2 document
+func isOpenAPIDocument(name string, b []byte) bool {
+	var err error
+	if filepath.Ext(name) != ".json" {
+		b, err = asset.ToJSON(b)
+		if err != nil {
+			return false
+		}
+	}
+	doc := struct {
+		Swagger string `json:"swagger"`
+	}{}
+	return json.Unmarshal(b, &doc) == nil && len(doc.Swagger) != 0
+}
+
+//mergeOpenAPIDocuments adds the definitions of the document d to the document doc
+func mergeOpenAPIDocuments(doc, d *openapi_v2.Document) *openapi_v2.Document {
+	if doc == nil {
+		return d
+	}
+	if d.Definitions == nil {
+		return doc
+	}
+	if doc.Definitions == nil {
+		doc.Definitions = &openapi_v2.Definitions{}
+	}
+	doc.Definitions.AdditionalProperties = append(doc.Definitions.AdditionalProperties, d.Definitions.AdditionalProperties...)
+	return doc
+}
+
+//addCRDSchemas returns a copy of the schemas with the schemas of the CRDs found in the objects
+func addCRDSchemas(crdSchemas map[schema.GroupVersionKind]*crdSchema, objects []*unstructured.Unstructured) (map[schema.GroupVersionKind]*crdSchema, error) {
+	added := make(map[schema.GroupVersionKind]*crdSchema, len(crdSchemas))
+	for gvk, s := range crdSchemas {
+		added[gvk] = s
+	}
+	for _, u := range objects {
+		if u.GroupVersionKind() != apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition") {
+			continue
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, crd); err != nil {
+			return nil, fmt.Errorf("CustomResourceDefinition %s: %v", u.GetName(), err)
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			s, err := newCRDSchema(version.Schema.OpenAPIV3Schema)
+			if err != nil {
+				return nil, fmt.Errorf("CustomResourceDefinition %s version %s: %v", crd.Name, version.Name, err)
+			}
+			added[schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}] = s
+		}
+	}
+	return added, nil
+}
+
+//newCRDSchema returns the schema validating the custom resources like the apiserver
+func newCRDSchema(openAPIV3Schema *apiextensionsv1.JSONSchemaProps) (*crdSchema, error) {
+	internal := &apiextensions.JSONSchemaProps{}
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(openAPIV3Schema, internal, nil); err != nil {
+		return nil, err
+	}
+	validator, _, err := apiservervalidation.NewSchemaValidator(&apiextensions.CustomResourceValidation{OpenAPIV3Schema: internal})
+	if err != nil {
+		return nil, err
+	}
+	structural, err := structuralschema.NewStructural(internal)
+	if err != nil {
+		return nil, err
+	}
+	return &crdSchema{
+		validator:  validator,
+		structural: structural,
+	}, nil
+}
+
+//Validate validates the documents, the CRDs found in the documents are used to validate
+//their custom resources.
+func (v *Validator) Validate(documents []helpers.Document) (ValidationErrors, error) {
+	objects := make([]*unstructured.Unstructured, len(documents))
+	for i, document := range documents {
+		u, err := documentToUnstructured(document.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", document.Name, err)
+		}
+		objects[i] = u
+	}
+	crdSchemas, err := addCRDSchemas(v.crdSchemas, objects)
+	if err != nil {
+		return nil, err
+	}
+	validationErrors := make(ValidationErrors, 0)
+	for i, document := range documents {
+		objectErrors := v.validateObject(document.Name, objects[i], crdSchemas)
+		// The unknown fields are found in a random order
+		sort.SliceStable(objectErrors, func(i, j int) bool {
+			return objectErrors[i].Field < objectErrors[j].Field
+		})
+		validationErrors = append(validationErrors, objectErrors...)
+	}
+	return validationErrors, nil
+}
+
+//validateObject validates an object against the schema of its kind
+func (v *Validator) validateObject(name string,
+	u *unstructured.Unstructured,
+	crdSchemas map[schema.GroupVersionKind]*crdSchema) ValidationErrors {
+	newError := func(field, message string) ValidationError {
+		return ValidationError{
+			Document: name,
+			Kind:     u.GetKind(),
+			Name:     u.GetName(),
+			Field:    field,
+			Message:  message,
+		}
+	}
+	validationErrors := make(ValidationErrors, 0)
+	gvk, errs := kubectlvalidation.GetObjectKind(u.Object)
+	if len(errs) != 0 {
+		for _, err := range errs {
+			validationErrors = append(validationErrors, newError("", err.Error()))
+		}
+		return validationErrors
+	}
+	if s, ok := crdSchemas[gvk]; ok {
+		for _, err := range apiservervalidation.ValidateCustomResource(nil, u.Object, s.validator) {
+			validationErrors = append(validationErrors, newError(err.Field, err.ErrorBody()))
+		}
+		// The unknown fields are pruned by the apiserver
+		pruned := pruning.PruneWithOptions(runtime.DeepCopyJSONValue(u.Object), s.structural, true, pruning.PruneOptions{ReturnPruned: true})
+		for _, field := range pruned {
+			validationErrors = append(validationErrors, newError(field, "unknown field"))
+		}
+		return validationErrors
+	}
+	if v.resources == nil {
+		return validationErrors
+	}
+	resource := v.resources.LookupResource(gvk)
+	if resource == nil {
+		return validationErrors
+	}
+	for _, err := range protovalidation.ValidateModel(u.Object, resource, gvk.Kind) {
+		field, message := protoValidationError(gvk.Kind, err)
+		validationErrors = append(validationErrors, newError(field, message))
+	}
+	return validationErrors
+}
+
+//protoValidationError returns the field path and the message of an error of the OpenAPI v2 validation
+func protoValidationError(kind string, err error) (string, string) {
+	validationError, ok := err.(protovalidation.ValidationError)
+	if !ok {
+		return "", err.Error()
+	}
+	field := strings.TrimPrefix(strings.TrimPrefix(validationError.Path, kind), ".")
+	join := func(name string) string {
+		if len(field) == 0 {
+			return name
+		}
+		return field + "." + name
+	}
+	switch e := validationError.Err.(type) {
+	case protovalidation.UnknownFieldError:
+		return join(e.Field), "unknown field"
+	case protovalidation.MissingRequiredFieldError:
+		return join(e.Field), "missing required field"
+	case protovalidation.InvalidTypeError:
+		return field, fmt.Sprintf("invalid type, got %q, expected %q", e.Actual, e.Expected)
+	default:
+		return field, validationError.Err.Error()
+	}
+}
+
+//documentToUnstructured converts a YAML or JSON document, the numbers are converted to int64 or float64
+func documentToUnstructured(document []byte) (*unstructured.Unstructured, error) {
+	j, err := asset.ToJSON(document)
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{})
+	if err := utiljson.Unmarshal(j, &object); err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+//validateDocuments validates the rendered documents with the validator of the applier
+func (a Applier) validateDocuments(documents []helpers.Document) error {
+	if a.validator == nil {
+		return nil
+	}
+	validationErrors, err := a.validator.Validate(documents)
+	if err != nil {
+		return err
+	}
+	if len(validationErrors) != 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+//Validate renders the files like MustTemplateAssets and returns the validation errors
+//of the rendered objects. The validator is the one set by WithValidator
+//or uses the OpenAPI schemas of the cluster of the applier clients.
+func (a Applier) Validate(reader asset.ScenarioReader,
+	values interface{},
+	headerFile string,
+	files ...string) (ValidationErrors, error) {
+	validator := a.validator
+	if validator == nil {
+		if a.kubeClient == nil {
+			return nil, fmt.Errorf("missing validator or kubeClient")
+		}
+		var err error
+		validator, err = NewValidator(a.kubeClient.Discovery())
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The documents are validated all at once and not while rendering
+	a.validator = nil
+	a, memFSReader, files, err := a.renderFiles(reader, values, headerFile, files)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]helpers.Document, 0, len(files))
+	for _, name := range files {
+		b, err := memFSReader.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, helpers.Document{Name: name, Content: b})
+	}
+	return validator.Validate(documents)
+}
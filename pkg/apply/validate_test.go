@@ -0,0 +1,193 @@
+// Copyright Red Hat
+
+package apply
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"github.com/stolostron/applier/pkg/asset"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testSchemaDir = "../../test/unit/resources/validate/schemas"
+
+type fakeOpenAPISchema struct {
+	doc *openapi_v2.Document
+}
+
+func (f fakeOpenAPISchema) OpenAPISchema() (*openapi_v2.Document, error) {
+	return f.doc, nil
+}
+
+func TestApplier_Validate(t *testing.T) {
+	b, err := ioutil.ReadFile(testSchemaDir + "/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openapi_v2.ParseDocument(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discoveryValidator, err := NewValidator(fakeOpenAPISchema{doc: doc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirValidator, err := NewValidatorFromDir(testSchemaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+  lables:
+    app: my-app
+data:
+  replicas: "{{ .Replicas }}"
+`))
+	reader.AddAsset("service.yaml", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: my-svc
+spec:
+  ports:
+  - name: http
+    protocol: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-other-svc
+spec:
+  ports:
+  - port: http
+`))
+	reader.AddAsset("crd.yaml", []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+                minimum: 1
+`))
+	reader.AddAsset("widget.yaml", []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-widget
+spec:
+  size: 0
+  colour: blue
+`))
+	reader.AddAsset("backup.yaml", []byte(`apiVersion: example.com/v1
+kind: Backup
+metadata:
+  name: my-backup
+spec: {}
+`))
+	reader.AddAsset("unknown.yaml", []byte(`apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: my-unknown
+spec:
+  any: field
+`))
+	files := []string{"configmap.yaml", "service.yaml", "crd.yaml", "widget.yaml", "backup.yaml", "unknown.yaml"}
+	values := map[string]interface{}{"Replicas": 3}
+	tests := []struct {
+		name      string
+		validator *Validator
+		want      []string
+	}{
+		{
+			name:      "discovery",
+			validator: discoveryValidator,
+			want: []string{
+				`configmap.yaml: ConfigMap my-cm: metadata.lables: unknown field`,
+				`service.yaml#0: Service my-svc: spec.ports[0].port: missing required field`,
+				`service.yaml#1: Service my-other-svc: spec.ports[0].port: invalid type, got "string", expected "integer"`,
+				`widget.yaml: Widget my-widget: spec.colour: unknown field`,
+				`widget.yaml: Widget my-widget: spec.size: Invalid value: 0: spec.size in body should be greater than or equal to 1`,
+			},
+		},
+		{
+			name:      "schema directory",
+			validator: dirValidator,
+			want: []string{
+				`configmap.yaml: ConfigMap my-cm: metadata.lables: unknown field`,
+				`service.yaml#0: Service my-svc: spec.ports[0].port: missing required field`,
+				`service.yaml#1: Service my-other-svc: spec.ports[0].port: invalid type, got "string", expected "integer"`,
+				`widget.yaml: Widget my-widget: spec.colour: unknown field`,
+				`widget.yaml: Widget my-widget: spec.size: Invalid value: 0: spec.size in body should be greater than or equal to 1`,
+				`backup.yaml: Backup my-backup: spec.schedule: Required value`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validationErrors, err := NewApplierBuilder().WithValidator(tt.validator).Build().Validate(reader, values, "", files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(validationErrors))
+			for i, e := range validationErrors {
+				got[i] = e.Error()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+			_, err = NewApplierBuilder().Build().WithValidator(tt.validator).MustTemplateAssets(reader, values, "", files...)
+			if _, ok := err.(ValidationErrors); !ok {
+				t.Errorf("MustTemplateAssets() error = %v, want ValidationErrors", err)
+			}
+			if _, err := NewApplierBuilder().WithValidator(tt.validator).Build().MustTemplateAssets(reader, values, "", "unknown.yaml"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestApplier_ApplyCustomResourceValidate(t *testing.T) {
+	validator, err := NewValidatorFromDir(testSchemaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := asset.NewDirectoriesReader("", []string{"../../test/unit/resources/validate/invalid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applier := NewApplierBuilder().
+		WithClient(kubefake.NewSimpleClientset(), apiextensionsfake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())).
+		WithValidator(validator).
+		Build()
+	_, err = applier.ApplyCustomResource(reader, map[string]interface{}{"Name": "my-backup"}, false, "",
+		"../../test/unit/resources/validate/invalid/backup.yaml")
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("Expected a ValidationErrors error got %v", err)
+	}
+}
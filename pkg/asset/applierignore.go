@@ -0,0 +1,119 @@
+// Copyright Red Hat
+
+package asset
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+//ApplierIgnoreFile is the name of the file listing the patterns of the files to ignore in a directory.
+//Each line is a doublestar glob pattern relative to the directory containing the file,
+//blank lines and lines starting with # are skipped, a pattern starting with ! re-includes
+//the files excluded by a previous pattern, a pattern without / matches at any depth.
+const ApplierIgnoreFile = ".applierignore"
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+//applierIgnore holds the rules of an ApplierIgnoreFile located in dir
+type applierIgnore struct {
+	dir   string
+	rules []ignoreRule
+}
+
+func parseApplierIgnore(dir string, b []byte) (*applierIgnore, error) {
+	ignore := &applierIgnore{
+		dir:   dir,
+		rules: make([]ignoreRule, 0),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimSuffix(line, "/")
+		switch {
+		case strings.HasPrefix(line, "/"):
+			line = line[1:]
+		case !strings.Contains(line, "/"):
+			line = "**/" + line
+		}
+		if !doublestar.ValidatePattern(line) {
+			return nil, doublestar.ErrBadPattern
+		}
+		rule.pattern = line
+		ignore.rules = append(ignore.rules, rule)
+	}
+	return ignore, scanner.Err()
+}
+
+//ignored returns true if the slash separated name is ignored by the rules,
+//the last matching rule wins.
+func (i *applierIgnore) ignored(name string) bool {
+	if i.dir != "." {
+		if !strings.HasPrefix(name, i.dir+"/") {
+			return false
+		}
+		name = strings.TrimPrefix(name, i.dir+"/")
+	}
+	ignored := false
+	for _, rule := range i.rules {
+		if matchGlob(rule.pattern, name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+//filterApplierIgnore removes from the names the ApplierIgnoreFile files and the files they ignore,
+//the ApplierIgnoreFile files are read with the read function.
+func filterApplierIgnore(names []string, read func(name string) ([]byte, error)) ([]string, error) {
+	ignores := make([]*applierIgnore, 0)
+	for _, name := range names {
+		if path.Base(name) != ApplierIgnoreFile {
+			continue
+		}
+		b, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		ignore, err := parseApplierIgnore(path.Dir(name), b)
+		if err != nil {
+			return nil, err
+		}
+		ignores = append(ignores, ignore)
+	}
+	if len(ignores) == 0 {
+		return names, nil
+	}
+	filtered := make([]string, 0)
+	for _, name := range names {
+		if path.Base(name) == ApplierIgnoreFile {
+			continue
+		}
+		ignored := false
+		for _, ignore := range ignores {
+			if ignore.ignored(name) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered, nil
+}
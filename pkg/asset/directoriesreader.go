@@ -7,29 +7,55 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 //YamlFileReader defines a reader for yaml files
 type YamlFileReader struct {
-	header string
-	paths  []string
-	files  []string
+	header     string
+	paths      []string
+	extensions []string
+	files      []string
+	//allFiles are all the files located in the paths whatever their extension, listed on first use
+	allFilesOnce sync.Once
+	allFiles     []string
+	allFilesErr  error
 }
 
 var _ ScenarioReader = &YamlFileReader{
-	header: "",
-	paths:  []string{},
-	files:  []string{},
+	header:     "",
+	paths:      []string{},
+	extensions: []string{},
+	files:      []string{},
 }
 
-//NewDirectoriesReader constructs a new YamlFileReader
+var _ FileReader = &YamlFileReader{
+	header:     "",
+	paths:      []string{},
+	extensions: []string{},
+	files:      []string{},
+}
+
+//NewDirectoriesReader constructs a new YamlFileReader selecting the files with the DefaultExtensions
 func NewDirectoriesReader(
 	header string,
 	paths []string,
+) (*YamlFileReader, error) {
+	return NewDirectoriesReaderWithExtensions(header, paths, DefaultExtensions)
+}
+
+//NewDirectoriesReaderWithExtensions constructs a new YamlFileReader selecting in the directories
+//the files with one of the extensions, if extensions is empty all files are selected.
+//The files explicitly listed in the paths are always selected.
+func NewDirectoriesReaderWithExtensions(
+	header string,
+	paths []string,
+	extensions []string,
 ) (*YamlFileReader, error) {
 	reader := &YamlFileReader{
-		header: header,
-		paths:  paths,
+		header:     header,
+		paths:      paths,
+		extensions: extensions,
 	}
 	files, err := reader.AssetNames(paths, nil, header)
 	if err != nil {
@@ -57,26 +83,59 @@ func (r *YamlFileReader) Asset(
 	return ioutil.ReadFile(filepath.Clean(name))
 }
 
-//AssetNames returns the name of all assets
+//AssetNames returns the name of all assets located in the paths with a prefix of one of the prefixes.
+//The paths, prefixes and excluded can be glob or regex patterns and the files ignored
+//by the ApplierIgnoreFile found in the directories are skipped.
 func (r *YamlFileReader) AssetNames(prefixes, excluded []string, headerFile string) ([]string, error) {
+	matcher, err := newPatternMatcher(r.paths, prefixes, excluded)
+	if err != nil {
+		return nil, err
+	}
+	// The files are walked with cleaned names
+	if prefixes != nil {
+		cleanedPrefixes := make([]string, len(prefixes))
+		for i, prefix := range prefixes {
+			cleanedPrefixes[i] = filepath.Clean(prefix)
+		}
+		prefixes = cleanedPrefixes
+	}
 	assetNames := make([]string, 0)
-	visit := func(path string, fileInfo os.FileInfo, err error) error {
-		if fileInfo == nil {
-			return fmt.Errorf("paths %s doesn't exist", path)
+	for _, p := range r.paths {
+		root := p
+		if isPattern(p) {
+			root = patternBase(p)
 		}
-		if fileInfo.IsDir() {
-			return nil
+		fileInfo, err := os.Stat(root)
+		if err != nil {
+			return assetNames, fmt.Errorf("paths %s doesn't exist", p)
 		}
-		if isExcluded(path, []string{path}, excluded) {
-			return nil
+		files := []string{root}
+		if fileInfo.IsDir() {
+			fsReader := NewFSReader(os.DirFS(root))
+			names, err := fsReader.walk(".")
+			if err != nil {
+				return assetNames, err
+			}
+			names, err = filterApplierIgnore(names, fsReader.Asset)
+			if err != nil {
+				return assetNames, err
+			}
+			files = make([]string, 0, len(names))
+			for _, name := range names {
+				f := filepath.Join(root, filepath.FromSlash(name))
+				if isSelected(f, prefixes, r.extensions) {
+					files = append(files, f)
+				}
+			}
 		}
-		assetNames = append(assetNames, path)
-		return nil
-	}
-
-	for _, p := range r.paths {
-		if err := filepath.Walk(p, visit); err != nil {
-			return assetNames, err
+		for _, f := range files {
+			if isPattern(p) && !matcher.match(filepath.Clean(p), f) {
+				continue
+			}
+			if matcher.isExcluded(f, prefixes, excluded) {
+				continue
+			}
+			assetNames = AppendItNotExists(assetNames, f)
 		}
 	}
 	// The header file must be added in the assetNames as it is retrieved latter
@@ -84,3 +143,29 @@ func (r *YamlFileReader) AssetNames(prefixes, excluded []string, headerFile stri
 	assetNames = AppendItNotExists(assetNames, headerFile)
 	return assetNames, nil
 }
+
+//File returns a file located in the paths whatever its extension
+func (r *YamlFileReader) File(name string) ([]byte, error) {
+	names, err := r.FileNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range names {
+		if f == name {
+			return ioutil.ReadFile(filepath.Clean(name))
+		}
+	}
+	return nil, fmt.Errorf("file %s is not part of the files", name)
+}
+
+//FileNames returns the name of all files located in the paths whatever their extension,
+//the files ignored by the ApplierIgnoreFile are skipped.
+func (r *YamlFileReader) FileNames() ([]string, error) {
+	r.allFilesOnce.Do(func() {
+		reader := &YamlFileReader{
+			paths: r.paths,
+		}
+		r.allFiles, r.allFilesErr = reader.AssetNames(nil, nil, "")
+	})
+	return append([]string{}, r.allFiles...), r.allFilesErr
+}
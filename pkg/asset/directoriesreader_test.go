@@ -0,0 +1,207 @@
+// Copyright Red Hat
+
+package asset
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestYamlFileReader_AssetNames(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"file1.yaml":              "file1",
+		"README.md":               "readme",
+		"sub/file2.yaml":          "file2",
+		"sub/test-file3.yaml":     "file3",
+		"sub/fixtures/file4.yaml": "file4",
+		"sub/values.yaml":         "values",
+		"sub/.applierignore":      "# comment\n\nfixtures/\nvalues.yaml\n",
+		"other/.applierignore":    "*.yaml\n!keep.yaml\n",
+		"other/keep.yaml":         "keep",
+		"other/drop.yaml":         "drop",
+	}
+	for f, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0700); err != nil {
+			t.Error(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(content), 0600); err != nil {
+			t.Error(err)
+		}
+	}
+	type args struct {
+		paths, prefixes, excluded, extensions []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "directory with applierignore",
+			args: args{
+				paths: []string{dir},
+			},
+			want: []string{
+				filepath.Join(dir, "README.md"),
+				filepath.Join(dir, "file1.yaml"),
+				filepath.Join(dir, "other", "keep.yaml"),
+				filepath.Join(dir, "sub", "file2.yaml"),
+				filepath.Join(dir, "sub", "test-file3.yaml"),
+			},
+		},
+		{
+			name: "default extensions",
+			args: args{
+				paths:      []string{dir, filepath.Join(dir, "README.md")},
+				extensions: DefaultExtensions,
+			},
+			want: []string{
+				filepath.Join(dir, "file1.yaml"),
+				filepath.Join(dir, "other", "keep.yaml"),
+				filepath.Join(dir, "sub", "file2.yaml"),
+				filepath.Join(dir, "sub", "test-file3.yaml"),
+				filepath.Join(dir, "README.md"),
+			},
+		},
+		{
+			name: "glob path and glob excluded",
+			args: args{
+				paths:    []string{filepath.Join(dir, "**", "*.yaml")},
+				excluded: []string{filepath.Join(dir, "**", "test-*.yaml"), filepath.Join(dir, "other", "**")},
+			},
+			want: []string{
+				filepath.Join(dir, "file1.yaml"),
+				filepath.Join(dir, "sub", "file2.yaml"),
+			},
+		},
+		{
+			name: "excluded file",
+			args: args{
+				paths:    []string{dir},
+				excluded: []string{filepath.Join(dir, "other"), filepath.Join(dir, "sub", "file2.yaml")},
+			},
+			want: []string{
+				filepath.Join(dir, "README.md"),
+				filepath.Join(dir, "file1.yaml"),
+				filepath.Join(dir, "other", "keep.yaml"),
+				filepath.Join(dir, "sub", "test-file3.yaml"),
+			},
+		},
+		{
+			name: "regex excluded",
+			args: args{
+				paths:    []string{dir},
+				excluded: []string{"regex:.*\\.md$"},
+			},
+			want: []string{
+				filepath.Join(dir, "file1.yaml"),
+				filepath.Join(dir, "other", "keep.yaml"),
+				filepath.Join(dir, "sub", "file2.yaml"),
+				filepath.Join(dir, "sub", "test-file3.yaml"),
+			},
+		},
+		{
+			name: "prefixes",
+			args: args{
+				paths:    []string{dir},
+				prefixes: []string{filepath.Join(dir, "sub") + "/"},
+			},
+			want: []string{
+				filepath.Join(dir, "sub", "file2.yaml"),
+				filepath.Join(dir, "sub", "test-file3.yaml"),
+			},
+		},
+		{
+			name: "bad pattern",
+			args: args{
+				paths:    []string{dir},
+				excluded: []string{"regex:("},
+			},
+			wantErr: true,
+		},
+		{
+			name: "not existing path",
+			args: args{
+				paths: []string{filepath.Join(dir, "not-exists")},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &YamlFileReader{
+				paths:      tt.args.paths,
+				extensions: tt.args.extensions,
+			}
+			got, err := r.AssetNames(tt.args.prefixes, tt.args.excluded, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("YamlFileReader.AssetNames() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("YamlFileReader.AssetNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYamlFileReader_FileNames(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"configmap.yaml":     "configmap",
+		"scripts/run.sh":     "run",
+		"scripts/ignored.sh": "ignored",
+		".applierignore":     "ignored.sh\n",
+	}
+	for f, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0700); err != nil {
+			t.Error(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(content), 0600); err != nil {
+			t.Error(err)
+		}
+	}
+	reader, err := NewDirectoriesReader("", []string{dir})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got, err := reader.FileNames()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []string{
+		filepath.Join(dir, "configmap.yaml"),
+		filepath.Join(dir, "scripts", "run.sh"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FileNames() = %v, want %v", got, want)
+	}
+	// The script is not an asset but it can be read as a file
+	if _, err := reader.Asset(filepath.Join(dir, "scripts", "run.sh")); err == nil {
+		t.Errorf("Asset() the script must not be an asset")
+	}
+	b, err := reader.File(filepath.Join(dir, "scripts", "run.sh"))
+	if err != nil || string(b) != "run" {
+		t.Errorf("File() = %q, %v, want %q", b, err, "run")
+	}
+	if _, err := reader.File(filepath.Join(dir, "scripts", "ignored.sh")); err == nil {
+		t.Errorf("File() the ignored file must not be read")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright Red Hat
+
+package asset
+
+import (
+	"io/fs"
+)
+
+//FSReader defines a reader on top of any fs.FS such as embed.FS, os.DirFS, fstest.MapFS, zip.Reader...
+type FSReader struct {
+	fsys       fs.FS
+	extensions []string
+}
+
+var _ ScenarioReader = &FSReader{
+	fsys:       nil,
+	extensions: nil,
+}
+
+var _ FileReader = &FSReader{
+	fsys:       nil,
+	extensions: nil,
+}
+
+//NewFSReader constructs a new FSReader selecting the files with the DefaultExtensions
+func NewFSReader(fsys fs.FS) *FSReader {
+	return NewFSReaderWithExtensions(fsys, DefaultExtensions)
+}
+
+//NewFSReaderWithExtensions constructs a new FSReader selecting the files with one of the extensions,
+//if extensions is empty all files are selected.
+//The files explicitly listed in the AssetNames prefixes are always selected.
+func NewFSReaderWithExtensions(fsys fs.FS, extensions []string) *FSReader {
+	return &FSReader{
+		fsys:       fsys,
+		extensions: extensions,
+	}
+}
+
+//Asset returns an asset
+func (r *FSReader) Asset(name string) ([]byte, error) {
+	return fs.ReadFile(r.fsys, name)
+}
+
+//AssetNames returns the name of all assets
+func (r *FSReader) AssetNames(prefixes, excluded []string, headerFile string) ([]string, error) {
+	matcher, err := newPatternMatcher(prefixes, excluded)
+	if err != nil {
+		return nil, err
+	}
+	assetNames := make([]string, 0)
+	got, err := r.walk(".")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range got {
+		if !matcher.isExcluded(f, prefixes, excluded) && isSelected(f, prefixes, r.extensions) {
+			assetNames = append(assetNames, f)
+		}
+	}
+	// The header file must be added in the assetNames as it is retrieved latter
+	// to render asset in the MustTemplateAsset
+	assetNames = AppendItNotExists(assetNames, headerFile)
+	return assetNames, nil
+}
+
+//File returns a file whatever its extension
+func (r *FSReader) File(name string) ([]byte, error) {
+	return fs.ReadFile(r.fsys, name)
+}
+
+//FileNames returns the name of all files whatever their extension
+func (r *FSReader) FileNames() ([]string, error) {
+	return r.walk(".")
+}
+
+//walk returns the name of all files located under root in lexical order
+func (r *FSReader) walk(root string) ([]string, error) {
+	assets := make([]string, 0)
+	err := fs.WalkDir(r.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		assets = append(assets, name)
+		return nil
+	})
+	return assets, err
+}
@@ -0,0 +1,124 @@
+// Copyright Red Hat
+
+package asset
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSReader_AssetNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir1/file1.yaml": &fstest.MapFile{Data: []byte("file1content")},
+		"dir1/file2.yaml": &fstest.MapFile{Data: []byte("file2content")},
+		"dir2/file3.yaml": &fstest.MapFile{Data: []byte("file3content")},
+		"header.txt":      &fstest.MapFile{Data: []byte("header")},
+	}
+	type args struct {
+		prefixes, excluded []string
+		headerFile         string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all files with default extensions",
+			args: args{},
+			want: []string{"dir1/file1.yaml", "dir1/file2.yaml", "dir2/file3.yaml"},
+		},
+		{
+			name: "explicit file without default extension",
+			args: args{
+				prefixes: []string{"dir1/file1.yaml", "header.txt"},
+			},
+			want: []string{"dir1/file1.yaml", "header.txt"},
+		},
+		{
+			name: "prefix and excluded",
+			args: args{
+				prefixes: []string{"dir1"},
+				excluded: []string{"dir1/file2.yaml"},
+			},
+			want: []string{"dir1/file1.yaml"},
+		},
+		{
+			name: "prefix with header",
+			args: args{
+				prefixes:   []string{"dir2"},
+				headerFile: "header.txt",
+			},
+			want: []string{"dir2/file3.yaml", "header.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewFSReader(fsys)
+			got, err := r.AssetNames(tt.args.prefixes, tt.args.excluded, tt.args.headerFile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FSReader.AssetNames() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FSReader.AssetNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFSReader_Asset(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.WriteFile(filepath.Join(dir, "file1.yaml"), []byte("file1content"), 0600)
+	if err != nil {
+		t.Error(err)
+	}
+	tests := []struct {
+		name    string
+		fsys    fs.FS
+		asset   string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:  "mapfs",
+			fsys:  fstest.MapFS{"file1.yaml": &fstest.MapFile{Data: []byte("file1content")}},
+			asset: "file1.yaml",
+			want:  []byte("file1content"),
+		},
+		{
+			name:  "dirfs",
+			fsys:  os.DirFS(dir),
+			asset: "file1.yaml",
+			want:  []byte("file1content"),
+		},
+		{
+			name:    "not found",
+			fsys:    os.DirFS(dir),
+			asset:   "file2.yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewFSReader(tt.fsys)
+			got, err := r.Asset(tt.asset)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FSReader.Asset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FSReader.Asset() = %v, want %v", string(got), string(tt.want))
+			}
+		})
+	}
+}
@@ -2,13 +2,26 @@
 
 package asset
 
+import (
+	"io/fs"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+//MemFS defines an in-memory reader, the assets can be added, removed or renamed
 type MemFS struct {
 	files []string
 	data  map[string][]byte
 }
 
-var _ ScenarioReader = &ScenarioResourcesReader{
+var _ ScenarioReader = &MemFS{
 	files: nil,
+	data:  nil,
+}
+
+var _ FileReader = &MemFS{
+	files: nil,
+	data:  nil,
 }
 
 func NewMemFSReader() *MemFS {
@@ -19,6 +32,29 @@ func NewMemFSReader() *MemFS {
 	}
 }
 
+//NewMemFSReaderFromFS constructs a MemFS containing a copy of all files of the fs.FS
+func NewMemFSReaderFromFS(fsys fs.FS) (*MemFS, error) {
+	r := NewMemFSReader()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		r.AddAsset(name, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (r *MemFS) AddAssetsFromScenarioReader(reader ScenarioReader, headerFile string) error {
 	assets, err := reader.AssetNames(nil, nil, headerFile)
 	if err != nil {
@@ -34,19 +70,87 @@ func (r *MemFS) AddAssetsFromScenarioReader(reader ScenarioReader, headerFile st
 	return nil
 }
 
+//AddAsset adds an asset, if the asset already exists its content is overwritten
+//and it keeps its position.
 func (r *MemFS) AddAsset(fileName string, data []byte) {
-	r.files = append(r.files, fileName)
+	if _, ok := r.data[fileName]; !ok {
+		r.files = append(r.files, fileName)
+	}
 	r.data[fileName] = data
 }
 
+//RemoveAsset removes an asset
+func (r *MemFS) RemoveAsset(fileName string) error {
+	if _, ok := r.data[fileName]; !ok {
+		return notFoundError(fileName)
+	}
+	for i, f := range r.files {
+		if f == fileName {
+			r.files = append(r.files[:i], r.files[i+1:]...)
+			break
+		}
+	}
+	delete(r.data, fileName)
+	return nil
+}
+
+//RenameAsset renames an asset, the new name takes the position of the old one.
+//If an asset with the new name already exists, it is replaced.
+func (r *MemFS) RenameAsset(oldName, newName string) error {
+	b, ok := r.data[oldName]
+	if !ok {
+		return notFoundError(oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, ok := r.data[newName]; ok {
+		if err := r.RemoveAsset(newName); err != nil {
+			return err
+		}
+	}
+	for i, f := range r.files {
+		if f == oldName {
+			r.files[i] = newName
+			break
+		}
+	}
+	delete(r.data, oldName)
+	r.data[newName] = b
+	return nil
+}
+
 func (r *MemFS) Asset(name string) ([]byte, error) {
-	return r.data[name], nil
+	b, ok := r.data[name]
+	if !ok {
+		return nil, notFoundError(name)
+	}
+	return b, nil
 }
 
+//Glob returns the name of all assets matching the doublestar glob pattern
+func (r *MemFS) Glob(pattern string) ([]string, error) {
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, doublestar.ErrBadPattern
+	}
+	assetNames := make([]string, 0)
+	for _, f := range r.files {
+		if ok, _ := doublestar.Match(pattern, f); ok {
+			assetNames = append(assetNames, f)
+		}
+	}
+	return assetNames, nil
+}
+
+//AssetNames returns the name of all assets, the prefixes and excluded can be glob or regex patterns
 func (r *MemFS) AssetNames(prefixes, excluded []string, headerFile string) ([]string, error) {
+	matcher, err := newPatternMatcher(prefixes, excluded)
+	if err != nil {
+		return nil, err
+	}
 	assetNames := make([]string, 0)
 	for _, f := range r.files {
-		if !isExcluded(f, prefixes, excluded) {
+		if !matcher.isExcluded(f, prefixes, excluded) {
 			assetNames = append(assetNames, f)
 		}
 	}
@@ -55,3 +159,17 @@ func (r *MemFS) AssetNames(prefixes, excluded []string, headerFile string) ([]st
 	assetNames = AppendItNotExists(assetNames, headerFile)
 	return assetNames, nil
 }
+
+//File returns an asset, all files of a MemFS are assets
+func (r *MemFS) File(name string) ([]byte, error) {
+	return r.Asset(name)
+}
+
+//FileNames returns the name of all assets
+func (r *MemFS) FileNames() ([]string, error) {
+	return append([]string{}, r.files...), nil
+}
+
+func notFoundError(name string) error {
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -3,9 +3,12 @@
 package asset
 
 import (
+	"errors"
+	"io/fs"
 	"reflect"
 	"sort"
 	"testing"
+	"testing/fstest"
 )
 
 func TestMemFS_AssetNames(t *testing.T) {
@@ -126,3 +129,219 @@ func TestMemFS_Asset(t *testing.T) {
 		})
 	}
 }
+
+func TestMemFS_AssetNotFound(t *testing.T) {
+	r := NewMemFSReader()
+	r.AddAsset("file1", []byte("file1content"))
+	_, err := r.Asset("file2")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("MemFS.Asset() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestMemFS_AddAsset(t *testing.T) {
+	r := NewMemFSReader()
+	r.AddAsset("file1", []byte("file1content"))
+	r.AddAsset("file2", []byte("file2content"))
+	r.AddAsset("file1", []byte("file1newcontent"))
+	got, err := r.AssetNames(nil, nil, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(got, []string{"file1", "file2"}) {
+		t.Errorf("MemFS.AssetNames() = %v, want %v", got, []string{"file1", "file2"})
+	}
+	b, err := r.Asset("file1")
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "file1newcontent" {
+		t.Errorf("expect %s got %s", "file1newcontent", string(b))
+	}
+}
+
+func TestMemFS_RemoveAsset(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "remove existing",
+			fileName: "file2",
+			want:     []string{"file1", "file3"},
+			wantErr:  false,
+		},
+		{
+			name:     "remove not existing",
+			fileName: "file4",
+			want:     []string{"file1", "file2", "file3"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemFSReader()
+			r.AddAsset("file1", []byte("file1content"))
+			r.AddAsset("file2", []byte("file2content"))
+			r.AddAsset("file3", []byte("file3content"))
+			if err := r.RemoveAsset(tt.fileName); (err != nil) != tt.wantErr {
+				t.Errorf("MemFS.RemoveAsset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := r.AssetNames(nil, nil, "")
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MemFS.AssetNames() = %v, want %v", got, tt.want)
+			}
+			if _, err := r.Asset(tt.fileName); err == nil {
+				t.Errorf("MemFS.Asset() expected error for %s", tt.fileName)
+			}
+		})
+	}
+}
+
+func TestMemFS_RenameAsset(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldName string
+		newName string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "rename existing",
+			oldName: "file1",
+			newName: "file4",
+			want:    []string{"file4", "file2", "file3"},
+			wantErr: false,
+		},
+		{
+			name:    "rename on existing",
+			oldName: "file1",
+			newName: "file3",
+			want:    []string{"file3", "file2"},
+			wantErr: false,
+		},
+		{
+			name:    "rename not existing",
+			oldName: "file5",
+			newName: "file4",
+			want:    []string{"file1", "file2", "file3"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemFSReader()
+			r.AddAsset("file1", []byte("file1content"))
+			r.AddAsset("file2", []byte("file2content"))
+			r.AddAsset("file3", []byte("file3content"))
+			if err := r.RenameAsset(tt.oldName, tt.newName); (err != nil) != tt.wantErr {
+				t.Errorf("MemFS.RenameAsset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			got, err := r.AssetNames(nil, nil, "")
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MemFS.AssetNames() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			b, err := r.Asset(tt.newName)
+			if err != nil {
+				t.Error(err)
+			}
+			if string(b) != "file1content" {
+				t.Errorf("expect %s got %s", "file1content", string(b))
+			}
+		})
+	}
+}
+
+func TestMemFS_GlobAssetNames(t *testing.T) {
+	type args struct {
+		prefixes, excluded []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "glob prefix",
+			args: args{
+				prefixes: []string{"dir1/*.yaml"},
+			},
+			want:    []string{"dir1/file1.yaml"},
+			wantErr: false,
+		},
+		{
+			name: "glob excluded",
+			args: args{
+				prefixes: []string{"dir1", "dir2"},
+				excluded: []string{"*/README.md"},
+			},
+			want:    []string{"dir1/file1.yaml", "dir2/file2.yaml"},
+			wantErr: false,
+		},
+		{
+			name: "bad pattern",
+			args: args{
+				prefixes: []string{"dir1/[.yaml"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemFSReader()
+			r.AddAsset("dir1/file1.yaml", []byte("file1content"))
+			r.AddAsset("dir1/README.md", []byte("readme"))
+			r.AddAsset("dir2/file2.yaml", []byte("file2content"))
+			r.AddAsset("dir2/README.md", []byte("readme"))
+			got, err := r.AssetNames(tt.args.prefixes, tt.args.excluded, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MemFS.AssetNames() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MemFS.AssetNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMemFSReaderFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir1/file1.yaml": &fstest.MapFile{Data: []byte("file1content")},
+		"file2.yaml":      &fstest.MapFile{Data: []byte("file2content")},
+	}
+	r, err := NewMemFSReaderFromFS(fsys)
+	if err != nil {
+		t.Error(err)
+	}
+	got, err := r.AssetNames(nil, nil, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(got, []string{"dir1/file1.yaml", "file2.yaml"}) {
+		t.Errorf("MemFS.AssetNames() = %v, want %v", got, []string{"dir1/file1.yaml", "file2.yaml"})
+	}
+	b, err := r.Asset("dir1/file1.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "file1content" {
+		t.Errorf("expect %s got %s", "file1content", string(b))
+	}
+}
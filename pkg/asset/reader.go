@@ -10,3 +10,12 @@ type ScenarioReader interface {
 	// excluding the name in the excluded array
 	AssetNames(prefixes, excluded []string, headerFile string) ([]string, error)
 }
+
+//FileReader is implemented by the readers giving access to all the files of the data source
+//whatever their extension, such as the scripts or the config files kept next to the templates.
+type FileReader interface {
+	// Retrieve a file from the data source
+	File(name string) ([]byte, error)
+	// List all files of the data source
+	FileNames() ([]string, error)
+}
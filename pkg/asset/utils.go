@@ -2,16 +2,26 @@
 package asset
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/ghodss/yaml"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/kustomize/api/konfig"
 )
 
+//ToJSON converts a YAML or JSON content to JSON
 func ToJSON(b []byte) ([]byte, error) {
+	// JSON is returned as is, as the YAML parser rejects the JSON indented with tabs
+	if json.Valid(b) {
+		return b, nil
+	}
 	j, err := yaml.YAMLToJSON(b)
 	if err != nil {
 		klog.Errorf("err:%s\nyaml:\n%s", err, string(b))
@@ -51,28 +61,194 @@ func ExtractAssets(r ScenarioReader, prefix, dir string, excluded []string, head
 	return nil
 }
 
-func isExcluded(f string, prefixes, excluded []string) bool {
-	isExcluded := false
-	for _, e := range excluded {
-		if f == e {
-			isExcluded = true
+//DefaultExtensions are the extensions of the files selected by default when walking a directory
+var DefaultExtensions = []string{".yaml", ".yml", ".json", ".tpl"}
+
+//hasExtension returns true if the file has one of the extensions or if there is no extensions
+func hasExtension(f string, extensions []string) bool {
+	if len(extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(f)
+	for _, e := range extensions {
+		if ext == e || ext == "."+e {
+			return true
 		}
 	}
-	// Already excluded
-	if isExcluded {
+	return false
+}
+
+//isSelected returns true if the file has one of the extensions or is explicitly listed in the prefixes
+func isSelected(f string, prefixes, extensions []string) bool {
+	if hasExtension(f, extensions) {
 		return true
 	}
+	for _, p := range prefixes {
+		if f == p {
+			return true
+		}
+	}
+	return false
+}
+
+//IsPartial returns true if the file contains only named templates shared by the other templates,
+//as the helm _helpers.tpl, such file starts with a "_" or has a ".tpl" extension.
+//A partial is loaded before each template like the header and is not rendered as an object.
+func IsPartial(f string) bool {
+	return strings.HasPrefix(filepath.Base(f), "_") || filepath.Ext(f) == ".tpl"
+}
+
+//IsKustomization returns true if the file is a kustomization file, such file is built
+//with kustomize instead of being rendered as a template.
+func IsKustomization(f string) bool {
+	base := filepath.Base(f)
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
+//InKustomization returns true if the file is located in the directory of a kustomization file
+//of the files or in one of its subdirectories, such file is part of the kustomization
+//and is not rendered on its own. The nested kustomizations are part of the outer one.
+func InKustomization(f string, files []string) bool {
+	for _, k := range files {
+		if k == f || !IsKustomization(k) {
+			continue
+		}
+		dir := filepath.Dir(filepath.Clean(k))
+		rel, err := filepath.Rel(dir, filepath.Dir(filepath.Clean(f)))
+		if err != nil {
+			continue
+		}
+		if rel == "." && IsKustomization(f) {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+//RegexPatternPrefix is the prefix of a path or exclude pattern which is a regular expression
+const RegexPatternPrefix = "regex:"
+
+//isExcluded returns true if the file is in the excluded list or doesn't start with one of the prefixes.
+//The prefixes and excluded can be doublestar glob patterns (ie: examples/**/test-*.yaml) or
+//regular expressions prefixed by RegexPatternPrefix, in that case the file must match the pattern
+//or be located in a directory matching the pattern. The excluded which are not patterns must be equal to the file.
+func (m patternMatcher) isExcluded(f string, prefixes, excluded []string) bool {
+	for _, e := range excluded {
+		if isPattern(e) {
+			if m.match(e, f) {
+				return true
+			}
+			continue
+		}
+		if f == e {
+			return true
+		}
+	}
 	// No extra test to do
 	if prefixes == nil {
 		return false
 	}
-	isExcluded = true
 	for _, d := range prefixes {
+		if isPattern(d) {
+			if m.match(d, f) {
+				return false
+			}
+			continue
+		}
 		if strings.HasPrefix(f, d) {
-			isExcluded = false
+			return false
+		}
+	}
+	return true
+}
+
+//isPattern returns true if p is a regular expression or a glob pattern
+func isPattern(p string) bool {
+	return strings.HasPrefix(p, RegexPatternPrefix) || strings.ContainsAny(p, "*?[{")
+}
+
+//patternMatcher matches the names against the patterns, it holds the compiled regular expressions
+//so they are compiled once while the files are walked.
+type patternMatcher map[string]*regexp.Regexp
+
+//newPatternMatcher checks the syntax of the glob and regex patterns and compiles the regular expressions
+func newPatternMatcher(patterns ...[]string) (patternMatcher, error) {
+	m := make(patternMatcher)
+	for _, ps := range patterns {
+		for _, p := range ps {
+			if !isPattern(p) {
+				continue
+			}
+			if strings.HasPrefix(p, RegexPatternPrefix) {
+				re, err := regexp.Compile(strings.TrimPrefix(p, RegexPatternPrefix))
+				if err != nil {
+					return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+				}
+				m[p] = re
+				continue
+			}
+			if !doublestar.ValidatePattern(filepath.ToSlash(p)) {
+				return nil, fmt.Errorf("invalid pattern %s: %w", p, doublestar.ErrBadPattern)
+			}
 		}
 	}
-	return isExcluded
+	return m, nil
+}
+
+//match returns true if the name or one of its parent directories matches the pattern
+func (m patternMatcher) match(pattern, name string) bool {
+	name = filepath.ToSlash(name)
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		re, ok := m[pattern]
+		if !ok {
+			var err error
+			re, err = regexp.Compile(strings.TrimPrefix(pattern, RegexPatternPrefix))
+			if err != nil {
+				return false
+			}
+			m[pattern] = re
+		}
+		return re.MatchString(name)
+	}
+	return matchGlob(filepath.ToSlash(pattern), name)
+}
+
+//matchGlob returns true if the slash separated name or one of its parent directories matches the glob pattern
+func matchGlob(pattern, name string) bool {
+	if ok, _ := doublestar.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := doublestar.Match(strings.TrimSuffix(pattern, "/")+"/**", name)
+	return ok
+}
+
+//patternBase returns the directory from where the files must be walked to find the ones matching the pattern
+func patternBase(pattern string) string {
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		return "."
+	}
+	base, _ := doublestar.SplitPattern(filepath.ToSlash(pattern))
+	return filepath.FromSlash(base)
+}
+
+//PathBase returns the file or the directory from where the files selected by the path are read,
+//the base directory of a glob pattern and the current directory for a regex
+func PathBase(p string) string {
+	if !isPattern(p) {
+		return p
+	}
+	if base := patternBase(p); len(base) != 0 {
+		return base
+	}
+	return "."
 }
 
 func AppendItNotExists(a []string, e string) []string {
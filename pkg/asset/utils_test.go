@@ -66,3 +66,74 @@ func TestMemFS_ExtractAssets(t *testing.T) {
 		})
 	}
 }
+
+func TestInKustomization(t *testing.T) {
+	files := []string{
+		"overlay/kustomization.yaml",
+		"overlay/patch.yaml",
+		"overlay/nested/kustomization.yaml",
+		"overlay/nested/deployment.yaml",
+		"overlays/deployment.yaml",
+		"templates/deployment.yaml",
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "overlay/kustomization.yaml", want: false},
+		{name: "overlay/patch.yaml", want: true},
+		{name: "overlay/nested/kustomization.yaml", want: true},
+		{name: "overlay/nested/deployment.yaml", want: true},
+		{name: "overlays/deployment.yaml", want: false},
+		{name: "templates/deployment.yaml", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InKustomization(tt.name, files); got != tt.want {
+				t.Errorf("InKustomization() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathBase(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "templates", want: "templates"},
+		{path: "templates/deployment.yaml", want: "templates/deployment.yaml"},
+		{path: "templates/**/*.yaml", want: "templates"},
+		{path: "*.yaml", want: "."},
+		{path: "regex:^templates/.*\\.yaml$", want: "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := PathBase(tt.path); got != tt.want {
+				t.Errorf("PathBase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasExtension(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		extensions []string
+		want       bool
+	}{
+		{name: "with dot", file: "a.yaml", extensions: []string{".yaml"}, want: true},
+		{name: "without dot", file: "a.yaml", extensions: []string{"yaml"}, want: true},
+		{name: "other extension", file: "a.yml", extensions: []string{"yaml", ".json"}, want: false},
+		{name: "no extension", file: "Makefile", extensions: []string{"yaml"}, want: false},
+		{name: "no extensions", file: "a.md", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasExtension(tt.file, tt.extensions); got != tt.want {
+				t.Errorf("hasExtension() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
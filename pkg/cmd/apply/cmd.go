@@ -3,7 +3,10 @@ package apply
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
 	"github.com/stolostron/applier/pkg/cmd/apply/core"
 	"github.com/stolostron/applier/pkg/cmd/apply/customresources"
 	"github.com/stolostron/applier/pkg/cmd/apply/deployments"
@@ -17,6 +20,12 @@ import (
 var example = `
 # Apply templates
 %[1]s apply --values values.yaml --path template_path1 --path tempalte_path2...
+
+# Apply a local helm chart
+%[1]s apply --values values.yaml --chart chart_path
+
+# Apply templates again when the files change or when a resource drifts until interrupted
+%[1]s apply --values values.yaml --path template_path --watch --reapply-on-drift
 `
 
 // NewCmd ...
@@ -38,12 +47,34 @@ func NewCmd(applierFlags *genericclioptionsapplier.ApplierFlags, streams generic
 	}
 
 	cmd.Flags().BoolVar(&o.options.ApplierFlags.DryRun, "dry-run", false, "If set the resources will not be applied")
-	cmd.Flags().StringVar(&o.options.Header, "header", "", "The files which will be added to each template")
+	cmd.Flags().StringArrayVar(&o.options.Headers, "header", []string{}, "A file added at the beginning of each template, can be repeated")
+	cmd.Flags().StringVar(&o.options.PartialsDir, "partials-dir", "", "The directory containing the partials shared by all templates, like the helm _helpers.tpl")
 	cmd.Flags().StringVar(&o.options.OutputFile, "output-file", "", "The generated resources will be copied in the specified file")
+	cmd.Flags().BoolVar(&o.options.TemplateContext, "template-context", false, "If set the values are wrapped in a template context exposing .Values, .Release, .Capabilities, .Template and .Files")
+	cmd.Flags().StringVar(&o.options.ReleaseName, "release-name", "", "The name exposed as .Release.Name in the template context")
+	cmd.Flags().StringVar(&o.options.ReleaseNamespace, "release-namespace", "default", "The namespace exposed as .Release.Namespace in the template context")
 	cmd.Flags().StringVar(&o.options.ValuesPath, "values", "", "The files containing the values")
-	cmd.Flags().StringArrayVar(&o.options.Paths, "path", []string{}, "The list of template paths")
-	cmd.Flags().StringArrayVar(&o.options.Exclude, "exclude", []string{}, "The list of paths to exclude")
+	common.AddAgeKeyFileFlag(cmd.Flags(), &o.options.AgeKeyFile)
+	cmd.Flags().StringVar(&o.options.PostRenderer, "post-renderer", "", "The path to an executable receiving the rendered resources as YAML on stdin and writing the resources to use on stdout, like the helm post-renderers")
+	cmd.Flags().StringArrayVar(&o.options.PostRendererArgs, "post-renderer-args", []string{}, "An argument passed to the post-renderer, can be repeated")
+	cmd.Flags().StringArrayVar(&o.options.PatchPaths, "patch", []string{}, "A file containing strategic merge patches or kustomize like patch entries with a target, applied to the rendered resources, can be repeated")
+	cmd.Flags().StringArrayVar(&o.options.Images, "image", []string{}, "An image override formatted as old=new[@digest], applied to the containers and init containers of the rendered workloads, an old image without tag matches all its tags, can be repeated")
+	cmd.Flags().BoolVar(&o.options.Validation, "validate", false, "If set the rendered resources are validated against the OpenAPI schemas of the cluster or of --schema-dir and the CRDs found in the resources, nothing is applied if a resource is invalid")
+	cmd.Flags().StringVar(&o.options.SchemaDir, "schema-dir", "", "A directory containing OpenAPI v2 documents (ie: kubectl get --raw /openapi/v2) and CRDs used by --validate instead of the schemas of the cluster")
+	cmd.Flags().StringArrayVar(&o.options.PolicyPaths, "policy", []string{}, "A file containing CEL policy rules checked against the rendered resources, the resource is the object variable and complies with a rule if its expression is true, can be repeated")
+	cmd.Flags().BoolVar(&o.options.BuiltinPolicies, "builtin-policies", false, "If set the rendered resources are checked against the built-in policy rules: no-privileged, no-host-path and no-latest-image")
+	cmd.Flags().StringVar(&o.options.PolicyMode, "policy-mode", "enforce", "The policy mode, enforce: nothing is applied if a resource violates a policy rule, warn: the violations are logged")
+	cmd.Flags().BoolVar(&o.options.CheckAPIVersions, "check-api-versions", false, "If set the apiVersions of the rendered resources are checked against the Kubernetes version of the cluster, nothing is applied if a resource uses a removed apiVersion and the deprecated apiVersions are logged")
+	cmd.Flags().BoolVar(&o.options.ConvertAPIVersions, "convert-api-versions", false, "If set with --check-api-versions the resources using a deprecated apiVersion having the same schema as its replacement, such as policy/v1beta1 PodDisruptionBudget, are converted to the replacement")
+	cmd.Flags().StringVar(&o.options.Chart, "chart", "", "A local helm chart directory or packaged chart (.tgz) rendered with the values and applied instead of the paths")
+	cmd.Flags().StringArrayVar(&o.options.Paths, "path", []string{}, "The list of template paths, a path can be a glob pattern (ie: templates/**/*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringArrayVar(&o.options.Exclude, "exclude", []string{}, "The list of paths to exclude, a path can be a glob pattern (ie: templates/**/test-*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringSliceVar(&o.options.Extensions, "extensions", asset.DefaultExtensions, "The extensions of the files to select in the directories, the files explicitly listed in --path are always selected")
 	cmd.Flags().BoolVar(&o.options.SortOnKind, "sort-on-kind", true, "If set the files will be sorted by their kind (default true)")
+	cmd.Flags().BoolVar(&o.watch, "watch", false, "If set the command keeps running and applies the resources again when the templates, values, headers, partials, patches, policies or chart change")
+	cmd.Flags().DurationVar(&o.watchDebounce, "watch-debounce", 2*time.Second, "The delay during which the changes are merged in a single apply in watch mode")
+	cmd.Flags().DurationVar(&o.reconcileInterval, "reconcile-interval", 0, "The interval at which the resources are applied again in watch mode, 0 disables the periodic apply")
+	cmd.Flags().BoolVar(&o.reapplyOnDrift, "reapply-on-drift", false, "If set with --watch the applied resources are watched and applied again when one is modified out of band or deleted")
 
 	cmd.AddCommand(core.NewCmd(applierFlags, streams))
 	cmd.AddCommand(customresources.NewCmd(applierFlags, streams))
@@ -10,44 +10,65 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/stolostron/applier/pkg/apply"
 	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/sops"
 )
 
 func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
-	// Convert yaml to map[string]interface
-	b := []byte("")
-	switch {
-	case len(o.ValuesPath) == 0:
+	if len(o.ValuesPath) == 0 {
 		// check if pipe
 		fi, err := os.Stdin.Stat()
 		if err != nil {
 			return err
 		}
 		if fi.Mode()&os.ModeCharDevice == 0 {
-			b, err = ioutil.ReadAll(os.Stdin)
+			o.stdinValues, err = ioutil.ReadAll(os.Stdin)
 			if err != nil {
 				return err
 			}
 		}
-	case len(o.ValuesPath) != 0:
+	}
+	// The sops encrypted values are decrypted with the age keys loaded on the first decryption
+	o.Decrypter = sops.LoadDecrypter(o.AgeKeyFile)
+	return o.Load()
+}
+
+//Load reads the values, the patches and the image overrides, it is called again in watch mode
+//when the files change and the values read from stdin are reused.
+func (o *Options) Load() (err error) {
+	// Convert yaml to map[string]interface
+	b := o.stdinValues
+	if len(o.ValuesPath) != 0 {
 		b, err = ioutil.ReadFile(o.ValuesPath)
 		if err != nil {
 			return err
 		}
 	}
+	b, err = o.Decrypter.DecryptValues(b)
+	if err != nil {
+		return err
+	}
 	o.Values = make(map[string]interface{})
 	if err := yaml.Unmarshal(b, &o.Values); err != nil {
 		return err
 	}
+	o.Patches, err = apply.LoadPatches(o.PatchPaths...)
+	if err != nil {
+		return err
+	}
+	o.ImageOverrides, err = apply.ParseImageOverrides(o.Images)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 func (o *Options) Validate() error {
-	reader, err := asset.NewDirectoriesReader(o.Header, o.Paths)
+	reader, err := asset.NewDirectoriesReaderWithExtensions("", o.Paths, o.Extensions)
 	if err != nil {
 		return err
 	}
 
-	assetNames, err := reader.AssetNames(o.Paths, nil, o.Header)
+	assetNames, err := reader.AssetNames(o.Paths, o.ExcludedPartials(), "")
 	if err != nil {
 		return err
 	}
@@ -58,17 +79,19 @@ func (o *Options) Validate() error {
 }
 
 func (o *Options) Run() error {
-	restConfig, err := o.ApplierFlags.KubectlFactory.ToRESTConfig()
+	applyBuilder, err := o.NewApplierBuilder()
 	if err != nil {
 		return err
 	}
-	applyBuilder := apply.NewApplierBuilder().WithRestConfig(restConfig)
-	reader, err := asset.NewDirectoriesReader(o.Header, o.Paths)
+	reader, err := asset.NewDirectoriesReaderWithExtensions("", o.Paths, o.Extensions)
 	if err != nil {
 		return err
 	}
-	o.Exclude = append(o.Exclude, o.Header)
-	files, err := reader.AssetNames(o.Paths, o.Exclude, o.Header)
+	applyBuilder, exclude, err := o.WithPartials(applyBuilder)
+	if err != nil {
+		return err
+	}
+	files, err := reader.AssetNames(o.Paths, exclude, "")
 	if err != nil {
 		return err
 	}
@@ -79,16 +102,108 @@ func (o *Options) Run() error {
 			applyBuilder = applyBuilder.WithKindOrder(apply.NoCreateUpdateKindsOrder)
 		}
 		applier := applyBuilder.Build()
-		output, err = applier.ApplyDirectly(reader, o.Values, o.ApplierFlags.DryRun, o.Header, files...)
+		output, err = applier.ApplyDirectly(reader, o.Values, o.ApplierFlags.DryRun, "", files...)
 	case Deployments:
 		applier := applyBuilder.Build()
-		output, err = applier.ApplyDeployments(reader, o.Values, o.ApplierFlags.DryRun, o.Header, files...)
+		output, err = applier.ApplyDeployments(reader, o.Values, o.ApplierFlags.DryRun, "", files...)
 	case CustomResources:
 		applier := applyBuilder.Build()
-		output, err = applier.ApplyCustomResources(reader, o.Values, o.ApplierFlags.DryRun, o.Header, files...)
+		output, err = applier.ApplyCustomResources(reader, o.Values, o.ApplierFlags.DryRun, "", files...)
 	}
 	if err != nil {
 		return err
 	}
 	return apply.WriteOutput(o.OutputFile, output)
 }
+
+//NewApplierBuilder returns the applier builder configured by the options with the clients
+//of the cluster, the partials and the kinds order are set by the commands.
+func (o *Options) NewApplierBuilder() (*apply.ApplierBuilder, error) {
+	restConfig, err := o.ApplierFlags.KubectlFactory.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	applyBuilder, err := o.NewRenderApplierBuilder()
+	if err != nil {
+		return nil, err
+	}
+	applyBuilder = applyBuilder.WithRestConfig(restConfig)
+	if o.Validation {
+		validator, err := apply.LoadValidator(o.SchemaDir, o.ApplierFlags)
+		if err != nil {
+			return nil, err
+		}
+		applyBuilder = applyBuilder.WithValidator(validator)
+	}
+	return applyBuilder, nil
+}
+
+//NewRenderApplierBuilder returns the applier builder configured by the options without
+//the clients of the cluster and without the validator.
+func (o *Options) NewRenderApplierBuilder() (*apply.ApplierBuilder, error) {
+	applyBuilder := apply.NewApplierBuilder()
+	applyBuilder = applyBuilder.WithDecrypter(o.Decrypter)
+	applyBuilder = applyBuilder.WithPatches(o.Patches...)
+	applyBuilder = applyBuilder.WithImageOverrides(o.ImageOverrides)
+	policy, err := apply.LoadPolicy(apply.PolicyMode(o.PolicyMode), o.BuiltinPolicies, o.PolicyPaths...)
+	if err != nil {
+		return nil, err
+	}
+	applyBuilder = applyBuilder.WithPolicy(policy)
+	if o.CheckAPIVersions {
+		checker, err := o.APIVersionChecker()
+		if err != nil {
+			return nil, err
+		}
+		applyBuilder = applyBuilder.WithAPIVersionChecker(checker)
+	}
+	if len(o.PostRenderer) != 0 {
+		postRenderer, err := apply.NewExecPostRenderer(o.PostRenderer, o.PostRendererArgs...)
+		if err != nil {
+			return nil, err
+		}
+		applyBuilder = applyBuilder.WithExecPostRenderer(postRenderer)
+	}
+	// The release of a chart is always set, it is named after the chart by default
+	if o.TemplateContext || len(o.Chart) != 0 {
+		applyBuilder = applyBuilder.WithTemplateContext(apply.Release{
+			Name:      o.ReleaseName,
+			Namespace: o.ReleaseNamespace,
+		})
+		if len(o.KubeVersion) != 0 || len(o.APIVersions) != 0 {
+			kubeVersion := o.KubeVersion
+			if len(kubeVersion) == 0 {
+				kubeVersion = apply.DefaultCapabilities().KubeVersion.Version
+			}
+			capabilities, err := apply.NewCapabilities(kubeVersion, o.APIVersions)
+			if err != nil {
+				return nil, err
+			}
+			applyBuilder = applyBuilder.WithCapabilities(*capabilities)
+		}
+	}
+	return applyBuilder, nil
+}
+
+//WithPartials adds the header files and the partials to the applier builder and returns
+//the exclusions completed with them, the exclusions of the options are not modified.
+//The header files are parsed before each template and the named templates of the partials
+//directory are shared by all templates.
+func (o *Options) WithPartials(applyBuilder *apply.ApplierBuilder) (*apply.ApplierBuilder, []string, error) {
+	exclude := append(append([]string{}, o.Exclude...), o.ExcludedPartials()...)
+	if headers := o.HeaderFiles(); len(headers) != 0 {
+		headersReader, err := asset.NewDirectoriesReaderWithExtensions("", headers, o.Extensions)
+		if err != nil {
+			return nil, nil, err
+		}
+		applyBuilder = applyBuilder.WithHeaders(headersReader, headers...)
+	}
+	if len(o.PartialsDir) != 0 {
+		partialsReader, err := asset.NewDirectoriesReaderWithExtensions("", []string{o.PartialsDir}, o.Extensions)
+		if err != nil {
+			return nil, nil, err
+		}
+		applyBuilder = applyBuilder.WithPartials(partialsReader, o.PartialsDir)
+	}
+	return applyBuilder, exclude, nil
+}
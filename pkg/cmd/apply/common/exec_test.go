@@ -4,9 +4,13 @@ package common
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/stolostron/applier/pkg/apply"
+	"github.com/stolostron/applier/pkg/asset"
 	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
 )
 
@@ -167,3 +171,40 @@ func TestOptions_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_WithPartials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-partials-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"configmap.yaml", "header.txt", filepath.Join("partials", "helpers.yaml")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(`{{- define "name" }}my-cm{{ end }}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o := &Options{
+		Header:      filepath.Join(dir, "header.txt"),
+		PartialsDir: filepath.Join(dir, "partials"),
+		Paths:       []string{dir},
+	}
+	_, exclude, err := o.WithPartials(apply.NewApplierBuilder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := asset.NewDirectoriesReader("", o.Paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.AssetNames(o.Paths, exclude, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "configmap.yaml")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AssetNames() = %v, want %v", got, want)
+	}
+}
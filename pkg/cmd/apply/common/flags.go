@@ -0,0 +1,11 @@
+// Copyright Red Hat
+package common
+
+import (
+	"github.com/spf13/pflag"
+)
+
+//AddAgeKeyFileFlag adds the --age-key-file flag shared by the commands decrypting the values
+func AddAgeKeyFileFlag(flags *pflag.FlagSet, ageKeyFile *string) {
+	flags.StringVar(ageKeyFile, "age-key-file", "", "The file containing the age keys to decrypt the sops encrypted values and the values of the decrypt function, by default the keys are read like sops from the SOPS_AGE_KEY and SOPS_AGE_KEY_FILE environment variables, the other sops keys are decrypted like sops does. The keys are only read when a value is decrypted")
+}
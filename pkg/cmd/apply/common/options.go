@@ -2,7 +2,11 @@
 package common
 
 import (
+	"path/filepath"
+
+	"github.com/stolostron/applier/pkg/apply"
 	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"github.com/stolostron/applier/pkg/sops"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
@@ -17,6 +21,10 @@ type Options struct {
 	ApplierFlags *genericclioptionsapplier.ApplierFlags
 	// Header specify a file that needs to be added at the beginning of each template
 	Header string
+	// Headers specify more files added at the beginning of each template after the Header
+	Headers []string
+	// PartialsDir specify a directory containing the partials shared by all templates
+	PartialsDir string
 	//A list of Paths
 	Paths         []string
 	ValuesPath    string
@@ -26,6 +34,74 @@ type Options struct {
 	OutputFile string
 	SortOnKind bool
 	Exclude    []string
+	//The extensions of the files to select in the directories
+	Extensions []string
+	// TemplateContext wraps the values in a template context with the release
+	TemplateContext  bool
+	ReleaseName      string
+	ReleaseNamespace string
+	// AgeKeyFile is the file containing the age keys to decrypt the values
+	AgeKeyFile string
+	// Decrypter decrypts the sops encrypted values and the decrypt function values
+	Decrypter *sops.Decrypter
+	// PatchPaths are the files containing the patches applied to the rendered objects
+	PatchPaths []string
+	Patches    []apply.Patch
+	// PostRenderer is an executable receiving the rendered objects on stdin and writing them on stdout
+	PostRenderer     string
+	PostRendererArgs []string
+	// Images are the image overrides formatted as old=new[@digest]
+	Images         []string
+	ImageOverrides map[string]string
+	// Chart is a local helm chart directory or packaged chart rendered instead of the paths
+	Chart string
+	// Validation validates the rendered resources against the OpenAPI schemas of the cluster or of SchemaDir
+	Validation bool
+	SchemaDir  string
+	// PolicyPaths are the files containing CEL policy rules checked against the rendered resources
+	PolicyPaths []string
+	// BuiltinPolicies checks the rendered resources against the built-in policy rules
+	BuiltinPolicies bool
+	// PolicyMode is enforce or warn
+	PolicyMode string
+	// CheckAPIVersions checks the apiVersions of the rendered resources against the Kubernetes version
+	CheckAPIVersions bool
+	// ConvertAPIVersions converts the resources using a convertible deprecated apiVersion
+	ConvertAPIVersions bool
+	// KubeVersion and APIVersions are the capabilities of the template context,
+	// the KubeVersion is checked instead of the version of the cluster
+	KubeVersion string
+	APIVersions []string
+	// stdinValues are the values read from stdin, stdin is read only once
+	stdinValues []byte
+}
+
+//HeaderFiles returns the Header followed by the Headers
+func (o *Options) HeaderFiles() []string {
+	headers := make([]string, 0)
+	if len(o.Header) != 0 {
+		headers = append(headers, o.Header)
+	}
+	return append(headers, o.Headers...)
+}
+
+//Partials returns the header files and the partials directory, they are not rendered as templates
+func (o *Options) Partials() []string {
+	partials := o.HeaderFiles()
+	if len(o.PartialsDir) != 0 {
+		partials = append(partials, o.PartialsDir)
+	}
+	return partials
+}
+
+//ExcludedPartials returns the header files and a pattern matching the files of the partials directory,
+//they are excluded from the templates
+func (o *Options) ExcludedPartials() []string {
+	excluded := o.HeaderFiles()
+	if len(o.PartialsDir) != 0 {
+		excluded = append(excluded, filepath.Join(o.PartialsDir, "**"))
+	}
+	return excluded
 }
 
 func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
@@ -33,3 +109,16 @@ func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams gen
 		ApplierFlags: applierFlags,
 	}
 }
+
+//APIVersionChecker returns the checker of the apiVersions of the rendered resources,
+//the Kubernetes version is the KubeVersion or the one of the cluster
+func (o *Options) APIVersionChecker() (*apply.APIVersionChecker, error) {
+	if len(o.KubeVersion) != 0 {
+		return apply.NewAPIVersionChecker(o.KubeVersion, o.ConvertAPIVersions)
+	}
+	discoveryClient, err := o.ApplierFlags.KubectlFactory.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return apply.NewAPIVersionCheckerFromDiscovery(discoveryClient, o.ConvertAPIVersions)
+}
@@ -4,6 +4,7 @@ package customresources
 import (
 	"fmt"
 
+	"github.com/stolostron/applier/pkg/asset"
 	"github.com/stolostron/applier/pkg/cmd/apply/common"
 	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
 	"github.com/stolostron/applier/pkg/helpers"
@@ -44,10 +45,28 @@ func NewCmd(applierFlags *genericclioptionsapplier.ApplierFlags, streams generic
 	}
 
 	cmd.Flags().BoolVar(&o.ApplierFlags.DryRun, "dry-run", false, "If set the resources will not be applied")
-	cmd.Flags().StringVar(&o.Header, "header", "", "The files which will be added to each template")
+	cmd.Flags().StringArrayVar(&o.Headers, "header", []string{}, "A file added at the beginning of each template, can be repeated")
+	cmd.Flags().StringVar(&o.PartialsDir, "partials-dir", "", "The directory containing the partials shared by all templates, like the helm _helpers.tpl")
 	cmd.Flags().StringVar(&o.ValuesPath, "values", "", "The files containing the values")
-	cmd.Flags().StringArrayVar(&o.Paths, "path", []string{}, "The list of template paths")
+	common.AddAgeKeyFileFlag(cmd.Flags(), &o.AgeKeyFile)
+	cmd.Flags().StringVar(&o.PostRenderer, "post-renderer", "", "The path to an executable receiving the rendered resources as YAML on stdin and writing the resources to use on stdout, like the helm post-renderers")
+	cmd.Flags().StringArrayVar(&o.PostRendererArgs, "post-renderer-args", []string{}, "An argument passed to the post-renderer, can be repeated")
+	cmd.Flags().StringArrayVar(&o.PatchPaths, "patch", []string{}, "A file containing strategic merge patches or kustomize like patch entries with a target, applied to the rendered resources, can be repeated")
+	cmd.Flags().StringArrayVar(&o.Images, "image", []string{}, "An image override formatted as old=new[@digest], applied to the containers and init containers of the rendered workloads, an old image without tag matches all its tags, can be repeated")
+	cmd.Flags().BoolVar(&o.Validation, "validate", false, "If set the rendered resources are validated against the OpenAPI schemas of the cluster or of --schema-dir and the CRDs found in the resources, nothing is applied if a resource is invalid")
+	cmd.Flags().StringVar(&o.SchemaDir, "schema-dir", "", "A directory containing OpenAPI v2 documents (ie: kubectl get --raw /openapi/v2) and CRDs used by --validate instead of the schemas of the cluster")
+	cmd.Flags().StringArrayVar(&o.PolicyPaths, "policy", []string{}, "A file containing CEL policy rules checked against the rendered resources, the resource is the object variable and complies with a rule if its expression is true, can be repeated")
+	cmd.Flags().BoolVar(&o.BuiltinPolicies, "builtin-policies", false, "If set the rendered resources are checked against the built-in policy rules: no-privileged, no-host-path and no-latest-image")
+	cmd.Flags().StringVar(&o.PolicyMode, "policy-mode", "enforce", "The policy mode, enforce: nothing is applied if a resource violates a policy rule, warn: the violations are logged")
+	cmd.Flags().BoolVar(&o.CheckAPIVersions, "check-api-versions", false, "If set the apiVersions of the rendered resources are checked against the Kubernetes version of the cluster, nothing is applied if a resource uses a removed apiVersion and the deprecated apiVersions are logged")
+	cmd.Flags().BoolVar(&o.ConvertAPIVersions, "convert-api-versions", false, "If set with --check-api-versions the resources using a deprecated apiVersion having the same schema as its replacement, such as policy/v1beta1 PodDisruptionBudget, are converted to the replacement")
+	cmd.Flags().StringArrayVar(&o.Paths, "path", []string{}, "The list of template paths, a path can be a glob pattern (ie: templates/**/*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringArrayVar(&o.Exclude, "exclude", []string{}, "The list of paths to exclude, a path can be a glob pattern (ie: templates/**/test-*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringSliceVar(&o.Extensions, "extensions", asset.DefaultExtensions, "The extensions of the files to select in the directories, the files explicitly listed in --path are always selected")
 	cmd.Flags().StringArrayVar(&o.Exclude, "excluded", []string{}, "The list of paths to exclude")
 	cmd.Flags().StringVar(&o.OutputFile, "output-file", "", "The generated resources will be copied in the specified file")
+	cmd.Flags().BoolVar(&o.TemplateContext, "template-context", false, "If set the values are wrapped in a template context exposing .Values, .Release, .Capabilities, .Template and .Files")
+	cmd.Flags().StringVar(&o.ReleaseName, "release-name", "", "The name exposed as .Release.Name in the template context")
+	cmd.Flags().StringVar(&o.ReleaseNamespace, "release-namespace", "default", "The namespace exposed as .Release.Namespace in the template context")
 	return cmd
 }
@@ -3,52 +3,45 @@ package apply
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 
-	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"github.com/stolostron/applier/pkg/apply"
 	"github.com/stolostron/applier/pkg/asset"
 )
 
-func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
-	// Convert yaml to map[string]interface
-	b := []byte("")
-	switch {
-	case len(o.options.ValuesPath) == 0:
-		// check if pipe
-		fi, err := os.Stdin.Stat()
-		if err != nil {
-			return err
-		}
-		if fi.Mode()&os.ModeCharDevice == 0 {
-			b, err = ioutil.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
-		}
-	case len(o.options.ValuesPath) != 0:
-		b, err = ioutil.ReadFile(o.options.ValuesPath)
-		if err != nil {
-			return err
-		}
-	}
-	o.options.Values = make(map[string]interface{})
-	if err := yaml.Unmarshal(b, &o.options.Values); err != nil {
-		return err
-	}
-
-	return nil
+func (o *Options) Complete(cmd *cobra.Command, args []string) error {
+	return o.options.Complete(cmd, args)
 }
 
 func (o *Options) Validate() error {
-	reader, err := asset.NewDirectoriesReader(o.options.Header, o.options.Paths)
+	if o.reapplyOnDrift && !o.watch {
+		return fmt.Errorf("--reapply-on-drift can only be used with --watch")
+	}
+	if o.reapplyOnDrift && o.options.ApplierFlags.DryRun {
+		return fmt.Errorf("--reapply-on-drift and --dry-run can not be used together")
+	}
+	if o.watch && o.watchDebounce <= 0 {
+		return fmt.Errorf("--watch-debounce must be positive")
+	}
+	if o.reconcileInterval < 0 {
+		return fmt.Errorf("--reconcile-interval must not be negative")
+	}
+	if len(o.options.Chart) != 0 {
+		if len(o.options.Paths) != 0 {
+			return fmt.Errorf("--chart and --path can not be used together")
+		}
+		if _, err := os.Stat(o.options.Chart); err != nil {
+			return fmt.Errorf("chart %s doesn't exist", o.options.Chart)
+		}
+		return nil
+	}
+	reader, err := asset.NewDirectoriesReaderWithExtensions("", o.options.Paths, o.options.Extensions)
 	if err != nil {
 		return err
 	}
 
-	assetNames, err := reader.AssetNames(o.options.Paths, nil, o.options.Header)
+	assetNames, err := reader.AssetNames(o.options.Paths, o.options.ExcludedPartials(), "")
 	if err != nil {
 		return err
 	}
@@ -59,28 +52,45 @@ func (o *Options) Validate() error {
 }
 
 func (o *Options) Run() error {
-
-	restConfig, err := o.options.ApplierFlags.KubectlFactory.ToRESTConfig()
-	if err != nil {
-		return err
+	if o.watch {
+		return o.runWatch()
 	}
-	applyBuilder := apply.NewApplierBuilder().WithRestConfig(restConfig)
-	reader, err := asset.NewDirectoriesReader(o.options.Header, o.options.Paths)
+	output, err := o.apply()
 	if err != nil {
 		return err
 	}
-	o.options.Exclude = append(o.options.Exclude, o.options.Header)
-	files, err := reader.AssetNames(o.options.Paths, o.options.Exclude, o.options.Header)
+	return apply.WriteOutput(o.options.OutputFile, output)
+}
+
+//apply builds the applier and applies the chart or the templates of the paths
+func (o *Options) apply() ([]string, error) {
+	applyBuilder, err := o.options.NewApplierBuilder()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !o.options.SortOnKind {
 		applyBuilder = applyBuilder.WithKindOrder(apply.NoCreateUpdateKindsOrder)
 	}
-	applier := applyBuilder.Build()
-	output, err := applier.Apply(reader, o.options.Values, o.options.ApplierFlags.DryRun, o.options.Header, files...)
+	if o.cache != nil {
+		applyBuilder = applyBuilder.WithCache(o.cache)
+	}
+	if len(o.options.Chart) != 0 {
+		applier := applyBuilder.Build()
+		return applier.ApplyChart(o.options.Chart, o.options.Values, o.options.ApplierFlags.DryRun)
+	}
+	reader, err := asset.NewDirectoriesReaderWithExtensions("", o.options.Paths, o.options.Extensions)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return apply.WriteOutput(o.options.OutputFile, output)
+	// The exclusions are not modified as the files are listed again at each apply of the watch mode
+	applyBuilder, exclude, err := o.options.WithPartials(applyBuilder)
+	if err != nil {
+		return nil, err
+	}
+	files, err := reader.AssetNames(o.options.Paths, exclude, "")
+	if err != nil {
+		return nil, err
+	}
+	applier := applyBuilder.Build()
+	return applier.Apply(reader, o.options.Values, o.options.ApplierFlags.DryRun, "", files...)
 }
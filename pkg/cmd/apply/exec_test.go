@@ -131,6 +131,34 @@ func TestOptions_Validate(t *testing.T) {
 			name:    "empty failed",
 			wantErr: true,
 		},
+		{
+			name: "chart succees",
+			fields: fields{
+				options: common.Options{
+					Chart: "../../../test/unit/resources/chart/my-chart",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "chart not found",
+			fields: fields{
+				options: common.Options{
+					Chart: "wrong_chart",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "chart and paths failed",
+			fields: fields{
+				options: common.Options{
+					Chart: "../../../test/unit/resources/chart/my-chart",
+					Paths: []string{"../../../test/unit/resources/scenario/musttemplateasset"},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -2,6 +2,9 @@
 package apply
 
 import (
+	"time"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 	"github.com/stolostron/applier/pkg/cmd/apply/common"
 	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -11,6 +14,16 @@ type ResourceType string
 
 type Options struct {
 	options common.Options
+	// watch keeps running and applies the resources again when the files change
+	watch bool
+	// watchDebounce is the delay during which the changes are merged in a single apply
+	watchDebounce time.Duration
+	// reconcileInterval applies the resources periodically in watch mode, 0 disables it
+	reconcileInterval time.Duration
+	// reapplyOnDrift applies the resources again when a live object drifts in watch mode
+	reapplyOnDrift bool
+	// cache is shared by the applies of the watch mode
+	cache resourceapply.ResourceCache
 }
 
 func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
@@ -0,0 +1,512 @@
+// Copyright Red Hat
+package apply
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stolostron/applier/pkg/apply"
+	"github.com/stolostron/applier/pkg/asset"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+//runWatch applies the resources and applies them again when the files change, when a live object
+//drifts and at each reconcile interval until SIGINT or SIGTERM is received
+func (o *Options) runWatch() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// The current apply completes and a second signal kills the process
+		stop()
+	}()
+	// The cache avoids updating the unchanged resources at each apply
+	o.cache = apply.NewResourceCache()
+	fileWatcher, err := newFileWatcher(o.watchedPaths(), o.options.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer fileWatcher.close()
+	w := newWatcher(o.watchDebounce, o.reconcileInterval)
+	var driftWatcher *driftWatcher
+	if o.reapplyOnDrift {
+		dynamicClient, err := o.options.ApplierFlags.KubectlFactory.DynamicClient()
+		if err != nil {
+			return err
+		}
+		mapper, err := o.options.ApplierFlags.KubectlFactory.ToRESTMapper()
+		if err != nil {
+			return err
+		}
+		restConfig, err := o.options.ApplierFlags.KubectlFactory.ToRESTConfig()
+		if err != nil {
+			return err
+		}
+		namespace, _, err := o.options.ApplierFlags.KubectlFactory.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return err
+		}
+		driftWatcher = newDriftWatcher(ctx, dynamicClient, mapper, apply.FieldManager(restConfig), namespace, w.trigger)
+	}
+	w.reconcile = func(reasons []string) {
+		klog.Infof("applying the resources: %s", strings.Join(reasons, ", "))
+		// The changes done by the apply are not drifts
+		if driftWatcher != nil {
+			driftWatcher.pause()
+			defer driftWatcher.resume()
+		}
+		if err := o.options.Load(); err != nil {
+			klog.Errorf("failed to read the values and the patches: %v", err)
+			return
+		}
+		output, err := o.apply()
+		if err != nil {
+			klog.Errorf("failed to apply the resources: %v", err)
+			return
+		}
+		if err := apply.WriteOutput(o.options.OutputFile, output); err != nil {
+			klog.Errorf("failed to write the output: %v", err)
+		}
+		if driftWatcher != nil {
+			if err := driftWatcher.setObjects(output); err != nil {
+				klog.Errorf("failed to watch the resources: %v", err)
+			}
+		}
+	}
+	go fileWatcher.run(ctx, w.trigger)
+	w.run(ctx)
+	klog.Info("watch stopped")
+	return nil
+}
+
+//watchedPaths returns the files and directories read by an apply
+func (o *Options) watchedPaths() []string {
+	paths := make([]string, 0)
+	for _, p := range o.options.Paths {
+		paths = asset.AppendItNotExists(paths, asset.PathBase(p))
+	}
+	for _, p := range append([]string{o.options.Chart, o.options.ValuesPath}, o.options.Partials()...) {
+		paths = asset.AppendItNotExists(paths, p)
+	}
+	for _, p := range append(append([]string{}, o.options.PatchPaths...), o.options.PolicyPaths...) {
+		paths = asset.AppendItNotExists(paths, p)
+	}
+	return paths
+}
+
+//watcher calls reconcile at start, after the debounce delay when it is triggered and at each
+//interval. The triggers received during the debounce delay are merged in a single reconcile.
+type watcher struct {
+	debounce  time.Duration
+	interval  time.Duration
+	triggers  chan string
+	reconcile func(reasons []string)
+}
+
+func newWatcher(debounce, interval time.Duration) *watcher {
+	return &watcher{
+		debounce: debounce,
+		interval: interval,
+		triggers: make(chan string, 100),
+	}
+}
+
+//trigger requests a reconcile with a reason, it doesn't block and the reason
+//is dropped if too many are already pending as a reconcile is already requested
+func (w *watcher) trigger(reason string) {
+	select {
+	case w.triggers <- reason:
+	default:
+	}
+}
+
+//run reconciles until the context is done, a reconcile in progress always completes
+func (w *watcher) run(ctx context.Context) {
+	var ticks <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	w.reconcile([]string{"start"})
+	var timer *time.Timer
+	var debounced <-chan time.Time
+	reasons := make([]string, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case reason := <-w.triggers:
+			reasons = asset.AppendItNotExists(reasons, reason)
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			debounced = timer.C
+		case <-debounced:
+			timer, debounced = nil, nil
+			w.reconcile(reasons)
+			reasons = make([]string, 0)
+		case <-ticks:
+			w.reconcile([]string{"reconcile interval"})
+		}
+	}
+}
+
+//fileWatcher triggers a reconcile when a watched file or a file of a watched directory changes
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	//dirs are watched with their sub-directories
+	dirs  []string
+	files map[string]bool
+	//ignored are the files written by the applier, such as the output file
+	ignored map[string]bool
+}
+
+func newFileWatcher(paths []string, ignored ...string) (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWatcher{
+		watcher: watcher,
+		dirs:    make([]string, 0),
+		files:   make(map[string]bool),
+		ignored: make(map[string]bool),
+	}
+	for _, p := range ignored {
+		if len(p) != 0 {
+			w.ignored[filepath.Clean(p)] = true
+		}
+	}
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		fi, err := os.Stat(p)
+		if err != nil {
+			w.close()
+			return nil, err
+		}
+		if fi.IsDir() {
+			w.dirs = append(w.dirs, p)
+			err = w.addDir(p)
+		} else {
+			w.files[p] = true
+			// The directory of the file is watched as the editors often replace the files
+			err = w.watcher.Add(filepath.Dir(p))
+		}
+		if err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+//addDir watches the directory and its sub-directories, except the hidden ones such as .git
+func (w *fileWatcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+//changed returns true if the event is a change of a watched file
+func (w *fileWatcher) changed(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if w.ignored[name] {
+		return false
+	}
+	if w.files[name] {
+		return true
+	}
+	// The hidden and backup files of the editors are ignored
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") || strings.HasSuffix(base, "~") {
+		return false
+	}
+	for _, dir := range w.dirs {
+		if dir == "." || strings.HasPrefix(name, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+//run triggers a reconcile for each change until the context is done
+func (w *fileWatcher) run(ctx context.Context, trigger func(reason string)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.changed(event) {
+				continue
+			}
+			// The new sub-directories are watched too
+			if event.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					if err := w.addDir(event.Name); err != nil {
+						klog.Warningf("failed to watch %s: %v", event.Name, err)
+					}
+				}
+			}
+			trigger(fmt.Sprintf("%s changed", event.Name))
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Warningf("failed to watch the files: %v", err)
+		}
+	}
+}
+
+func (w *fileWatcher) close() {
+	if err := w.watcher.Close(); err != nil {
+		klog.Warningf("failed to stop watching the files: %v", err)
+	}
+}
+
+//driftWatcher triggers a reconcile when a live object of the applied resources drifts or is deleted,
+//the live objects are watched with an informer per resource and namespace.
+type driftWatcher struct {
+	ctx           context.Context
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	//fieldManager is the manager of the fields updated by the applier
+	fieldManager string
+	//namespace is the namespace of the applied objects without namespace
+	namespace string
+	trigger   func(reason string)
+	//informers are the informers per namespace and resource, metav1.NamespaceAll for the cluster scoped resources
+	informers map[string]*resourceInformer
+	mutex     sync.RWMutex
+	//objects are the applied objects by group, kind, namespace and name
+	objects map[string]*unstructured.Unstructured
+	//paused is true while the resources are applied, the changes done by the apply are ignored
+	paused bool
+}
+
+//resourceInformer is the informer of a resource in a namespace, it is stopped by cancel
+type resourceInformer struct {
+	factory dynamicinformer.DynamicSharedInformerFactory
+	cancel  context.CancelFunc
+}
+
+func newDriftWatcher(ctx context.Context,
+	dynamicClient dynamic.Interface,
+	mapper meta.RESTMapper,
+	fieldManager string,
+	namespace string,
+	trigger func(reason string)) *driftWatcher {
+	return &driftWatcher{
+		ctx:           ctx,
+		dynamicClient: dynamicClient,
+		mapper:        mapper,
+		fieldManager:  fieldManager,
+		namespace:     namespace,
+		trigger:       trigger,
+		informers:     make(map[string]*resourceInformer),
+		objects:       make(map[string]*unstructured.Unstructured),
+	}
+}
+
+//pause ignores the changes of the live objects until resume is called
+func (w *driftWatcher) pause() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.paused = true
+}
+
+//resume compares again the changes of the live objects with the applied objects
+func (w *driftWatcher) resume() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.paused = false
+}
+
+//setObjects replaces the watched objects by the applied ones, waits for the informers
+//of their resources to be synced and stops the informers of the resources no longer applied
+func (w *driftWatcher) setObjects(output []string) error {
+	objects := make(map[string]*unstructured.Unstructured)
+	informed := make(map[string]bool)
+	for _, document := range output {
+		u, err := toUnstructured(document)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			continue
+		}
+		mapping, err := w.restMapping(u.GroupVersionKind())
+		if err != nil {
+			return err
+		}
+		namespace := u.GetNamespace()
+		switch {
+		case mapping.Scope.Name() == meta.RESTScopeNameRoot:
+			namespace = metav1.NamespaceAll
+		case len(namespace) == 0:
+			// The object is applied in the namespace of the client
+			namespace = w.namespace
+			u.SetNamespace(namespace)
+		}
+		key := namespace + "/" + mapping.Resource.String()
+		w.inform(key, namespace, mapping.Resource)
+		informed[key] = true
+		objects[objectKey(u)] = u
+	}
+	for key, informer := range w.informers {
+		if !informed[key] {
+			informer.cancel()
+			delete(w.informers, key)
+		}
+	}
+	for _, informer := range w.informers {
+		informer.factory.WaitForCacheSync(w.ctx.Done())
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.objects = objects
+	return nil
+}
+
+//restMapping returns the mapping of the kind, the mapper is reset if the kind is
+//unknown as it can be a custom resource defined by the applied CRDs
+func (w *driftWatcher) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := w.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	if resettable, ok := w.mapper.(meta.ResettableRESTMapper); ok {
+		resettable.Reset()
+	}
+	return w.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+//inform starts the informer of the resource in the namespace if not already started
+func (w *driftWatcher) inform(key, namespace string, resource schema.GroupVersionResource) {
+	if _, ok := w.informers[key]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(w.dynamicClient, 0, namespace, nil)
+	// The add events of the initial list are ignored
+	factory.ForResource(resource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj interface{}) {
+			w.updated(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			w.deleted(obj)
+		},
+	})
+	factory.Start(ctx.Done())
+	w.informers[key] = &resourceInformer{factory: factory, cancel: cancel}
+}
+
+//updated triggers a reconcile if the object drifts, the updates of the status and of the fields
+//which are not applied, such as the ones done by the apply itself, don't trigger a reconcile.
+func (w *driftWatcher) updated(obj interface{}) {
+	existing, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	required := w.object(existing)
+	if required == nil {
+		return
+	}
+	drift, err := apply.DetectObjectDrift(objectKey(required), w.fieldManager, required, existing)
+	if err != nil {
+		klog.Warningf("failed to check the drift of %s: %v", objectKey(required), err)
+		return
+	}
+	if drift == nil {
+		return
+	}
+	for _, line := range drift.Strings() {
+		klog.Info(line)
+	}
+	w.trigger(fmt.Sprintf("%s %s drifted", existing.GetKind(), objectName(existing)))
+}
+
+//deleted triggers a reconcile if the object is applied
+func (w *driftWatcher) deleted(obj interface{}) {
+	existing, ok := obj.(*unstructured.Unstructured)
+	if !ok || w.object(existing) == nil {
+		return
+	}
+	w.trigger(fmt.Sprintf("%s %s deleted", existing.GetKind(), objectName(existing)))
+}
+
+//object returns the applied object of the live object, nil if it is not applied
+//or if the watcher is paused
+func (w *driftWatcher) object(existing *unstructured.Unstructured) *unstructured.Unstructured {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.paused {
+		return nil
+	}
+	return w.objects[objectKey(existing)]
+}
+
+//toUnstructured converts a rendered document, it returns nil for an empty document
+func toUnstructured(document string) (*unstructured.Unstructured, error) {
+	j, err := asset.ToJSON([]byte(document))
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{})
+	if err := utiljson.Unmarshal(j, &object); err != nil {
+		return nil, err
+	}
+	if len(object) == 0 {
+		return nil, nil
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+func objectKey(u *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s", u.GroupVersionKind().GroupKind().String(), objectName(u))
+}
+
+func objectName(u *unstructured.Unstructured) string {
+	if len(u.GetNamespace()) == 0 {
+		return u.GetName()
+	}
+	return u.GetNamespace() + "/" + u.GetName()
+}
@@ -0,0 +1,320 @@
+// Copyright Red Hat
+package apply
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestWatcher_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reconciled := make(chan []string, 10)
+	w := newWatcher(50*time.Millisecond, 0)
+	w.reconcile = func(reasons []string) {
+		reconciled <- reasons
+	}
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(done)
+	}()
+	if reasons := <-reconciled; !reflect.DeepEqual(reasons, []string{"start"}) {
+		t.Errorf("Expected the start reconcile got %v", reasons)
+	}
+	w.trigger("values.yaml changed")
+	w.trigger("templates/cm.yaml changed")
+	w.trigger("values.yaml changed")
+	select {
+	case reasons := <-reconciled:
+		want := []string{"values.yaml changed", "templates/cm.yaml changed"}
+		if !reflect.DeepEqual(reasons, want) {
+			t.Errorf("Expected the reasons %v got %v", want, reasons)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reconcile after the debounce delay")
+	}
+	select {
+	case reasons := <-reconciled:
+		t.Errorf("Expected a single reconcile got %v", reasons)
+	case <-time.After(200 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watcher to stop")
+	}
+}
+
+func TestWatcher_RunInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reconciled := make(chan []string, 10)
+	w := newWatcher(time.Second, 20*time.Millisecond)
+	w.reconcile = func(reasons []string) {
+		reconciled <- reasons
+	}
+	go w.run(ctx)
+	<-reconciled
+	select {
+	case reasons := <-reconciled:
+		if !reflect.DeepEqual(reasons, []string{"reconcile interval"}) {
+			t.Errorf("Expected the interval reconcile got %v", reasons)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reconcile at the interval")
+	}
+}
+
+func TestFileWatcher_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templates := filepath.Join(dir, "templates")
+	values := filepath.Join(dir, "values.yaml")
+	output := filepath.Join(templates, "output.yaml")
+	for name, content := range map[string]string{
+		filepath.Join(templates, "cm.yaml"): "kind: ConfigMap",
+		values:                              "key: value",
+		filepath.Join(dir, "other.yaml"):    "key: value",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := newFileWatcher([]string{templates, values}, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	triggers := make(chan string, 100)
+	go w.run(ctx, func(reason string) {
+		triggers <- reason
+	})
+	tests := []struct {
+		name    string
+		change  func() error
+		trigger string
+	}{
+		{
+			name: "ignored files",
+			change: func() error {
+				for _, name := range []string{filepath.Join(dir, "other.yaml"), output, filepath.Join(templates, ".cm.yaml.swp")} {
+					if err := ioutil.WriteFile(name, []byte("key: changed"), 0600); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "template",
+			change: func() error {
+				return ioutil.WriteFile(filepath.Join(templates, "cm.yaml"), []byte("kind: Secret"), 0600)
+			},
+			trigger: filepath.Join(templates, "cm.yaml"),
+		},
+		{
+			name: "values",
+			change: func() error {
+				return ioutil.WriteFile(values, []byte("key: changed"), 0600)
+			},
+			trigger: values,
+		},
+		{
+			name: "new directory",
+			change: func() error {
+				return os.Mkdir(filepath.Join(templates, "nested"), 0700)
+			},
+			trigger: filepath.Join(templates, "nested"),
+		},
+		{
+			name: "file of a new directory",
+			change: func() error {
+				// The new directory is watched asynchronously
+				time.Sleep(100 * time.Millisecond)
+				return ioutil.WriteFile(filepath.Join(templates, "nested", "deployment.yaml"), []byte("kind: Deployment"), 0600)
+			},
+			trigger: filepath.Join(templates, "nested", "deployment.yaml"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.trigger) == 0 {
+				select {
+				case reason := <-triggers:
+					t.Errorf("Expected no trigger got %s", reason)
+				case <-time.After(200 * time.Millisecond):
+				}
+				return
+			}
+			for {
+				select {
+				case reason := <-triggers:
+					if strings.HasPrefix(reason, tt.trigger+" ") {
+						// The other events of the change are dropped
+						time.Sleep(100 * time.Millisecond)
+						for len(triggers) != 0 {
+							<-triggers
+						}
+						return
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Expected a trigger for %s", tt.trigger)
+				}
+			}
+		})
+	}
+}
+
+func TestOptions_WatchedPaths(t *testing.T) {
+	o := &Options{
+		options: common.Options{
+			Paths:       []string{"templates/**/*.yaml", "templates", "crds/crd.yaml"},
+			ValuesPath:  "values.yaml",
+			Headers:     []string{"header.txt"},
+			PartialsDir: "partials",
+			PatchPaths:  []string{"patch.yaml"},
+			PolicyPaths: []string{"policy.yaml"},
+		},
+	}
+	want := []string{"templates", "crds/crd.yaml", "values.yaml", "header.txt", "partials", "patch.yaml", "policy.yaml"}
+	if got := o.watchedPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v got %v", want, got)
+	}
+}
+
+func TestDriftWatcher(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "my-cm",
+			"namespace": "my-ns",
+		},
+		"data": map[string]interface{}{"log": "debug"},
+	}}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ConfigMapList"}, configMap.DeepCopy())
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	triggers := make(chan string, 100)
+	// The object without namespace is applied in the namespace of the client
+	w := newDriftWatcher(ctx, dynamicClient, mapper, "applier", "my-ns", func(reason string) {
+		triggers <- reason
+	})
+	if err := w.setObjects([]string{`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-cm
+data:
+  log: debug
+`, ""}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		change  func(u *unstructured.Unstructured) error
+		paused  bool
+		trigger string
+	}{
+		{
+			name: "not applied field",
+			change: func(u *unstructured.Unstructured) error {
+				u.SetLabels(map[string]string{"team": "my-team"})
+				_, err := dynamicClient.Resource(gvr).Namespace("my-ns").Update(ctx, u, metav1.UpdateOptions{})
+				return err
+			},
+		},
+		{
+			name: "drifted",
+			change: func(u *unstructured.Unstructured) error {
+				u.Object["data"] = map[string]interface{}{"log": "info"}
+				_, err := dynamicClient.Resource(gvr).Namespace("my-ns").Update(ctx, u, metav1.UpdateOptions{})
+				return err
+			},
+			trigger: "ConfigMap my-ns/my-cm drifted",
+		},
+		{
+			name: "paused",
+			change: func(u *unstructured.Unstructured) error {
+				u.Object["data"] = map[string]interface{}{"log": "warn"}
+				_, err := dynamicClient.Resource(gvr).Namespace("my-ns").Update(ctx, u, metav1.UpdateOptions{})
+				return err
+			},
+			paused: true,
+		},
+		{
+			name: "deleted",
+			change: func(u *unstructured.Unstructured) error {
+				return dynamicClient.Resource(gvr).Namespace("my-ns").Delete(ctx, u.GetName(), metav1.DeleteOptions{})
+			},
+			trigger: "ConfigMap my-ns/my-cm deleted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := dynamicClient.Resource(gvr).Namespace("my-ns").Get(ctx, "my-cm", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.paused {
+				w.pause()
+				defer w.resume()
+			}
+			if err := tt.change(u); err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.trigger) == 0 {
+				select {
+				case reason := <-triggers:
+					t.Errorf("Expected no trigger got %s", reason)
+				case <-time.After(200 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case reason := <-triggers:
+				if reason != tt.trigger {
+					t.Errorf("Expected the trigger %s got %s", tt.trigger, reason)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected the trigger %s", tt.trigger)
+			}
+		})
+	}
+	// The informers of the resources no longer applied are stopped
+	if err := w.setObjects(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.informers) != 0 {
+		t.Errorf("Expected the informers to be stopped got %v", w.informers)
+	}
+}
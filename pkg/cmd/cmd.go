@@ -9,7 +9,10 @@ import (
 	"k8s.io/kubectl/pkg/util/templates"
 
 	"github.com/stolostron/applier/pkg/cmd/apply"
+	"github.com/stolostron/applier/pkg/cmd/drift"
+	"github.com/stolostron/applier/pkg/cmd/lint"
 	"github.com/stolostron/applier/pkg/cmd/render"
+	"github.com/stolostron/applier/pkg/cmd/validate"
 	"github.com/stolostron/applier/pkg/cmd/version"
 )
 
@@ -22,6 +25,9 @@ func NewApplierCommand() *cobra.Command {
 				version.NewCmd(applierFlags, streams),
 				apply.NewCmd(applierFlags, streams),
 				render.NewCmd(applierFlags, streams),
+				validate.NewCmd(applierFlags, streams),
+				lint.NewCmd(applierFlags, streams),
+				drift.NewCmd(applierFlags, streams),
 			},
 		},
 	}
@@ -0,0 +1,67 @@
+// Copyright Red Hat
+package drift
+
+import (
+	"fmt"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"github.com/stolostron/applier/pkg/helpers"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var example = `
+# report the live resources which are not the rendered ones
+%[1]s drift --values values.yaml --path template_path1 --path tempalte_path2...
+
+# report the drifts as JSON and re-apply the resources if a drift is detected
+%[1]s drift --values values.yaml --path template_path1 --output json --reapply
+`
+
+// NewCmd ...
+func NewCmd(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewOptions(applierFlags, streams)
+
+	cmd := &cobra.Command{
+		Use:          "drift",
+		Short:        "report the changes of the live resources made outside the applier",
+		Long:         "render the templates located in paths with a values.yaml and compare the rendered resources with the live resources, only the fields of the rendered resources are compared and the drifted fields are reported with the managers owning them, the command fails if a drift is detected unless the resources are re-applied",
+		Example:      fmt.Sprintf(example, helpers.GetExampleHeader()),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.RenderOptions.ValuesPath, "values", "", "The files containing the values")
+	common.AddAgeKeyFileFlag(cmd.Flags(), &o.RenderOptions.AgeKeyFile)
+	cmd.Flags().BoolVar(&o.Reapply, "reapply", false, "If set the resources are re-applied when a drift is detected")
+	cmd.Flags().StringVar(&o.Output, "output", "text", "The format of the drifts, text or json")
+	cmd.Flags().StringVar(&o.RenderOptions.PostRenderer, "post-renderer", "", "The path to an executable receiving the rendered resources as YAML on stdin and writing the resources to use on stdout, like the helm post-renderers")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PostRendererArgs, "post-renderer-args", []string{}, "An argument passed to the post-renderer, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PatchPaths, "patch", []string{}, "A file containing strategic merge patches or kustomize like patch entries with a target, applied to the rendered resources, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Images, "image", []string{}, "An image override formatted as old=new[@digest], applied to the containers and init containers of the rendered workloads, an old image without tag matches all its tags, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Headers, "header", []string{}, "A file added at the beginning of each template, can be repeated")
+	cmd.Flags().StringVar(&o.RenderOptions.PartialsDir, "partials-dir", "", "The directory containing the partials shared by all templates, like the helm _helpers.tpl")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Paths, "path", []string{}, "The list of template paths, a path can be a glob pattern (ie: templates/**/*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Exclude, "exclude", []string{}, "The list of paths to exclude, a path can be a glob pattern (ie: templates/**/test-*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringSliceVar(&o.RenderOptions.Extensions, "extensions", asset.DefaultExtensions, "The extensions of the files to select in the directories, the files explicitly listed in --path are always selected")
+	cmd.Flags().StringVar(&o.OutputFile, "output-file", "", "The drifts will be copied in the specified file")
+	cmd.Flags().BoolVar(&o.RenderOptions.TemplateContext, "template-context", false, "If set the values are wrapped in a template context exposing .Values, .Release, .Capabilities, .Template and .Files")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseName, "release-name", "", "The name exposed as .Release.Name in the template context")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseNamespace, "release-namespace", "default", "The namespace exposed as .Release.Namespace in the template context")
+	return cmd
+}
@@ -0,0 +1,86 @@
+// Copyright Red Hat
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stolostron/applier/pkg/apply"
+)
+
+func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
+	if err := o.RenderOptions.Complete(cmd, args); err != nil {
+		return err
+	}
+	if len(o.Output) == 0 {
+		o.Output = "text"
+	}
+	if len(o.OutputFile) == 0 {
+		o.OutputFile = os.Stdout.Name()
+	}
+	return nil
+}
+
+func (o *Options) Validate() error {
+	if o.Output != "text" && o.Output != "json" {
+		return fmt.Errorf("unsupported output %q, the output must be text or json", o.Output)
+	}
+	return o.RenderOptions.Validate()
+}
+
+func (o *Options) Run() error {
+	applier, reader, files, err := o.RenderOptions.NewApplier()
+	if err != nil {
+		return err
+	}
+	restConfig, err := o.RenderOptions.ApplierFlags.KubectlFactory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	applier = applier.WithRestConfig(restConfig)
+	drifts, err := applier.DetectDrift(reader, o.RenderOptions.Values, "", files...)
+	if err != nil {
+		return err
+	}
+	if err := writeDrifts(o.OutputFile, o.Output, drifts); err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		return nil
+	}
+	if !o.Reapply {
+		return fmt.Errorf("%d drifted resources found", len(drifts))
+	}
+	_, err = applier.Apply(reader, o.RenderOptions.Values, false, "", files...)
+	return err
+}
+
+//writeDrifts writes the drifted fields one per line or the drifts as a JSON array
+func writeDrifts(fileName string, output string, drifts apply.Drifts) error {
+	var b []byte
+	if output == "json" {
+		j, err := json.MarshalIndent(drifts, "", "  ")
+		if err != nil {
+			return err
+		}
+		b = append(j, '\n')
+	} else {
+		var sb strings.Builder
+		for _, drift := range drifts {
+			for _, line := range drift.Strings() {
+				sb.WriteString(line + "\n")
+			}
+		}
+		b = []byte(sb.String())
+	}
+	if fileName == os.Stdout.Name() {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(filepath.Clean(fileName), b, 0600)
+}
@@ -0,0 +1,120 @@
+// Copyright Red Hat
+package drift
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/apply"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	"github.com/stolostron/applier/pkg/cmd/render"
+)
+
+func TestWriteDrifts(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "drifts.txt")
+	drifts := apply.Drifts{
+		{
+			Document:   "configmap.yaml",
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Namespace:  "my-ns",
+			Name:       "my-cm",
+			Fields: []apply.DriftedField{
+				{Path: "data.log", Expected: "debug", Actual: "info", Managers: []string{"kubectl-edit"}},
+				{Path: "data.level", Expected: "1"},
+			},
+		},
+		{
+			Document:   "namespace.yaml",
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       "my-ns",
+			Missing:    true,
+		},
+	}
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "text",
+			output: "text",
+			want: `configmap.yaml: ConfigMap my-ns/my-cm: data.log: expected debug, got info (managed by kubectl-edit)
+configmap.yaml: ConfigMap my-ns/my-cm: data.level: expected 1, got <none>
+namespace.yaml: Namespace my-ns: the object does not exist
+`,
+		},
+		{
+			name:   "json",
+			output: "json",
+			want: `[
+  {
+    "document": "configmap.yaml",
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "namespace": "my-ns",
+    "name": "my-cm",
+    "fields": [
+      {
+        "path": "data.log",
+        "expected": "debug",
+        "actual": "info",
+        "managers": [
+          "kubectl-edit"
+        ]
+      },
+      {
+        "path": "data.level",
+        "expected": "1",
+        "actual": null
+      }
+    ]
+  },
+  {
+    "document": "namespace.yaml",
+    "apiVersion": "v1",
+    "kind": "Namespace",
+    "name": "my-ns",
+    "missing": true
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := writeDrifts(outputFile, tt.output, drifts); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Expected %s got %s", tt.want, string(b))
+			}
+		})
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	o := &Options{
+		RenderOptions: &render.Options{
+			Options: common.Options{
+				Paths:      []string{"../../../test/unit/resources/lint/clean"},
+				Extensions: asset.DefaultExtensions,
+			},
+		},
+		Output: "yaml",
+	}
+	if err := o.Validate(); err == nil {
+		t.Error("the yaml output must be rejected")
+	}
+	o.Output = "json"
+	if err := o.Validate(); err != nil {
+		t.Error(err)
+	}
+}
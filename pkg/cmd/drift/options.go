@@ -0,0 +1,28 @@
+// Copyright Red Hat
+package drift
+
+import (
+	"github.com/stolostron/applier/pkg/cmd/render"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+type Options struct {
+	//RenderOptions are the options rendering the resources compared with the live resources
+	RenderOptions *render.Options
+	//Reapply applies the resources if a drift is detected
+	Reapply bool
+	//The output format, text or json
+	Output string
+	//The file where the drifts are written
+	OutputFile string
+}
+
+func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
+	renderOptions := render.NewOptions(applierFlags, streams)
+	// The resources are re-applied in the kinds order
+	renderOptions.SortOnKind = true
+	return &Options{
+		RenderOptions: renderOptions,
+	}
+}
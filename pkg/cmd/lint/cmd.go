@@ -0,0 +1,72 @@
+// Copyright Red Hat
+package lint
+
+import (
+	"fmt"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"github.com/stolostron/applier/pkg/helpers"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var example = `
+# lint the rendered templates
+%[1]s lint --values values.yaml --path template_path1 --path tempalte_path2...
+
+# lint with a configuration requiring labels and report the issues as JSON
+%[1]s lint --values values.yaml --path template_path1 --config lint.yaml --output json
+`
+
+// NewCmd ...
+func NewCmd(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewOptions(applierFlags, streams)
+
+	cmd := &cobra.Command{
+		Use:          "lint",
+		Short:        "lint the rendered templates",
+		Long:         "lint the templates located in paths rendered with a values.yaml, the duplicated resources, the namespaced resources without namespace, the cluster scoped resources with a namespace, the missing required labels, the unknown kinds, the empty files and the deprecated apiVersions are reported, the command fails if an error is reported",
+		Example:      fmt.Sprintf(example, helpers.GetExampleHeader()),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.RenderOptions.ValuesPath, "values", "", "The files containing the values")
+	common.AddAgeKeyFileFlag(cmd.Flags(), &o.RenderOptions.AgeKeyFile)
+	cmd.Flags().StringVar(&o.ConfigPath, "config", "", "The file containing the lint configuration: the requiredLabels, the knownKinds, the clusterScopedKinds and the disabledRules")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PolicyPaths, "policy", []string{}, "A file containing CEL policy rules checked against the rendered resources, the resource is the object variable and complies with a rule if its expression is true, can be repeated")
+	cmd.Flags().BoolVar(&o.RenderOptions.BuiltinPolicies, "builtin-policies", false, "If set the rendered resources are checked against the built-in policy rules: no-privileged, no-host-path and no-latest-image")
+	cmd.Flags().StringVar(&o.RenderOptions.PolicyMode, "policy-mode", "enforce", "The policy mode, the violations are reported as errors in enforce mode and as warnings in warn mode")
+	cmd.Flags().StringVar(&o.Output, "output", "text", "The format of the issues, text or json")
+	cmd.Flags().StringVar(&o.RenderOptions.PostRenderer, "post-renderer", "", "The path to an executable receiving the rendered resources as YAML on stdin and writing the resources to use on stdout, like the helm post-renderers")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PostRendererArgs, "post-renderer-args", []string{}, "An argument passed to the post-renderer, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PatchPaths, "patch", []string{}, "A file containing strategic merge patches or kustomize like patch entries with a target, applied to the rendered resources, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Images, "image", []string{}, "An image override formatted as old=new[@digest], applied to the containers and init containers of the rendered workloads, an old image without tag matches all its tags, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Headers, "header", []string{}, "A file added at the beginning of each template, can be repeated")
+	cmd.Flags().StringVar(&o.RenderOptions.PartialsDir, "partials-dir", "", "The directory containing the partials shared by all templates, like the helm _helpers.tpl")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Paths, "path", []string{}, "The list of template paths, a path can be a glob pattern (ie: templates/**/*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Exclude, "exclude", []string{}, "The list of paths to exclude, a path can be a glob pattern (ie: templates/**/test-*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringSliceVar(&o.RenderOptions.Extensions, "extensions", asset.DefaultExtensions, "The extensions of the files to select in the directories, the files explicitly listed in --path are always selected")
+	cmd.Flags().StringVar(&o.OutputFile, "output-file", "", "The lint issues will be copied in the specified file")
+	cmd.Flags().BoolVar(&o.RenderOptions.TemplateContext, "template-context", false, "If set the values are wrapped in a template context exposing .Values, .Release, .Capabilities, .Template and .Files")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseName, "release-name", "", "The name exposed as .Release.Name in the template context")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseNamespace, "release-namespace", "default", "The namespace exposed as .Release.Namespace in the template context")
+	cmd.Flags().StringVar(&o.RenderOptions.KubeVersion, "kube-version", "", "The Kubernetes version exposed as .Capabilities.KubeVersion in the template context, the client-go version by default")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.APIVersions, "api-versions", []string{}, "The apiVersions added to the built-in ones in .Capabilities.APIVersions, can be repeated")
+	return cmd
+}
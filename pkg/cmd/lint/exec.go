@@ -0,0 +1,86 @@
+// Copyright Red Hat
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stolostron/applier/pkg/apply"
+)
+
+func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
+	if err := o.RenderOptions.Complete(cmd, args); err != nil {
+		return err
+	}
+	if len(o.ConfigPath) != 0 {
+		b, err := ioutil.ReadFile(filepath.Clean(o.ConfigPath))
+		if err != nil {
+			return err
+		}
+		config, err := apply.ParseLintConfig(b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.ConfigPath, err)
+		}
+		o.Config = *config
+	}
+	if len(o.Output) == 0 {
+		o.Output = "text"
+	}
+	if len(o.OutputFile) == 0 {
+		o.OutputFile = os.Stdout.Name()
+	}
+	return nil
+}
+
+func (o *Options) Validate() error {
+	if o.Output != "text" && o.Output != "json" {
+		return fmt.Errorf("unsupported output %q, the output must be text or json", o.Output)
+	}
+	return o.RenderOptions.Validate()
+}
+
+func (o *Options) Run() error {
+	applier, reader, files, err := o.RenderOptions.NewApplier()
+	if err != nil {
+		return err
+	}
+	issues, err := applier.Lint(reader, o.RenderOptions.Values, "", o.Config, files...)
+	if err != nil {
+		return err
+	}
+	if err := writeIssues(o.OutputFile, o.Output, issues); err != nil {
+		return err
+	}
+	if issues.HasErrors() {
+		return fmt.Errorf("lint errors found")
+	}
+	return nil
+}
+
+//writeIssues writes the issues one per line or as a JSON array
+func writeIssues(fileName string, output string, issues apply.LintIssues) error {
+	var b []byte
+	if output == "json" {
+		j, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return err
+		}
+		b = append(j, '\n')
+	} else {
+		var sb strings.Builder
+		for _, issue := range issues {
+			sb.WriteString(issue.String() + "\n")
+		}
+		b = []byte(sb.String())
+	}
+	if fileName == os.Stdout.Name() {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(filepath.Clean(fileName), b, 0600)
+}
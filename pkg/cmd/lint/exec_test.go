@@ -0,0 +1,120 @@
+// Copyright Red Hat
+package lint
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/apply"
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	"github.com/stolostron/applier/pkg/cmd/render"
+)
+
+func TestOptions_Run(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "issues.txt")
+	tests := []struct {
+		name    string
+		paths   []string
+		config  apply.LintConfig
+		policy  []string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "clean",
+			paths:  []string{"../../../test/unit/resources/lint/clean"},
+			config: apply.LintConfig{RequiredLabels: []string{"app"}},
+			output: "text",
+			want:   "",
+		},
+		{
+			name:   "issues",
+			paths:  []string{"../../../test/unit/resources/lint/issues"},
+			config: apply.LintConfig{RequiredLabels: []string{"app"}},
+			output: "text",
+			want: `warning: ../../../test/unit/resources/lint/issues/configmap.yaml: ConfigMap my-name: the object is namespaced and has no namespace (missing-namespace)
+error: ../../../test/unit/resources/lint/issues/namespace.yaml: Namespace default/my-ns: the object is cluster scoped and has a namespace (cluster-scoped-namespace)
+error: ../../../test/unit/resources/lint/issues/namespace.yaml: Namespace default/my-ns: the label app is missing (required-label)
+`,
+			wantErr: true,
+		},
+		{
+			name:   "issues json",
+			paths:  []string{"../../../test/unit/resources/lint/issues/configmap.yaml"},
+			output: "json",
+			want: `[
+  {
+    "rule": "missing-namespace",
+    "severity": "warning",
+    "document": "../../../test/unit/resources/lint/issues/configmap.yaml",
+    "file": "../../../test/unit/resources/lint/issues/configmap.yaml",
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "name": "my-name",
+    "message": "the object is namespaced and has no namespace"
+  }
+]
+`,
+		},
+		{
+			name:   "policy",
+			paths:  []string{"../../../test/unit/resources/policy/deployment.yaml"},
+			policy: []string{"../../../test/unit/resources/policy/rules.yaml"},
+			output: "text",
+			want: `error: ../../../test/unit/resources/policy/deployment.yaml: Deployment my-ns/my-deployment: max-replicas: the deployments must not have more than 3 replicas (policy)
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				RenderOptions: &render.Options{
+					Options: common.Options{
+						Paths:       tt.paths,
+						Values:      map[string]interface{}{"Name": "my-name"},
+						Extensions:  asset.DefaultExtensions,
+						SortOnKind:  true,
+						PolicyPaths: tt.policy,
+					},
+				},
+				Config:     tt.config,
+				Output:     tt.output,
+				OutputFile: outputFile,
+			}
+			if err := o.Run(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			b, err := ioutil.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Expected %s got %s", tt.want, string(b))
+			}
+		})
+	}
+}
+
+func TestOptions_Complete(t *testing.T) {
+	o := &Options{
+		RenderOptions: &render.Options{
+			Options: common.Options{
+				ValuesPath: "../../../test/unit/resources/lint/values.yaml",
+			},
+		},
+		ConfigPath: "../../../test/unit/resources/lint/config.yaml",
+	}
+	if err := o.Complete(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Config.RequiredLabels) != 1 || o.Config.RequiredLabels[0] != "app" {
+		t.Errorf("Expected the required label app got %v", o.Config.RequiredLabels)
+	}
+	if o.Output != "text" {
+		t.Errorf("Expected the text output got %s", o.Output)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright Red Hat
+package lint
+
+import (
+	"github.com/stolostron/applier/pkg/apply"
+	"github.com/stolostron/applier/pkg/cmd/render"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+type Options struct {
+	//RenderOptions are the options rendering the linted resources
+	RenderOptions *render.Options
+	//The file containing the lint configuration
+	ConfigPath string
+	//The lint configuration read from the ConfigPath
+	Config apply.LintConfig
+	//The output format, text or json
+	Output string
+	//The file where the lint issues are written
+	OutputFile string
+}
+
+func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
+	renderOptions := render.NewOptions(applierFlags, streams)
+	// The kinds order is used to report the unknown kinds
+	renderOptions.SortOnKind = true
+	return &Options{
+		RenderOptions: renderOptions,
+	}
+}
@@ -2,44 +2,23 @@
 package render
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"github.com/stolostron/applier/pkg/apply"
 	"github.com/stolostron/applier/pkg/asset"
 )
 
 func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
-	// Convert yaml to map[string]interface
-	b := []byte("")
-	switch {
-	case len(o.ValuesPath) == 0:
-		// check if pipe
-		fi, err := os.Stdin.Stat()
-		if err != nil {
-			return err
-		}
-		if fi.Mode()&os.ModeCharDevice == 0 {
-			b, err = ioutil.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
-		}
-	case len(o.ValuesPath) != 0:
-		b, err = ioutil.ReadFile(o.ValuesPath)
-		if err != nil {
-			return err
-		}
-	}
-	o.Values = make(map[string]interface{})
-	if err := yaml.Unmarshal(b, &o.Values); err != nil {
+	if err := o.Options.Complete(cmd, args); err != nil {
 		return err
 	}
-
 	if len(o.OutputFile) == 0 {
 		o.OutputFile = os.Stdout.Name()
 	}
@@ -47,51 +26,68 @@ func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
 }
 
 func (o *Options) Validate() error {
-	reader, err := asset.NewDirectoriesReader(o.Header, o.Paths)
-	if err != nil {
-		return err
-	}
-
-	assetNames, err := reader.AssetNames(o.Paths, nil, o.Header)
-	if err != nil {
-		return err
-	}
-
-	if len(assetNames) == 0 {
-		return fmt.Errorf("no files selected")
+	if o.ListImages && len(o.OutputDir) != 0 {
+		return fmt.Errorf("--list-images and --output-dir can not be used together")
 	}
-	return nil
+	return o.Options.Validate()
 }
 
 func (o *Options) Run() error {
-	applyBuilder := apply.NewApplierBuilder()
-	if !o.SortOnKind {
-		applyBuilder = applyBuilder.WithKindOrder(apply.NoCreateUpdateKindsOrder)
-	}
-	applier := applyBuilder.Build()
-
-	reader, err := asset.NewDirectoriesReader(o.Header, o.Paths)
+	applier, reader, files, err := o.NewApplier()
 	if err != nil {
 		return err
 	}
-	// Get files names
-	files, err := reader.AssetNames(o.Paths, o.Exclude, o.Header)
-	if err != nil {
-		return err
+	if o.Validation {
+		validator, err := apply.LoadValidator(o.SchemaDir, o.ApplierFlags)
+		if err != nil {
+			return err
+		}
+		// The files of the output directory are rendered one by one
+		// and so the CRDs and their resources are validated beforehand
+		if len(o.OutputDir) != 0 {
+			validationErrors, err := applier.WithValidator(validator).Validate(reader, o.Values, "", files...)
+			if err != nil {
+				return err
+			}
+			if len(validationErrors) != 0 {
+				return validationErrors
+			}
+		} else {
+			applier = applier.WithValidator(validator)
+		}
 	}
 
 	if len(o.OutputDir) == 0 {
-		output, err := applier.MustTemplateAssets(reader, o.Values, o.Header, files...)
+		output, err := applier.MustTemplateAssets(reader, o.Values, "", files...)
 		if err != nil {
 			return err
 		}
+		if o.ListImages {
+			images, err := apply.ListImages(output)
+			if err != nil {
+				return err
+			}
+			return writeImages(o.OutputFile, images)
+		}
 		return apply.WriteOutput(o.OutputFile, output)
 	} else {
+		// The partials are not rendered but loaded with each template
+		partials := make([]string, 0)
+		for _, name := range files {
+			if asset.IsPartial(name) {
+				partials = append(partials, name)
+			}
+		}
 		for _, name := range files {
-			if name == o.Header {
+			// The files of a kustomization directory are written with the objects built from their kustomization file
+			if asset.IsPartial(name) || asset.InKustomization(name, files) {
 				continue
 			}
-			output, err := applier.MustTemplateAsset(reader, o.Values, o.Header, name)
+			rendered, err := applier.MustTemplateAssets(reader, o.Values, "", append([]string{name}, partials...)...)
+			if err != nil {
+				return err
+			}
+			output, err := formatOutput(name, rendered)
 			if err != nil {
 				return err
 			}
@@ -108,3 +104,68 @@ func (o *Options) Run() error {
 		return nil
 	}
 }
+
+//NewApplier returns the applier configured by the options, the reader of the paths
+//and the selected files
+func (o *Options) NewApplier() (apply.Applier, asset.ScenarioReader, []string, error) {
+	applyBuilder, err := o.NewRenderApplierBuilder()
+	if err != nil {
+		return apply.Applier{}, nil, nil, err
+	}
+	if !o.SortOnKind {
+		applyBuilder = applyBuilder.WithKindOrder(apply.NoCreateUpdateKindsOrder)
+	}
+	reader, err := asset.NewDirectoriesReaderWithExtensions("", o.Paths, o.Extensions)
+	if err != nil {
+		return apply.Applier{}, nil, nil, err
+	}
+	applyBuilder, exclude, err := o.WithPartials(applyBuilder)
+	if err != nil {
+		return apply.Applier{}, nil, nil, err
+	}
+	applier := applyBuilder.Build()
+
+	// Get files names
+	files, err := reader.AssetNames(o.Paths, exclude, "")
+	if err != nil {
+		return apply.Applier{}, nil, nil, err
+	}
+	return applier, reader, files, nil
+}
+
+//formatOutput joins the rendered documents of a file preserving its format,
+//the documents of a JSON file are written as a JSON object or as a JSON array.
+func formatOutput(name string, rendered []string) ([]byte, error) {
+	if filepath.Ext(name) != ".json" {
+		return []byte(strings.Join(rendered, "\n---\n")), nil
+	}
+	documents := make([]json.RawMessage, len(rendered))
+	for i, r := range rendered {
+		j, err := asset.ToJSON([]byte(r))
+		if err != nil {
+			return nil, err
+		}
+		documents[i] = j
+	}
+	if len(documents) == 1 {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, documents[0], "", "  "); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return json.MarshalIndent(documents, "", "  ")
+}
+
+//writeImages writes the images one per line
+func writeImages(fileName string, images []string) error {
+	var b strings.Builder
+	for _, image := range images {
+		b.WriteString(image + "\n")
+	}
+	if fileName == os.Stdout.Name() {
+		_, err := os.Stdout.WriteString(b.String())
+		return err
+	}
+	return ioutil.WriteFile(filepath.Clean(fileName), []byte(b.String()), 0600)
+}
@@ -4,9 +4,12 @@ package render
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
 )
 
 func TestOptions_Complete(t *testing.T) {
@@ -19,6 +22,9 @@ func TestOptions_Complete(t *testing.T) {
 		SortOnKind bool
 		OutputDir  string
 		Excluded   []string
+		AgeKeyFile string
+		PatchPaths []string
+		Images     []string
 	}
 	type args struct {
 		cmd  *cobra.Command
@@ -48,18 +54,63 @@ func TestOptions_Complete(t *testing.T) {
 			name:    "read value stdin",
 			wantErr: false,
 		},
+		{
+			name: "read sops encrypted value file",
+			fields: fields{
+				ValuesPath: "../../../test/unit/resources/sops/values.enc.yaml",
+				AgeKeyFile: "../../../test/unit/resources/sops/keys.txt",
+			},
+			wantErr: false,
+		},
+		{
+			name: "read sops encrypted value file key not found",
+			fields: fields{
+				ValuesPath: "../../../test/unit/resources/sops/values.enc.yaml",
+				AgeKeyFile: "file_not_found.txt",
+			},
+			wantErr: true,
+		},
+		{
+			name: "read patch file",
+			fields: fields{
+				ValuesPath: "../../../test/unit/resources/scenario/values.yaml",
+				PatchPaths: []string{"../../../test/unit/resources/patches/patches.yaml"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "read patch file not found",
+			fields: fields{
+				ValuesPath: "../../../test/unit/resources/scenario/values.yaml",
+				PatchPaths: []string{"file_not_found.yaml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid image override",
+			fields: fields{
+				ValuesPath: "../../../test/unit/resources/scenario/values.yaml",
+				Images:     []string{"nginx="},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &Options{
-				Header:     tt.fields.Header,
-				Paths:      tt.fields.Paths,
-				ValuesPath: tt.fields.ValuesPath,
-				Values:     tt.fields.Values,
-				OutputFile: tt.fields.OutputFile,
-				SortOnKind: tt.fields.SortOnKind,
-				OutputDir:  tt.fields.OutputDir,
-				Exclude:    tt.fields.Excluded,
+				Options: common.Options{
+					Header:     tt.fields.Header,
+					Paths:      tt.fields.Paths,
+					ValuesPath: tt.fields.ValuesPath,
+					Values:     tt.fields.Values,
+					OutputFile: tt.fields.OutputFile,
+					SortOnKind: tt.fields.SortOnKind,
+					Exclude:    tt.fields.Excluded,
+					AgeKeyFile: tt.fields.AgeKeyFile,
+					PatchPaths: tt.fields.PatchPaths,
+					Images:     tt.fields.Images,
+				},
+				OutputDir: tt.fields.OutputDir,
 			}
 			var fileIn *os.File
 			var err error
@@ -96,6 +147,21 @@ func TestOptions_Complete(t *testing.T) {
 				if o.OutputFile != os.Stdout.Name() {
 					t.Errorf("'Expected %s got %s", os.Stdout.Name(), o.OutputFile)
 				}
+			case "read sops encrypted value file":
+				secret, ok := o.Values["Secret"].(map[string]interface{})
+				if !ok {
+					t.Error("'Secret' not found in value")
+				}
+				if password := secret["password"]; password != "my-password" {
+					t.Errorf("'Expected 'my-password' got %v", password)
+				}
+				if o.Decrypter == nil {
+					t.Error("the decrypter must be set")
+				}
+			case "read patch file":
+				if len(o.Patches) != 4 {
+					t.Errorf("'Expected 4 patches got %d", len(o.Patches))
+				}
 			case "read value stdin":
 				iSA, ok := o.Values["ServiceAccount"]
 				if !ok {
@@ -120,6 +186,7 @@ func TestOptions_Validate(t *testing.T) {
 		SortOnKind bool
 		OutputDir  string
 		Excluded   []string
+		ListImages bool
 	}
 	tests := []struct {
 		name    string
@@ -146,18 +213,30 @@ func TestOptions_Validate(t *testing.T) {
 			name:    "empty failed",
 			wantErr: true,
 		},
+		{
+			name: "list images and outputdir failed",
+			fields: fields{
+				Paths:      []string{"../../../test/unit/resources/scenario/musttemplateasset"},
+				OutputDir:  "output",
+				ListImages: true,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &Options{
-				Header:     tt.fields.Header,
-				Paths:      tt.fields.Paths,
-				ValuesPath: tt.fields.ValuesPath,
-				Values:     tt.fields.Values,
-				OutputFile: tt.fields.OutputFile,
-				SortOnKind: tt.fields.SortOnKind,
+				Options: common.Options{
+					Header:     tt.fields.Header,
+					Paths:      tt.fields.Paths,
+					ValuesPath: tt.fields.ValuesPath,
+					Values:     tt.fields.Values,
+					OutputFile: tt.fields.OutputFile,
+					SortOnKind: tt.fields.SortOnKind,
+					Exclude:    tt.fields.Excluded,
+				},
 				OutputDir:  tt.fields.OutputDir,
-				Exclude:    tt.fields.Excluded,
+				ListImages: tt.fields.ListImages,
 			}
 			if err := o.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -167,6 +246,12 @@ func TestOptions_Validate(t *testing.T) {
 }
 
 func TestOptions_Run(t *testing.T) {
+	outputDir := t.TempDir()
+	// The rendered files are written in the output dir with their path
+	kustomizeDir, err := filepath.Abs("../../../test/unit/resources/kustomize")
+	if err != nil {
+		t.Fatal(err)
+	}
 	type fields struct {
 		Header     string
 		Paths      []string
@@ -176,6 +261,23 @@ func TestOptions_Run(t *testing.T) {
 		SortOnKind bool
 		OutputDir  string
 		Excluded   []string
+		// template context
+		TemplateContext bool
+		KubeVersion     string
+		PostRenderer    string
+		// images
+		ImageOverrides map[string]string
+		ListImages     bool
+		// validation
+		Validation bool
+		SchemaDir  string
+		// policy
+		PolicyPaths     []string
+		BuiltinPolicies bool
+		PolicyMode      string
+		// apiVersions
+		CheckAPIVersions   bool
+		ConvertAPIVersions bool
 	}
 	tests := []struct {
 		name    string
@@ -191,22 +293,241 @@ func TestOptions_Run(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "template context invalid kube version",
+			fields: fields{
+				Paths:           []string{"../../../test/unit/resources/scenario/musttemplateasset/body_for_header.txt"},
+				ValuesPath:      "../../../test/unit/resources/scenario/values.yaml",
+				TemplateContext: true,
+				KubeVersion:     "invalid",
+			},
+			wantErr: true,
+		},
+		{
+			name: "post-renderer not found",
+			fields: fields{
+				Paths:        []string{"../../../test/unit/resources/scenario/musttemplateasset/body_for_header.txt"},
+				ValuesPath:   "../../../test/unit/resources/scenario/values.yaml",
+				PostRenderer: "post-renderer-not-found",
+			},
+			wantErr: true,
+		},
+		{
+			name: "kustomization outputdir",
+			fields: fields{
+				Paths:      []string{kustomizeDir},
+				ValuesPath: "../../../test/unit/resources/scenario/values.yaml",
+				OutputDir:  outputDir,
+			},
+			wantErr: false,
+		},
+		{
+			name: "list images",
+			fields: fields{
+				Paths:          []string{kustomizeDir},
+				OutputFile:     filepath.Join(outputDir, "images.txt"),
+				ImageOverrides: map[string]string{"my-image": "mirror.example.com/my-image@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+				ListImages:     true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "validate",
+			fields: fields{
+				Paths:      []string{"../../../test/unit/resources/validate/valid"},
+				Values:     map[string]interface{}{"Name": "my-name"},
+				OutputFile: filepath.Join(outputDir, "valid.yaml"),
+				Validation: true,
+				SchemaDir:  "../../../test/unit/resources/validate/schemas",
+			},
+			wantErr: false,
+		},
+		{
+			name: "validate invalid",
+			fields: fields{
+				Paths:      []string{"../../../test/unit/resources/validate/invalid"},
+				Values:     map[string]interface{}{"Name": "my-name"},
+				OutputFile: filepath.Join(outputDir, "invalid.yaml"),
+				Validation: true,
+				SchemaDir:  "../../../test/unit/resources/validate/schemas",
+			},
+			wantErr: true,
+		},
+		{
+			name: "validate invalid outputdir",
+			fields: fields{
+				Paths:      []string{"../../../test/unit/resources/validate/invalid"},
+				Values:     map[string]interface{}{"Name": "my-name"},
+				OutputDir:  filepath.Join(outputDir, "invalid"),
+				Validation: true,
+				SchemaDir:  "../../../test/unit/resources/validate/schemas",
+			},
+			wantErr: true,
+		},
+		{
+			name: "builtin policies enforce",
+			fields: fields{
+				Paths:           []string{"../../../test/unit/resources/policy/deployment.yaml"},
+				OutputFile:      filepath.Join(outputDir, "policy.yaml"),
+				BuiltinPolicies: true,
+				PolicyMode:      "enforce",
+			},
+			wantErr: true,
+		},
+		{
+			name: "builtin policies warn",
+			fields: fields{
+				Paths:           []string{"../../../test/unit/resources/policy/deployment.yaml"},
+				OutputFile:      filepath.Join(outputDir, "policy.yaml"),
+				BuiltinPolicies: true,
+				PolicyMode:      "warn",
+			},
+			wantErr: false,
+		},
+		{
+			name: "policy file",
+			fields: fields{
+				Paths:       []string{"../../../test/unit/resources/policy/deployment.yaml"},
+				OutputDir:   filepath.Join(outputDir, "policy"),
+				PolicyPaths: []string{"../../../test/unit/resources/policy/rules.yaml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "policy invalid mode",
+			fields: fields{
+				Paths:           []string{"../../../test/unit/resources/policy/deployment.yaml"},
+				OutputFile:      filepath.Join(outputDir, "policy.yaml"),
+				BuiltinPolicies: true,
+				PolicyMode:      "audit",
+			},
+			wantErr: true,
+		},
+		{
+			name: "removed api version",
+			fields: fields{
+				Paths:            []string{"../../../test/unit/resources/deprecation/pdb.yaml"},
+				OutputFile:       filepath.Join(outputDir, "pdb.yaml"),
+				KubeVersion:      "v1.25.0",
+				CheckAPIVersions: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "converted api version",
+			fields: fields{
+				Paths:              []string{"../../../test/unit/resources/deprecation/pdb.yaml"},
+				OutputFile:         filepath.Join(outputDir, "pdb.yaml"),
+				KubeVersion:        "v1.25.0",
+				CheckAPIVersions:   true,
+				ConvertAPIVersions: true,
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &Options{
-				Header:     tt.fields.Header,
-				Paths:      tt.fields.Paths,
-				ValuesPath: tt.fields.ValuesPath,
-				Values:     tt.fields.Values,
-				OutputFile: tt.fields.OutputFile,
-				SortOnKind: tt.fields.SortOnKind,
+				Options: common.Options{
+					Header:     tt.fields.Header,
+					Paths:      tt.fields.Paths,
+					ValuesPath: tt.fields.ValuesPath,
+					Values:     tt.fields.Values,
+					OutputFile: tt.fields.OutputFile,
+					SortOnKind: tt.fields.SortOnKind,
+					Exclude:    tt.fields.Excluded,
+
+					TemplateContext: tt.fields.TemplateContext,
+					KubeVersion:     tt.fields.KubeVersion,
+					PostRenderer:    tt.fields.PostRenderer,
+
+					ImageOverrides: tt.fields.ImageOverrides,
+
+					Validation: tt.fields.Validation,
+					SchemaDir:  tt.fields.SchemaDir,
+
+					PolicyPaths:     tt.fields.PolicyPaths,
+					BuiltinPolicies: tt.fields.BuiltinPolicies,
+					PolicyMode:      tt.fields.PolicyMode,
+
+					CheckAPIVersions:   tt.fields.CheckAPIVersions,
+					ConvertAPIVersions: tt.fields.ConvertAPIVersions,
+				},
 				OutputDir:  tt.fields.OutputDir,
-				Exclude:    tt.fields.Excluded,
+				ListImages: tt.fields.ListImages,
 			}
 			if err := o.Run(); (err != nil) != tt.wantErr {
 				t.Errorf("Options.Run() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			switch tt.name {
+			case "kustomization outputdir":
+				b, err := ioutil.ReadFile(filepath.Join(outputDir, kustomizeDir, "overlay", "kustomization.yaml"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(b), "name: prod-my-app") {
+					t.Errorf("Expected the objects built by kustomize got %s", string(b))
+				}
+				if _, err := os.Stat(filepath.Join(outputDir, kustomizeDir, "overlay", "replicas.yaml")); !os.IsNotExist(err) {
+					t.Errorf("The files of a kustomization must not be rendered")
+				}
+			case "list images":
+				b, err := ioutil.ReadFile(filepath.Join(outputDir, "images.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != "mirror.example.com/my-image@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef\n" {
+					t.Errorf("Expected the overridden image got %s", string(b))
+				}
+			case "converted api version":
+				b, err := ioutil.ReadFile(filepath.Join(outputDir, "pdb.yaml"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(b), "apiVersion: policy/v1\n") {
+					t.Errorf("Expected the converted apiVersion got %s", string(b))
+				}
+			}
+		})
+	}
+}
+
+func TestFormatOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		rendered []string
+		want     string
+	}{
+		{
+			name:     "yaml",
+			file:     "cm.yaml",
+			rendered: []string{"kind: ConfigMap\n", "kind: Secret\n"},
+			want:     "kind: ConfigMap\n\n---\nkind: Secret\n",
+		},
+		{
+			name:     "json object",
+			file:     "cm.json",
+			rendered: []string{`{"kind":"ConfigMap"}`},
+			want:     "{\n  \"kind\": \"ConfigMap\"\n}",
+		},
+		{
+			name:     "json array",
+			file:     "cm.json",
+			rendered: []string{`{"kind":"ConfigMap"}`, "kind: Secret\n"},
+			want:     "[\n  {\n    \"kind\": \"ConfigMap\"\n  },\n  {\n    \"kind\": \"Secret\"\n  }\n]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatOutput(tt.file, tt.rendered)
+			if err != nil {
+				t.Errorf("formatOutput() error = %v", err)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("formatOutput() = %q, want %q", string(got), tt.want)
+			}
 		})
 	}
 }
@@ -2,23 +2,22 @@
 package render
 
 import (
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
 	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
 type Options struct {
-	// Header specify a file that needs to be added at the beginning of each template
-	Header string
-	//A list of Paths
-	Paths      []string
-	ValuesPath string
-	Values     map[string]interface{}
-	OutputFile string
-	SortOnKind bool
-	OutputDir  string
-	Exclude    []string
+	common.Options
+	OutputDir string
+	// ListImages writes the images of the rendered workloads instead of the resources
+	ListImages bool
 }
 
 func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
-	return &Options{}
+	return &Options{
+		Options: common.Options{
+			ApplierFlags: applierFlags,
+		},
+	}
 }
@@ -0,0 +1,68 @@
+// Copyright Red Hat
+package validate
+
+import (
+	"fmt"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"github.com/stolostron/applier/pkg/helpers"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var example = `
+# validate the rendered templates against the OpenAPI schemas of the cluster
+%[1]s validate --values values.yaml --path template_path1 --path tempalte_path2...
+
+# validate offline against the OpenAPI schemas and CRDs of a directory
+%[1]s validate --values values.yaml --path template_path1 --schema-dir schemas
+`
+
+// NewCmd ...
+func NewCmd(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewOptions(applierFlags, streams)
+
+	cmd := &cobra.Command{
+		Use:          "validate",
+		Short:        "validate the rendered templates against their OpenAPI schema",
+		Long:         "validate the templates located in paths rendered with a values.yaml against the OpenAPI schemas of the cluster or of a schema directory and the CRDs found in the rendered resources, the errors are reported with the document and the field path",
+		Example:      fmt.Sprintf(example, helpers.GetExampleHeader()),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.RenderOptions.ValuesPath, "values", "", "The files containing the values")
+	common.AddAgeKeyFileFlag(cmd.Flags(), &o.RenderOptions.AgeKeyFile)
+	cmd.Flags().StringVar(&o.RenderOptions.SchemaDir, "schema-dir", "", "A directory containing OpenAPI v2 documents (ie: kubectl get --raw /openapi/v2) and CRDs used instead of the schemas of the cluster")
+	cmd.Flags().StringVar(&o.RenderOptions.PostRenderer, "post-renderer", "", "The path to an executable receiving the rendered resources as YAML on stdin and writing the resources to use on stdout, like the helm post-renderers")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PostRendererArgs, "post-renderer-args", []string{}, "An argument passed to the post-renderer, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.PatchPaths, "patch", []string{}, "A file containing strategic merge patches or kustomize like patch entries with a target, applied to the rendered resources, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Images, "image", []string{}, "An image override formatted as old=new[@digest], applied to the containers and init containers of the rendered workloads, an old image without tag matches all its tags, can be repeated")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Headers, "header", []string{}, "A file added at the beginning of each template, can be repeated")
+	cmd.Flags().StringVar(&o.RenderOptions.PartialsDir, "partials-dir", "", "The directory containing the partials shared by all templates, like the helm _helpers.tpl")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Paths, "path", []string{}, "The list of template paths, a path can be a glob pattern (ie: templates/**/*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.Exclude, "exclude", []string{}, "The list of paths to exclude, a path can be a glob pattern (ie: templates/**/test-*.yaml) or a regex prefixed by regex:")
+	cmd.Flags().StringSliceVar(&o.RenderOptions.Extensions, "extensions", asset.DefaultExtensions, "The extensions of the files to select in the directories, the files explicitly listed in --path are always selected")
+	cmd.Flags().StringVar(&o.OutputFile, "output-file", "", "The validation errors will be copied in the specified file")
+	cmd.Flags().BoolVar(&o.RenderOptions.TemplateContext, "template-context", false, "If set the values are wrapped in a template context exposing .Values, .Release, .Capabilities, .Template and .Files")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseName, "release-name", "", "The name exposed as .Release.Name in the template context")
+	cmd.Flags().StringVar(&o.RenderOptions.ReleaseNamespace, "release-namespace", "default", "The namespace exposed as .Release.Namespace in the template context")
+	cmd.Flags().StringVar(&o.RenderOptions.KubeVersion, "kube-version", "", "The Kubernetes version exposed as .Capabilities.KubeVersion in the template context, the client-go version by default")
+	cmd.Flags().StringArrayVar(&o.RenderOptions.APIVersions, "api-versions", []string{}, "The apiVersions added to the built-in ones in .Capabilities.APIVersions, can be repeated")
+	return cmd
+}
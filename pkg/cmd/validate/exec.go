@@ -0,0 +1,62 @@
+// Copyright Red Hat
+package validate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stolostron/applier/pkg/apply"
+)
+
+func (o *Options) Complete(cmd *cobra.Command, args []string) (err error) {
+	if err := o.RenderOptions.Complete(cmd, args); err != nil {
+		return err
+	}
+	if len(o.OutputFile) == 0 {
+		o.OutputFile = os.Stdout.Name()
+	}
+	return nil
+}
+
+func (o *Options) Validate() error {
+	return o.RenderOptions.Validate()
+}
+
+func (o *Options) Run() error {
+	applier, reader, files, err := o.RenderOptions.NewApplier()
+	if err != nil {
+		return err
+	}
+	validator, err := apply.LoadValidator(o.RenderOptions.SchemaDir, o.RenderOptions.ApplierFlags)
+	if err != nil {
+		return err
+	}
+	validationErrors, err := applier.WithValidator(validator).Validate(reader, o.RenderOptions.Values, "", files...)
+	if err != nil {
+		return err
+	}
+	if len(validationErrors) == 0 {
+		return nil
+	}
+	if err := writeErrors(o.OutputFile, validationErrors); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d validation errors found", len(validationErrors))
+}
+
+//writeErrors writes the validation errors one per line
+func writeErrors(fileName string, validationErrors apply.ValidationErrors) error {
+	var b strings.Builder
+	for _, validationError := range validationErrors {
+		b.WriteString(validationError.Error() + "\n")
+	}
+	if fileName == os.Stdout.Name() {
+		_, err := os.Stdout.WriteString(b.String())
+		return err
+	}
+	return ioutil.WriteFile(filepath.Clean(fileName), []byte(b.String()), 0600)
+}
@@ -0,0 +1,66 @@
+// Copyright Red Hat
+package validate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+	"github.com/stolostron/applier/pkg/cmd/apply/common"
+	"github.com/stolostron/applier/pkg/cmd/render"
+)
+
+func TestOptions_Run(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "errors.txt")
+	tests := []struct {
+		name    string
+		paths   []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			paths: []string{"../../../test/unit/resources/validate/valid"},
+			want:  "",
+		},
+		{
+			name:  "invalid",
+			paths: []string{"../../../test/unit/resources/validate/invalid"},
+			want: `../../../test/unit/resources/validate/invalid/backup.yaml: Backup my-name: spec.schedule: Required value
+../../../test/unit/resources/validate/invalid/backup.yaml: Backup my-name: spec.schedules: unknown field
+../../../test/unit/resources/validate/invalid/service.yaml: Service my-name: spec.ports[0].port: missing required field
+../../../test/unit/resources/validate/invalid/service.yaml: Service my-name: spec.ports[0].targetPort: unknown field
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				RenderOptions: &render.Options{
+					Options: common.Options{
+						Paths:      tt.paths,
+						Values:     map[string]interface{}{"Name": "my-name"},
+						Extensions: asset.DefaultExtensions,
+						SchemaDir:  "../../../test/unit/resources/validate/schemas",
+					},
+				},
+				OutputFile: outputFile,
+			}
+			if err := o.Run(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			b, err := ioutil.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Expected %s got %s", tt.want, string(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright Red Hat
+package validate
+
+import (
+	"github.com/stolostron/applier/pkg/cmd/render"
+	genericclioptionsapplier "github.com/stolostron/applier/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+type Options struct {
+	//RenderOptions are the options rendering the validated resources
+	RenderOptions *render.Options
+	//The file where the validation errors are written
+	OutputFile string
+}
+
+func NewOptions(applierFlags *genericclioptionsapplier.ApplierFlags, streams genericclioptions.IOStreams) *Options {
+	return &Options{
+		RenderOptions: render.NewOptions(applierFlags, streams),
+	}
+}
@@ -3,6 +3,7 @@ package genericclioptions
 
 import (
 	"github.com/spf13/pflag"
+	"k8s.io/client-go/discovery"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 )
 
@@ -24,3 +25,8 @@ func NewApplierFlags(f cmdutil.Factory) *ApplierFlags {
 // Dryrun and Timeout options are not used in all commands (ie:render)
 func (f *ApplierFlags) AddFlags(flags *pflag.FlagSet) {
 }
+
+// ToDiscoveryClient returns the discovery client of the kubectl factory
+func (f *ApplierFlags) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return f.KubectlFactory.ToDiscoveryClient()
+}
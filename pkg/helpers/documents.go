@@ -0,0 +1,247 @@
+// Copyright Red Hat
+
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	documentSeparator = "---"
+	documentEnd       = "..."
+	//documentIndexSeparator separates the source file and the document index in the name of a document
+	documentIndexSeparator = "#"
+)
+
+//Document is a document of a file, the name records the source file and the index of the document
+type Document struct {
+	Name    string
+	Content []byte
+}
+
+//DocumentReader reads the documents of a YAML stream one by one with the apimachinery YAML reader.
+//A document starts with a "---" line, which can be followed by a comment, and can be terminated
+//by a "..." line. Windows line endings are converted.
+type DocumentReader struct {
+	reader   *yamlutil.YAMLReader
+	buffered *bufio.Reader
+	tail     *tailReader
+}
+
+//tailReader records the last line of the stream to keep the last document as is
+//when the stream doesn't end with a line break, the YAML reader adds one.
+type tailReader struct {
+	reader io.Reader
+	tail   []byte
+	eof    bool
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	if i := bytes.LastIndexByte(p[:n], '\n'); i != -1 {
+		t.tail = append([]byte{}, p[i+1:n]...)
+	} else {
+		t.tail = append(t.tail, p[:n]...)
+	}
+	t.eof = err == io.EOF
+	return n, err
+}
+
+//NewDocumentReader returns a DocumentReader reading the YAML stream r
+func NewDocumentReader(r io.Reader) *DocumentReader {
+	tail := &tailReader{reader: r}
+	buffered := bufio.NewReader(tail)
+	return &DocumentReader{
+		reader:   yamlutil.NewYAMLReader(buffered),
+		buffered: buffered,
+		tail:     tail,
+	}
+}
+
+//Read returns the next document of the stream, io.EOF is returned when no documents are left.
+func (d *DocumentReader) Read() ([]byte, error) {
+	document, err := d.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.SplitAfter(document, []byte("\n"))
+	// The separator of the first document is kept by the YAML reader
+	if bytes.HasPrefix(lines[0], []byte(documentSeparator)) {
+		lines = lines[1:]
+		document = bytes.Join(lines, nil)
+	}
+	// The document end marker is not part of the document
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 {
+			continue
+		}
+		if string(line) == documentEnd {
+			document = bytes.Join(lines[:i], nil)
+		}
+		break
+	}
+	tail := bytes.TrimSuffix(d.tail.tail, []byte("\r"))
+	if d.tail.eof && d.buffered.Buffered() == 0 && len(tail) != 0 &&
+		bytes.HasSuffix(document, append(tail, '\n')) {
+		document = document[:len(document)-1]
+	}
+	return document, nil
+}
+
+//SplitDocuments returns the non-empty documents of a YAML stream
+func SplitDocuments(b []byte) ([][]byte, error) {
+	documents := make([][]byte, 0)
+	reader := NewDocumentReader(bytes.NewReader(b))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !IsEmpty(document) {
+			documents = append(documents, document)
+		}
+	}
+}
+
+//SplitFile splits the content of a file in documents and expands the documents of kind List.
+//A file with a single document keeps its name, otherwise each document is named
+//with DocumentName after the source file and its index.
+func SplitFile(name string, b []byte) ([]Document, error) {
+	return splitFile(name, b, func(document []byte) bool {
+		_, ok, _ := ExpandList(document)
+		return ok
+	})
+}
+
+//splitFile splits the content of a file in documents and expands the documents for which isList returns true.
+func splitFile(name string, b []byte, isList func(document []byte) bool) ([]Document, error) {
+	documents, ok := splitJSON(b)
+	if !ok {
+		var err error
+		documents, err = SplitDocuments(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(documents) == 1 && !isList(documents[0]) {
+		return []Document{{Name: name, Content: documents[0]}}, nil
+	}
+	named := make([]Document, 0, len(documents))
+	for k, document := range documents {
+		if !isList(document) {
+			named = append(named, Document{Name: DocumentName(name, k), Content: document})
+			continue
+		}
+		items, _, err := ExpandList(document)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			named = append(named, Document{Name: DocumentName(name, k, i), Content: item})
+		}
+	}
+	return named, nil
+}
+
+//IsJSON returns true if the content is a JSON object or array
+func IsJSON(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) != 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b)
+}
+
+//splitJSON returns the documents of a JSON stream, the items of the arrays are documents.
+//The returned bool is false if the content is not JSON.
+func splitJSON(b []byte) ([][]byte, bool) {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	documents := make([][]byte, 0)
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return documents, true
+		}
+		if err != nil {
+			return nil, false
+		}
+		if raw[0] != '[' {
+			documents = append(documents, raw)
+			continue
+		}
+		items := make([]json.RawMessage, 0)
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, false
+		}
+		for _, item := range items {
+			documents = append(documents, item)
+		}
+	}
+}
+
+//ExpandList returns the items of a document of kind List, the returned bool is false
+//if the document is not a List. The items of a JSON List are returned as JSON.
+func ExpandList(document []byte) ([][]byte, bool, error) {
+	list := struct {
+		Kind  string        `json:"kind"`
+		Items []interface{} `json:"items"`
+	}{}
+	if err := yaml.Unmarshal(document, &list); err != nil || list.Kind != "List" {
+		return nil, false, nil
+	}
+	marshal := yaml.Marshal
+	if IsJSON(document) {
+		marshal = func(o interface{}) ([]byte, error) {
+			return json.MarshalIndent(o, "", "  ")
+		}
+	}
+	items := make([][]byte, 0, len(list.Items))
+	for _, item := range list.Items {
+		b, err := marshal(item)
+		if err != nil {
+			return nil, true, err
+		}
+		items = append(items, b)
+	}
+	return items, true, nil
+}
+
+//DocumentName returns the name of a document of a file, the name records the source file
+//and the index of the document, the indexes of the items of a List are separated by a dot.
+func DocumentName(file string, indexes ...int) string {
+	s := make([]string, len(indexes))
+	for i, index := range indexes {
+		s[i] = strconv.Itoa(index)
+	}
+	return fmt.Sprintf("%s%s%s", file, documentIndexSeparator, strings.Join(s, "."))
+}
+
+//SourceFile returns the source file of a document name built with DocumentName
+//or the name itself if it is not a document name.
+func SourceFile(name string) string {
+	i := strings.LastIndex(name, documentIndexSeparator)
+	if i == -1 {
+		return name
+	}
+	for _, index := range strings.Split(name[i+1:], ".") {
+		if _, err := strconv.Atoi(index); err != nil {
+			return name
+		}
+	}
+	return name[:i]
+}
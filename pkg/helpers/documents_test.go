@@ -0,0 +1,239 @@
+// Copyright Red Hat
+
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/applier/pkg/asset"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "single document",
+			content: "kind: ConfigMap\n",
+			want:    []string{"kind: ConfigMap\n"},
+		},
+		{
+			name:    "separators and empty documents",
+			content: "---\nkind: ConfigMap\n---\n# comment only\n---\nkind: Secret",
+			want:    []string{"kind: ConfigMap\n", "kind: Secret"},
+		},
+		{
+			name:    "stream ending with a separator",
+			content: "kind: ConfigMap\n---",
+			want:    []string{"kind: ConfigMap\n"},
+		},
+		{
+			name:    "separator with comment",
+			content: "kind: ConfigMap\n--- # the secret\nkind: Secret\n",
+			want:    []string{"kind: ConfigMap\n", "kind: Secret\n"},
+		},
+		{
+			name:    "separator with content",
+			content: "kind: ConfigMap\n--- kind: Secret\n",
+			wantErr: true,
+		},
+		{
+			name:    "windows line endings",
+			content: "kind: ConfigMap\r\n---\r\nkind: Secret\r\n",
+			want:    []string{"kind: ConfigMap\n", "kind: Secret\n"},
+		},
+		{
+			name:    "separator in block scalar",
+			content: "kind: ConfigMap\ndata:\n  file: |\n    a\n    ---\n    b\n",
+			want:    []string{"kind: ConfigMap\ndata:\n  file: |\n    a\n    ---\n    b\n"},
+		},
+		{
+			name:    "invalid separator",
+			content: "kind: ConfigMap\n----\n",
+			wantErr: true,
+		},
+		{
+			name:    "document end",
+			content: "kind: ConfigMap\n...\n---\nkind: Secret\n",
+			want:    []string{"kind: ConfigMap\n", "kind: Secret\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitDocuments([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitDocuments() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			gotS := make([]string, len(got))
+			for i, b := range got {
+				gotS[i] = string(b)
+			}
+			if !reflect.DeepEqual(gotS, tt.want) {
+				t.Errorf("SplitDocuments() = %q, want %q", gotS, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandList(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+		wantList bool
+	}{
+		{
+			name: "list",
+			document: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: cm1
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: s1
+`,
+			want: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm1\n",
+				"apiVersion: v1\nkind: Secret\nmetadata:\n  name: s1\n",
+			},
+			wantList: true,
+		},
+		{
+			name:     "not a list",
+			document: "apiVersion: v1\nkind: ConfigMapList\nitems: []\n",
+			wantList: false,
+		},
+		{
+			name:     "not yaml",
+			document: "kind: {{ .Kind }}\n",
+			wantList: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotList, err := ExpandList([]byte(tt.document))
+			if err != nil {
+				t.Errorf("ExpandList() error = %v", err)
+				return
+			}
+			if gotList != tt.wantList {
+				t.Errorf("ExpandList() list = %v, want %v", gotList, tt.wantList)
+			}
+			gotS := make([]string, 0)
+			for _, b := range got {
+				gotS = append(gotS, string(b))
+			}
+			if tt.want != nil && !reflect.DeepEqual(gotS, tt.want) {
+				t.Errorf("ExpandList() = %q, want %q", gotS, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: DocumentName("dir/file.yaml", 1), want: "dir/file.yaml"},
+		{name: DocumentName("dir/file.yaml", 1, 2), want: "dir/file.yaml"},
+		{name: "dir/file.yaml", want: "dir/file.yaml"},
+		{name: "dir/file#a.yaml", want: "dir/file#a.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SourceFile(tt.name); got != tt.want {
+				t.Errorf("SourceFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitFiles_Names(t *testing.T) {
+	reader := asset.NewMemFSReader()
+	reader.AddAsset("single.yaml", []byte("kind: ConfigMap\n"))
+	reader.AddAsset("multi.yaml", []byte("kind: ConfigMap\n--- # secret\nkind: Secret\n"))
+	reader.AddAsset("list.yaml", []byte("kind: List\nitems:\n- kind: ConfigMap\n- kind: Secret\n"))
+	reader.AddAsset("templated.yaml", []byte("kind: List\nitems:\n{{ range .Items }}\n- kind: {{ . }}\n{{ end }}\n"))
+	got, err := SplitFiles(reader, []string{"single.yaml", "multi.yaml", "list.yaml", "templated.yaml"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	names, err := got.AssetNames(nil, nil, "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []string{"single.yaml", "multi.yaml#0", "multi.yaml#1", "list.yaml#0.0", "list.yaml#0.1", "templated.yaml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("SplitFiles() names = %v, want %v", names, want)
+	}
+}
+
+func TestSplitFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Document
+	}{
+		{
+			name:    "json object",
+			content: "{\n\t\"kind\": \"ConfigMap\"\n}\n",
+			want:    []Document{{Name: "file", Content: []byte("{\n\t\"kind\": \"ConfigMap\"\n}")}},
+		},
+		{
+			name:    "json array",
+			content: `[{"kind": "ConfigMap"}, {"kind": "Secret"}]`,
+			want: []Document{
+				{Name: "file#0", Content: []byte(`{"kind": "ConfigMap"}`)},
+				{Name: "file#1", Content: []byte(`{"kind": "Secret"}`)},
+			},
+		},
+		{
+			name:    "json stream",
+			content: "{\"kind\": \"ConfigMap\"}\n{\"kind\": \"Secret\"}\n",
+			want: []Document{
+				{Name: "file#0", Content: []byte(`{"kind": "ConfigMap"}`)},
+				{Name: "file#1", Content: []byte(`{"kind": "Secret"}`)},
+			},
+		},
+		{
+			name:    "json list",
+			content: `{"kind": "List", "items": [{"kind": "ConfigMap"}, {"kind": "Secret"}]}`,
+			want: []Document{
+				{Name: "file#0.0", Content: []byte("{\n  \"kind\": \"ConfigMap\"\n}")},
+				{Name: "file#0.1", Content: []byte("{\n  \"kind\": \"Secret\"\n}")},
+			},
+		},
+		{
+			name:    "yaml flow mapping",
+			content: "{kind: ConfigMap}\n",
+			want:    []Document{{Name: "file", Content: []byte("{kind: ConfigMap}\n")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitFile("file", []byte(tt.content))
+			if err != nil {
+				t.Errorf("SplitFile() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,51 +3,52 @@
 package helpers
 
 import (
-	"fmt"
-	"path/filepath"
-	"regexp"
+	"strings"
 
 	"github.com/stolostron/applier/pkg/asset"
 )
 
+//HasMultipleAssets returns true if the asset contains more than one document
 func HasMultipleAssets(reader asset.ScenarioReader, path string) (bool, error) {
-	// Seems ^ and $ are not working
-	re := regexp.MustCompile("\n-{3}[\\s]*\n")
 	b, err := reader.Asset(path)
 	if err != nil {
 		return false, err
 	}
-	s := string(b)
-	splitted := re.Split(s, -1)
-	return len(splitted) != 1, nil
+	documents, err := SplitDocuments(b)
+	if err != nil {
+		return false, err
+	}
+	return len(documents) > 1, nil
 }
 
+//SplitFiles splits the files in documents and stores them in a MemFS.
+//A file with a single document keeps its name, otherwise each document is named
+//with DocumentName after the source file and its index.
+//The documents of kind List which are not templated are expanded in their items.
 func SplitFiles(reader asset.ScenarioReader, paths []string) (*asset.MemFS, error) {
 	memFs := asset.NewMemFSReader()
-	re := regexp.MustCompile("\n-{3}[\\s]*\n")
-
 	for _, p := range paths {
 		b, err := reader.Asset(p)
 		if err != nil {
 			return nil, err
 		}
-		splitted := re.Split(string(b), -1)
-
-		cleanedSplitted := make([]string, 0)
-
-		for _, s := range splitted {
-			if !IsEmpty([]byte(s)) {
-				cleanedSplitted = append(cleanedSplitted, s)
-			}
-		}
-
-		if len(cleanedSplitted) == 1 {
-			memFs.AddAsset(p, []byte(cleanedSplitted[0]))
-			continue
+		documents, err := splitFile(p, b, isStaticList)
+		if err != nil {
+			return nil, err
 		}
-		for k, s := range cleanedSplitted {
-			memFs.AddAsset(filepath.Join(filepath.Dir(p), fmt.Sprintf("%s.%d%s", filepath.Base(p), k, filepath.Ext(p))), []byte(s))
+		for _, document := range documents {
+			memFs.AddAsset(document.Name, document.Content)
 		}
 	}
 	return memFs, nil
 }
+
+//isStaticList returns true if the document is a List without template actions,
+//the templated Lists are expanded once rendered.
+func isStaticList(document []byte) bool {
+	if strings.Contains(string(document), "{{") {
+		return false
+	}
+	_, ok, _ := ExpandList(document)
+	return ok
+}
@@ -0,0 +1,307 @@
+//Package sops decrypts the files encrypted with sops (https://github.com/getsops/sops) using the sops
+//library, the age keys are read like sops or from a key file, and the values encrypted with age.
+package sops
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	gosops "go.mozilla.org/sops/v3"
+	sopsaes "go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/keyservice"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	//AgeKeyEnv is the environment variable containing the age keys, like for sops
+	AgeKeyEnv = "SOPS_AGE_KEY"
+	//AgeKeyFileEnv is the environment variable containing the path of the age keys file, like for sops
+	AgeKeyFileEnv = "SOPS_AGE_KEY_FILE"
+	//metadataKey is the key of the sops metadata in an encrypted file
+	metadataKey = "sops"
+)
+
+//ErrNoKeys is returned when no age keys are available to decrypt
+var ErrNoKeys = errors.New("no age keys to decrypt, set " + AgeKeyEnv + " or " + AgeKeyFileEnv)
+
+//Decrypter decrypts the sops files and the age encrypted values with age identities
+type Decrypter struct {
+	identities []age.Identity
+	//load returns the decrypter of the identities loaded on the first decryption
+	load    func() (*Decrypter, error)
+	once    sync.Once
+	loadErr error
+}
+
+//NewDecrypter returns a Decrypter using the identities
+func NewDecrypter(identities ...age.Identity) *Decrypter {
+	return &Decrypter{
+		identities: identities,
+	}
+}
+
+//NewDecrypterFromKeyFile returns a Decrypter using the age keys of the file
+func NewDecrypterFromKeyFile(keyFile string) (*Decrypter, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(keyFile))
+	if err != nil {
+		return nil, err
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the age keys of %s: %w", keyFile, err)
+	}
+	return NewDecrypter(identities...), nil
+}
+
+//NewDecrypterFromEnv returns a Decrypter using the age keys found like sops does,
+//in the AgeKeyEnv environment variable, in the file of the AgeKeyFileEnv environment variable
+//and in the sops/age/keys.txt file of the user configuration directory.
+func NewDecrypterFromEnv() (*Decrypter, error) {
+	identities := make([]age.Identity, 0)
+	if keys, ok := os.LookupEnv(AgeKeyEnv); ok {
+		ids, err := age.ParseIdentities(strings.NewReader(keys))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the age keys of %s: %w", AgeKeyEnv, err)
+		}
+		identities = append(identities, ids...)
+	}
+	keyFile, ok := os.LookupEnv(AgeKeyFileEnv)
+	if !ok {
+		if dir, err := os.UserConfigDir(); err == nil {
+			keyFile = filepath.Join(dir, "sops", "age", "keys.txt")
+		}
+	}
+	if len(keyFile) != 0 {
+		if _, err := os.Stat(keyFile); err == nil || ok {
+			decrypter, err := NewDecrypterFromKeyFile(keyFile)
+			if err != nil {
+				return nil, err
+			}
+			identities = append(identities, decrypter.identities...)
+		}
+	}
+	return NewDecrypter(identities...), nil
+}
+
+//IsEncrypted returns true if the YAML or JSON content is a sops encrypted file
+func IsEncrypted(b []byte) bool {
+	root := mapping(b)
+	if root == nil {
+		return false
+	}
+	_, m := lookup(root, metadataKey)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return false
+	}
+	_, mac := lookup(m, "mac")
+	return mac != nil
+}
+
+//LoadDecrypter returns a Decrypter using the keys of the keyFile or the keys found by NewDecrypterFromEnv
+//if keyFile is empty. The keys are loaded on the first decryption and so invalid keys only fail
+//the decryptions.
+func LoadDecrypter(keyFile string) *Decrypter {
+	return &Decrypter{
+		load: func() (*Decrypter, error) {
+			if len(keyFile) != 0 {
+				return NewDecrypterFromKeyFile(keyFile)
+			}
+			return NewDecrypterFromEnv()
+		},
+	}
+}
+
+//DecryptValues returns the decrypted content of a sops encrypted file using the keys of the keyFile
+//or the keys found by NewDecrypterFromEnv if keyFile is empty.
+//The content is returned as is if it is not encrypted.
+func DecryptValues(b []byte, keyFile string) ([]byte, error) {
+	if !IsEncrypted(b) {
+		return b, nil
+	}
+	return LoadDecrypter(keyFile).DecryptFile(b)
+}
+
+//DecryptValues returns the decrypted content of a sops encrypted file,
+//the content is returned as is if it is not encrypted.
+func (d *Decrypter) DecryptValues(b []byte) ([]byte, error) {
+	if !IsEncrypted(b) {
+		return b, nil
+	}
+	return d.DecryptFile(b)
+}
+
+//DecryptFile decrypts a sops encrypted YAML or JSON file with the sops library, the MAC is verified
+//and the decrypted content is returned as YAML without the sops metadata. The data key is decrypted
+//with the age keys of the Decrypter and the other keys, such as pgp or KMS keys, are decrypted like sops does.
+func (d *Decrypter) DecryptFile(b []byte) ([]byte, error) {
+	if macOnlyEncrypted(b) {
+		return nil, fmt.Errorf("the files encrypted with mac_only_encrypted are not supported")
+	}
+	store := &sopsyaml.Store{}
+	tree, err := store.LoadEncryptedFile(b)
+	if err != nil {
+		return nil, err
+	}
+	// The errors of the age keys loading are reported as is and not as a failure of each age key
+	if hasAgeKeys(tree.Metadata) {
+		if _, err := d.loadIdentities(); err != nil {
+			return nil, err
+		}
+	}
+	dataKey, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{
+		keyService{decrypter: d, local: keyservice.NewLocalClient()},
+	})
+	if err != nil {
+		// The user error of sops reports the error of each key
+		if userErr, ok := err.(gosops.UserError); ok {
+			return nil, errors.New(userErr.UserError())
+		}
+		return nil, err
+	}
+	cipher := sopsaes.NewCipher()
+	mac, err := tree.Decrypt(dataKey, cipher)
+	if err != nil {
+		return nil, err
+	}
+	originalMAC, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the MAC: %w", err)
+	}
+	if original, ok := originalMAC.(string); !ok || subtle.ConstantTimeCompare([]byte(original), []byte(mac)) != 1 {
+		return nil, fmt.Errorf("MAC mismatch, the file has been modified after its encryption")
+	}
+	return store.EmitPlainFile(tree.Branches)
+}
+
+//Decrypt decrypts an age encrypted value, armored or base64 encoded
+func (d *Decrypter) Decrypt(ciphertext string) (string, error) {
+	identities, err := d.loadIdentities()
+	if err != nil {
+		return "", err
+	}
+	if len(identities) == 0 {
+		return "", ErrNoKeys
+	}
+	var src io.Reader
+	if strings.HasPrefix(strings.TrimSpace(ciphertext), armor.Header) {
+		src = armor.NewReader(strings.NewReader(strings.TrimSpace(ciphertext)))
+	} else {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ciphertext))
+		if err != nil {
+			return "", fmt.Errorf("the value is neither an armored nor a base64 encoded age ciphertext: %w", err)
+		}
+		src = bytes.NewReader(b)
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//loadIdentities returns the identities, they are loaded on the first call if the Decrypter has a loader
+func (d *Decrypter) loadIdentities() ([]age.Identity, error) {
+	if d.load == nil {
+		return d.identities, nil
+	}
+	d.once.Do(func() {
+		decrypter, err := d.load()
+		if err != nil {
+			d.loadErr = err
+			return
+		}
+		d.identities = decrypter.identities
+	})
+	return d.identities, d.loadErr
+}
+
+//keyService decrypts the age keys of the sops files with the age keys of the Decrypter
+//and the other keys with the sops local key service
+type keyService struct {
+	decrypter *Decrypter
+	local     keyservice.KeyServiceClient
+}
+
+func (s keyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, fmt.Errorf("the encryption is not supported")
+}
+
+func (s keyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	if req.GetKey().GetAgeKey() == nil {
+		return s.local.Decrypt(ctx, req, opts...)
+	}
+	plaintext, err := s.decrypter.Decrypt(string(req.GetCiphertext()))
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: []byte(plaintext)}, nil
+}
+
+//hasAgeKeys returns true if the data key of the file is encrypted with age keys
+func hasAgeKeys(m gosops.Metadata) bool {
+	for _, group := range m.KeyGroups {
+		for _, key := range group {
+			if _, ok := key.(*sopsage.MasterKey); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//macOnlyEncrypted returns true if the MAC of the sops file is computed only over the encrypted values,
+//this sops 3.9 option is not supported by the sops library.
+func macOnlyEncrypted(b []byte) bool {
+	root := mapping(b)
+	if root == nil {
+		return false
+	}
+	_, m := lookup(root, metadataKey)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return false
+	}
+	_, v := lookup(m, "mac_only_encrypted")
+	return v != nil && v.Value == "true"
+}
+
+//mapping returns the root map of the document or nil if the document is not a map
+func mapping(b []byte) *yaml.Node {
+	var document yaml.Node
+	if err := yaml.Unmarshal(b, &document); err != nil {
+		return nil
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return document.Content[0]
+}
+
+//lookup returns the index and the value of a key of a map node
+func lookup(m *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i + 1, m.Content[i+1]
+		}
+	}
+	return -1, nil
+}
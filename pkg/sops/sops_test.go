@@ -0,0 +1,352 @@
+// Copyright Red Hat
+
+package sops
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const testDir = "../../test/unit/resources/sops"
+
+func unmarshal(t *testing.T, b []byte) interface{} {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecryptValues(t *testing.T) {
+	// The encrypted files are encrypted by the sops binary with the key of keys.txt
+	encrypted, err := ioutil.ReadFile(filepath.Join(testDir, "values.enc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedJSON, err := ioutil.ReadFile(filepath.Join(testDir, "values.enc.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	macOnlyEncrypted, err := ioutil.ReadFile(filepath.Join(testDir, "values.mac-only.enc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadFile(filepath.Join(testDir, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := ioutil.WriteFile(otherKeyFile, []byte(otherIdentity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		values  []byte
+		keyFile string
+		want    []byte
+		wantErr string
+	}{
+		{
+			name:    "encrypted by sops",
+			values:  encrypted,
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			want:    plaintext,
+		},
+		{
+			name:    "json encrypted by sops",
+			values:  encryptedJSON,
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			want:    plaintext,
+		},
+		{
+			name:    "not encrypted",
+			values:  plaintext,
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			want:    plaintext,
+		},
+		{
+			name:    "wrong key",
+			values:  encrypted,
+			keyFile: otherKeyFile,
+			wantErr: "Failed to get the data key",
+		},
+		{
+			name:    "modified encrypted value",
+			values:  bytes.Replace(encrypted, []byte("Namespace: ENC[AES256_GCM,data:"), []byte("Namespace: ENC[AES256_GCM,data:AA"), 1),
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			wantErr: "Could not decrypt value",
+		},
+		{
+			name:    "mac only encrypted",
+			values:  macOnlyEncrypted,
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			wantErr: "the files encrypted with mac_only_encrypted are not supported",
+		},
+		{
+			name:    "modified unencrypted value",
+			values:  bytes.Replace(encrypted, []byte("Port_unencrypted: 8080"), []byte("Port_unencrypted: 8081"), 1),
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			wantErr: "MAC mismatch",
+		},
+		{
+			name:    "missing key file",
+			values:  encrypted,
+			keyFile: filepath.Join(testDir, "missing.txt"),
+			wantErr: "no such file or directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptValues(tt.values, tt.keyFile)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DecryptValues() error = %v, wantErr %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("DecryptValues() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(unmarshal(t, got), unmarshal(t, tt.want)) {
+				t.Errorf("DecryptValues() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(plaintext string, armored bool) string {
+		var buf bytes.Buffer
+		var out io.Writer = &buf
+		var armorWriter io.WriteCloser
+		if armored {
+			armorWriter = armor.NewWriter(&buf)
+			out = armorWriter
+		}
+		w, err := age.Encrypt(out, identity.Recipient())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(plaintext)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !armored {
+			return base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+		if err := armorWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	tests := []struct {
+		name       string
+		identities []age.Identity
+		ciphertext string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "armored",
+			identities: []age.Identity{identity},
+			ciphertext: encrypt("my-password", true),
+			want:       "my-password",
+		},
+		{
+			name:       "base64",
+			identities: []age.Identity{otherIdentity, identity},
+			ciphertext: encrypt("my-password", false),
+			want:       "my-password",
+		},
+		{
+			name:       "wrong key",
+			identities: []age.Identity{otherIdentity},
+			ciphertext: encrypt("my-password", true),
+			wantErr:    true,
+		},
+		{
+			name:       "no keys",
+			ciphertext: encrypt("my-password", true),
+			wantErr:    true,
+		},
+		{
+			name:       "not encrypted",
+			identities: []age.Identity{identity},
+			ciphertext: "my-password",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDecrypter(tt.identities...).Decrypt(tt.ciphertext)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDecrypterFromEnv(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ioutil.ReadFile(filepath.Join(testDir, "values.enc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "key",
+			env:  map[string]string{AgeKeyEnv: identity.String() + "\n" + readTestKey(t)},
+		},
+		{
+			name: "key file",
+			env:  map[string]string{AgeKeyFileEnv: filepath.Join(testDir, "keys.txt")},
+		},
+		{
+			name:    "no keys",
+			env:     map[string]string{AgeKeyFileEnv: ""},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			t.Setenv("HOME", t.TempDir())
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			decrypter, err := NewDecrypterFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = decrypter.DecryptFile(encrypted)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecryptFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDecrypter(t *testing.T) {
+	encrypted, err := ioutil.ReadFile(filepath.Join(testDir, "values.enc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadFile(filepath.Join(testDir, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		keyFile string
+		values  []byte
+		wantErr string
+	}{
+		{
+			name:   "invalid keys and values not encrypted",
+			values: plaintext,
+		},
+		{
+			name:    "invalid keys and encrypted values",
+			values:  encrypted,
+			wantErr: "failed to parse the age keys of " + AgeKeyEnv,
+		},
+		{
+			name:    "key file",
+			keyFile: filepath.Join(testDir, "keys.txt"),
+			values:  encrypted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AgeKeyEnv, "invalid")
+			decrypter := LoadDecrypter(tt.keyFile)
+			got, err := decrypter.DecryptValues(tt.values)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DecryptValues() error = %v, wantErr %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecryptValues() error = %v", err)
+			}
+			if !reflect.DeepEqual(unmarshal(t, got), unmarshal(t, plaintext)) {
+				t.Errorf("DecryptValues() = %s, want %s", got, plaintext)
+			}
+		})
+	}
+}
+
+//readTestKey returns the secret key of the test key file
+func readTestKey(t *testing.T) string {
+	b, err := ioutil.ReadFile(filepath.Join(testDir, "keys.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "AGE-SECRET-KEY-") {
+			return line
+		}
+	}
+	t.Fatal("no secret key in the test key file")
+	return ""
+}
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		values string
+		want   bool
+	}{
+		{values: "sops:\n  mac: ENC[]\n", want: true},
+		{values: `{"sops": {"mac": "ENC[]"}}`, want: true},
+		{values: "sops:\n  version: 3.9.0\n", want: false},
+		{values: "sops: true\n", want: false},
+		{values: "- sops\n", want: false},
+		{values: "a: b\n", want: false},
+		{values: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.values), func(t *testing.T) {
+			if got := IsEncrypted([]byte(tt.values)); got != tt.want {
+				t.Errorf("IsEncrypted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
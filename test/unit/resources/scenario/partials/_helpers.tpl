@@ -0,0 +1,3 @@
+{{- define "partials.labels" }}
+    app: {{ .Name }}
+{{- end }}
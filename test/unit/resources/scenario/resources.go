@@ -7,7 +7,7 @@ import (
 	"github.com/stolostron/applier/pkg/asset"
 )
 
-//go:embed musttemplateasset ownerref multicontent render/results
+//go:embed musttemplateasset ownerref multicontent all:partials render/results
 var files embed.FS
 
 func GetScenarioResourcesReader() *asset.ScenarioResourcesReader {